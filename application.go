@@ -1,10 +1,21 @@
 package flow
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"github.com/julienschmidt/httprouter"
 	"go.uber.org/zap"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
 // ServerConfig 定义服务配置
@@ -13,6 +24,29 @@ type ServerConfig struct {
 	Proxy   bool   // 是否是代理模式
 	Host    string // 服务启动地址
 	Port    int    // 服务端口
+	// 优雅关闭的超时时间，超过这个时间未处理完的连接将被强制关闭
+	ShutdownTimeout time.Duration
+	// 默认的请求实体最大长度，0表示不限制，可以通过MaxBodySize中间件按路由组或者路由设置
+	MaxBodySize int64
+	// 读取请求头的超时时间，防止慢速攻击，默认值10秒
+	ReadHeaderTimeout time.Duration
+	// 读取整个请求的超时时间，包括请求实体，0表示不限制
+	ReadTimeout time.Duration
+	// 写入返回的超时时间，0表示不限制，有大文件下载或者长时间推送的接口时不要设置
+	WriteTimeout time.Duration
+	// keep-alive连接的空闲超时时间，默认值120秒
+	IdleTimeout time.Duration
+	// 请求头的最大长度，默认值1MB
+	MaxHeaderBytes int
+	// TLS证书文件和私钥文件，设置后使用https，同时支持HTTP/2
+	CertFile string
+	KeyFile  string
+	// 自定义的TLS配置，设置了证书的不需要再设置CertFile和KeyFile
+	TLSConfig *tls.Config `json:"-"`
+	// 开发模式，没有设置证书时生成自签名证书启动https，不能用于生产环境
+	DevTLS bool
+	// 没有使用https时是否支持明文的HTTP/2（h2c）
+	H2C bool
 }
 
 // 返回默认的服务配置
@@ -22,6 +56,11 @@ func defServerConfig() *ServerConfig {
 		Proxy:   defProxy(),
 		Host:    defHost(),
 		Port:    defPort(),
+
+		ShutdownTimeout:   defShutdownTimeout(),
+		ReadHeaderTimeout: defReadHeaderTimeout(),
+		IdleTimeout:       defIdleTimeout(),
+		MaxHeaderBytes:    defMaxHeaderBytes(),
 	}
 }
 
@@ -35,6 +74,15 @@ type LoggerConfig struct {
 
 type BeforeRun func(app *Application)
 
+// AfterStart 服务启动后需要执行的方法
+type AfterStart func(app *Application)
+
+// BeforeShutdown 服务关闭前需要执行的方法
+type BeforeShutdown func(app *Application)
+
+// AfterShutdown 服务关闭后需要执行的方法
+type AfterShutdown func(app *Application)
+
 // 返回默认的日志配置
 func defLoggerConfig() *LoggerConfig {
 	return &LoggerConfig{
@@ -61,6 +109,22 @@ func defPort() int {
 	return 9505
 }
 
+func defShutdownTimeout() time.Duration {
+	return 10 * time.Second
+}
+
+func defReadHeaderTimeout() time.Duration {
+	return 10 * time.Second
+}
+
+func defIdleTimeout() time.Duration {
+	return 120 * time.Second
+}
+
+func defMaxHeaderBytes() int {
+	return http.DefaultMaxHeaderBytes
+}
+
 func defLoggerPath() string {
 	path, _ := filepath.Abs(".")
 	return filepath.Join(path, "logs")
@@ -78,6 +142,86 @@ func defLoggerFormatJson() bool {
 	return true
 }
 
+// Option 定义创建app对象的选项
+type Option func(app *Application)
+
+// WithServerConfig 设置服务配置
+func WithServerConfig(serverConfig *ServerConfig) Option {
+	return func(app *Application) {
+		app.SetServerConfig(serverConfig)
+	}
+}
+
+// WithLoggerConfig 设置日志配置
+func WithLoggerConfig(loggerConfig *LoggerConfig) Option {
+	return func(app *Application) {
+		app.SetLoggerConfig(loggerConfig)
+	}
+}
+
+// WithOrmConfig 设置数据库配置
+func WithOrmConfig(ormConfig *OrmConfig) Option {
+	return func(app *Application) {
+		app.SetOrmConfig(ormConfig)
+	}
+}
+
+// WithRedisConfig 设置redis配置
+func WithRedisConfig(redisConfig *RedisConfig) Option {
+	return func(app *Application) {
+		app.SetRedisConfig(redisConfig)
+	}
+}
+
+// WithCorsConfig 设置跨域配置
+func WithCorsConfig(corsConfig *CorsConfig) Option {
+	return func(app *Application) {
+		app.SetCorsConfig(corsConfig)
+	}
+}
+
+// WithCurlConfig 设置httpclient配置
+func WithCurlConfig(curlConfig *CurlConfig) Option {
+	return func(app *Application) {
+		app.SetCurlConfig(curlConfig)
+	}
+}
+
+// WithCurlClientConfig 设置命名的httpclient配置
+func WithCurlClientConfig(name string, curlConfig *CurlConfig) Option {
+	return func(app *Application) {
+		app.SetCurlClientConfig(name, curlConfig)
+	}
+}
+
+// WithJwtConfig 设置JWT配置
+func WithJwtConfig(jwtConfig *JwtConfig) Option {
+	return func(app *Application) {
+		app.SetJwtConfig(jwtConfig)
+	}
+}
+
+// WithCookieConfig 设置cookie配置
+func WithCookieConfig(cookieConfig *CookieConfig) Option {
+	return func(app *Application) {
+		app.SetCookieConfig(cookieConfig)
+	}
+}
+
+// WithTemplateConfig 设置html模板配置
+func WithTemplateConfig(templateConfig *TemplateConfig) Option {
+	return func(app *Application) {
+		app.SetTemplateConfig(templateConfig)
+	}
+}
+
+// WithMetricsConfig 设置指标配置
+func WithMetricsConfig(metricsConfig *MetricsConfig) Option {
+	return func(app *Application) {
+		app.SetMetricsConfig(metricsConfig)
+	}
+}
+
 // Application 定义服务的APP
 type Application struct {
 	reqId        int64         // 请求ID，每次递增1，服务重启就从1开始计数
@@ -89,15 +233,96 @@ type Application struct {
 	corsConfig   *CorsConfig   // 跨域配置
 	curlConfig   *CurlConfig   // httpclient配置
 	jwtConfig    *JwtConfig    // JWT配置
+	cookieConfig *CookieConfig // cookie配置
 	Orm          *Orm          // 数据库ORM对象，用于数据库操作
 	Redis        *RedisClient  // redis对象，用户redis操作
 	Curl         *Curl         // httpclient对象，用于发送http请求，如get，post
 	Jwt          *Jwt          // JWT对象
 	beforeRuns   []BeforeRun   // 运行前需要执行的函数列表
+
+	router         *httprouter.Router   // 路由对象
+	routes         map[string][]string  // 已经注册的路由路径和请求方法
+	defRouterGroup *RouterGroup         // 默认的路由组
+	asyncTaskLock  sync.Mutex           // 互斥锁，用于异步任务池
+	asyncTaskPool  map[string]AsyncTask // 等待执行的异步任务池
+	timerLock      sync.Mutex           // 互斥锁，用于定时器池
+	timerPool      map[string]*timerJob // 运行中的定时器池
+	errorRenderer  ErrorRenderer        // 错误渲染方法
+	codecs         *codecRegistry       // 编解码器注册表
+	templateConfig *TemplateConfig      // html模板配置
+	templates      *templateEngine      // html模板引擎
+	metricsConfig  *MetricsConfig       // 指标配置
+	Metrics        *Metrics             // 指标对象，设置了指标配置时才有
+	corsGroups     []*RouterGroup       // 设置了跨域配置的路由组，服务启动时校验
+	chainVersion   atomic.Uint64        // 中间件的版本，路由组添加中间件时加1，路由缓存的中间件链随之失效
+
+	curlClientsLock   sync.Mutex             // 互斥锁，用于命名的httpclient
+	curlClientConfigs map[string]*CurlConfig // 命名的httpclient配置
+	curlClients       map[string]*Curl       // 已经创建的命名httpclient
+
+	afterStarts     []AfterStart     // 服务启动后需要执行的函数列表
+	beforeShutdowns []BeforeShutdown // 服务关闭前需要执行的函数列表
+	afterShutdowns  []AfterShutdown  // 服务关闭后需要执行的函数列表
+	serverLock      sync.Mutex       // 互斥锁，用于服务对象和启动关闭状态
+	server          *http.Server     // http服务对象
+	starting        chan struct{}    // Run初始化期间不为nil，设置好服务对象或者启动失败后关闭
+	shuttingDown    bool             // 是否已经开始关闭流程，开始关闭后Run不再启动服务
+	h2cRequests     activeRequests   // h2c连接上正在处理的请求，关闭服务时等待处理完成
+	tasks           sync.WaitGroup   // 正在执行的任务，关闭服务时等待任务执行完成
+	timerRuns       sync.WaitGroup   // 正在执行的定时器，关闭服务时等待执行完成
+	shutdownOnce    sync.Once        // 保证关闭流程只执行一次
+	shutdownDone    chan struct{}    // 关闭流程执行完成后关闭
+	shutdownErr     error            // 关闭流程的错误
+}
+
+// New 创建一个新的app对象，每个app对象有独立的路由、任务、定时器和配置
+func New(opts ...Option) *Application {
+	app := &Application{
+		serverConfig:  defServerConfig(),
+		loggerConfig:  defLoggerConfig(),
+		corsConfig:    defCorsConfig(),
+		curlConfig:    fillCurlConfig(nil),
+		cookieConfig:  defCookieConfig(),
+		beforeRuns:    make([]BeforeRun, 0),
+		router:        httprouter.New(),
+		routes:        make(map[string][]string),
+		asyncTaskPool: make(map[string]AsyncTask),
+		timerPool:     make(map[string]*timerJob),
+		codecs:        defCodecRegistry(),
+		shutdownDone:  make(chan struct{}),
+	}
+	app.router.PanicHandler = defaultErrorHandle()
+	app.router.NotFound = defaultNotFoundHandle()
+	app.defRouterGroup = app.NewRouterGroup()
+	for _, opt := range opts {
+		opt(app)
+	}
+	return app
 }
 
-// 启动服务
-func (app *Application) run() error {
+// ServeHTTP 实现http.Handler接口，可以直接用于httptest
+func (app *Application) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	app.router.ServeHTTP(w, r)
+}
+
+// Run 启动服务，收到SIGINT或SIGTERM信号后优雅关闭服务，已经调用过Shutdown时不再启动服务，返回http.ErrServerClosed
+func (app *Application) Run() error {
+	app.serverLock.Lock()
+	if app.shuttingDown {
+		app.serverLock.Unlock()
+		return http.ErrServerClosed
+	}
+	starting := make(chan struct{})
+	app.starting = starting
+	app.serverLock.Unlock()
+	var startOnce sync.Once
+	// 初始化结束，通知等待中的关闭流程
+	started := func() {
+		startOnce.Do(func() {
+			close(starting)
+		})
+	}
+	defer started()
 	app.Logger = getLogger(app, map[string]interface{}{
 		"appName":     app.serverConfig.AppName,
 		"proxy":       app.serverConfig.Proxy,
@@ -106,6 +331,10 @@ func (app *Application) run() error {
 		"loggerPath":  app.loggerConfig.LoggerPath,
 		"loggerLevel": app.loggerConfig.LoggerLevel,
 	})
+	// 校验跨域配置
+	if err := validateCorsConfigs(app); err != nil {
+		return err
+	}
 	// 初始化数据库
 	initDB(app)
 	// 初始化REDIS
@@ -114,61 +343,251 @@ func (app *Application) run() error {
 	initCurl(app)
 	// 初始化jwt
 	initJwt(app)
+	// 初始化模板
+	if err := initTemplate(app); err != nil {
+		return err
+	}
+	// 初始化指标
+	initMetrics(app)
 	for _, beforeRun := range app.beforeRuns {
 		beforeRun(app)
 	}
-	app.Logger.Info("server started")
-	return http.ListenAndServe(fmt.Sprintf("%s:%d", app.serverConfig.Host, app.serverConfig.Port), router)
+	tlsConfig, err := app.serverTLSConfig()
+	if err != nil {
+		return err
+	}
+	server, err := app.newServer(tlsConfig)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", fmt.Sprintf("%s:%d", app.serverConfig.Host, app.serverConfig.Port))
+	if err != nil {
+		return err
+	}
+	app.serverLock.Lock()
+	if app.shuttingDown {
+		// 初始化期间已经调用了Shutdown，不再启动服务
+		app.serverLock.Unlock()
+		_ = ln.Close()
+		started()
+		<-app.shutdownDone
+		return app.shutdownErr
+	}
+	app.server = server
+	app.serverLock.Unlock()
+	started()
+	serveErr := make(chan error, 1)
+	go func() {
+		if tlsConfig != nil {
+			// 证书已经在TLSConfig里，ServeTLS会自动开启HTTP/2
+			serveErr <- server.ServeTLS(ln, "", "")
+			return
+		}
+		serveErr <- server.Serve(ln)
+	}()
+	app.Logger.Info("server started", zap.Bool("tls", tlsConfig != nil), zap.Bool("h2c", tlsConfig == nil && app.serverConfig.H2C),
+		zap.Duration("readHeaderTimeout", app.serverConfig.ReadHeaderTimeout), zap.Duration("idleTimeout", app.serverConfig.IdleTimeout))
+	for _, afterStart := range app.afterStarts {
+		afterStart(app)
+	}
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+	select {
+	case err = <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		// 通过Shutdown关闭的服务，等待关闭流程执行完成
+		<-app.shutdownDone
+		return app.shutdownErr
+	case sig := <-quit:
+		app.Logger.Info("server shutting down", zap.String("signal", sig.String()))
+		ctx, cancel := context.WithTimeout(context.Background(), app.serverConfig.ShutdownTimeout)
+		defer cancel()
+		return app.Shutdown(ctx)
+	}
 }
 
-// 设置服务配置
-func (app *Application) setServerConfig(serverConfig *ServerConfig) *Application {
+// Shutdown 优雅关闭服务，只会执行一次，重复调用返回第一次关闭的结果
+func (app *Application) Shutdown(ctx context.Context) error {
+	app.shutdownOnce.Do(func() {
+		app.shutdownErr = app.doShutdown(ctx)
+		close(app.shutdownDone)
+	})
+	<-app.shutdownDone
+	return app.shutdownErr
+}
+
+// 执行关闭流程：停止接收新请求，等待正在处理的请求完成，停止定时器，等待任务完成，最后关闭redis和数据库连接
+func (app *Application) doShutdown(ctx context.Context) error {
+	var errs []error
+	app.serverLock.Lock()
+	app.shuttingDown = true
+	starting := app.starting
+	app.serverLock.Unlock()
+	if starting != nil {
+		// Run还在初始化，等待初始化结束后再关闭，避免关闭流程和初始化同时修改app
+		select {
+		case <-starting:
+		case <-ctx.Done():
+			return fmt.Errorf("wait server start: %w", ctx.Err())
+		}
+	}
+	app.serverLock.Lock()
+	server := app.server
+	app.serverLock.Unlock()
+	for _, beforeShutdown := range app.beforeShutdowns {
+		beforeShutdown(app)
+	}
+	if server != nil {
+		if err := server.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+		if err := app.h2cRequests.wait(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("wait h2c requests: %w", err))
+		}
+	}
+	app.stopAllTimers()
+	taskDone := make(chan struct{})
+	go func() {
+		app.timerRuns.Wait()
+		app.tasks.Wait()
+		close(taskDone)
+	}()
+	select {
+	case <-taskDone:
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("wait tasks: %w", ctx.Err()))
+	}
+	if app.Redis != nil {
+		if err := app.Redis.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if app.Orm != nil {
+		if err := app.Orm.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, afterShutdown := range app.afterShutdowns {
+		afterShutdown(app)
+	}
+	if app.Logger != nil {
+		app.Logger.Info("server stopped")
+		_ = app.Logger.Sync()
+	}
+	return errors.Join(errs...)
+}
+
+// SetServerConfig 设置服务配置
+func (app *Application) SetServerConfig(serverConfig *ServerConfig) *Application {
+	if serverConfig == nil {
+		serverConfig = defServerConfig()
+	}
+	if serverConfig.ShutdownTimeout <= 0 {
+		serverConfig.ShutdownTimeout = defShutdownTimeout()
+	}
+	if serverConfig.ReadHeaderTimeout <= 0 {
+		serverConfig.ReadHeaderTimeout = defReadHeaderTimeout()
+	}
+	if serverConfig.IdleTimeout <= 0 {
+		serverConfig.IdleTimeout = defIdleTimeout()
+	}
+	if serverConfig.MaxHeaderBytes <= 0 {
+		serverConfig.MaxHeaderBytes = defMaxHeaderBytes()
+	}
 	app.serverConfig = serverConfig
 	return app
 }
 
-// 设置日志服务
-func (app *Application) setLoggerConfig(loggerConfig *LoggerConfig) *Application {
+// SetLoggerConfig 设置日志配置
+func (app *Application) SetLoggerConfig(loggerConfig *LoggerConfig) *Application {
+	if loggerConfig == nil {
+		loggerConfig = defLoggerConfig()
+	}
 	app.loggerConfig = loggerConfig
 	return app
 }
 
-// 设置数据库配置
-func (app *Application) setOrmConfig(ormConfig *OrmConfig) *Application {
+// SetOrmConfig 设置数据库配置
+func (app *Application) SetOrmConfig(ormConfig *OrmConfig) *Application {
+	if ormConfig == nil {
+		ormConfig = defOrmConfig()
+	}
+	if ormConfig.Pool == nil {
+		ormConfig.Pool = defOrmPool()
+	}
 	app.ormConfig = ormConfig
 	return app
 }
 
-// 设置redis配置
-func (app *Application) setRedisConfig(redisConfig *RedisConfig) *Application {
+// SetRedisConfig 设置redis配置
+func (app *Application) SetRedisConfig(redisConfig *RedisConfig) *Application {
+	if redisConfig == nil {
+		redisConfig = defRedisConfig()
+	}
 	app.redisConfig = redisConfig
 	return app
 }
 
-// 设置跨域服务
-func (app *Application) setCorsConfig(corsConfig *CorsConfig) *Application {
-	app.corsConfig = corsConfig
+// SetCorsConfig 设置跨域配置，配置在服务启动时校验，不合法时Run返回错误
+func (app *Application) SetCorsConfig(corsConfig *CorsConfig) *Application {
+	app.corsConfig = fillCorsConfig(corsConfig)
 	return app
 }
 
-// 设置httpclient配置
-func (app *Application) setCurlConfig(curlConfig *CurlConfig) *Application {
-	app.curlConfig = curlConfig
+// SetCurlConfig 设置httpclient配置
+func (app *Application) SetCurlConfig(curlConfig *CurlConfig) *Application {
+	app.curlConfig = fillCurlConfig(curlConfig)
 	return app
 }
 
-// 设置JWT配置
-func (app *Application) setJwtConfig(jwtConfig *JwtConfig) *Application {
+// SetJwtConfig 设置JWT配置
+func (app *Application) SetJwtConfig(jwtConfig *JwtConfig) *Application {
+	if jwtConfig == nil {
+		jwtConfig = defJwtConfig()
+	}
+	if jwtConfig.Timeout <= 0 {
+		jwtConfig.Timeout = defJwtConfig().Timeout
+	}
+	if jwtConfig.RefreshTimeout <= 0 {
+		jwtConfig.RefreshTimeout = defJwtConfig().RefreshTimeout
+	}
+	if len(jwtConfig.Issuer) == 0 {
+		jwtConfig.Issuer = defJwtConfig().Issuer
+	}
+	if len(jwtConfig.JwksPath) == 0 {
+		jwtConfig.JwksPath = defJwtConfig().JwksPath
+	}
 	app.jwtConfig = jwtConfig
 	return app
 }
 
-// 添加运行前需要执行的方法
-func (app *Application) addBefore(b BeforeRun) *Application {
+// AddBefore 添加运行前需要执行的方法
+func (app *Application) AddBefore(b BeforeRun) *Application {
 	app.beforeRuns = append(app.beforeRuns, b)
 	return app
 }
 
+// AddAfterStart 添加服务启动后需要执行的方法
+func (app *Application) AddAfterStart(a AfterStart) *Application {
+	app.afterStarts = append(app.afterStarts, a)
+	return app
+}
+
+// AddBeforeShutdown 添加服务关闭前需要执行的方法
+func (app *Application) AddBeforeShutdown(b BeforeShutdown) *Application {
+	app.beforeShutdowns = append(app.beforeShutdowns, b)
+	return app
+}
+
+// AddAfterShutdown 添加服务关闭后需要执行的方法
+func (app *Application) AddAfterShutdown(a AfterShutdown) *Application {
+	app.afterShutdowns = append(app.afterShutdowns, a)
+	return app
+}
+
 // GetServerConfig 获取服务配置
 func (app *Application) GetServerConfig() *ServerConfig {
 	return app.serverConfig
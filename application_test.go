@@ -0,0 +1,242 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 获取一个空闲的本地端口
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// 在后台启动app，等待服务启动后返回Run的结果通道，测试结束时关闭服务
+func startTestApp(t *testing.T, app *Application) <-chan error {
+	t.Helper()
+	app.serverConfig.Host = "127.0.0.1"
+	app.serverConfig.Port = freePort(t)
+	started := make(chan struct{})
+	app.AddAfterStart(func(app *Application) {
+		close(started)
+	})
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- app.Run()
+	}()
+	select {
+	case <-started:
+	case err := <-runErr:
+		t.Fatalf("Run() error = %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server not started")
+	}
+	t.Cleanup(func() {
+		_ = app.Shutdown(context.Background())
+	})
+	return runErr
+}
+
+// 等待Run返回
+func waitRun(t *testing.T, runErr <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-runErr:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return")
+		return nil
+	}
+}
+
+// 测试用的定时器
+type testTimer struct {
+	name     string
+	interval time.Duration
+	run      func()
+}
+
+func (tt *testTimer) GetName() string            { return tt.name }
+func (tt *testTimer) Run(app *Application)       { tt.run() }
+func (tt *testTimer) GetInterval() time.Duration { return tt.interval }
+func (tt *testTimer) IsPeriodic() bool           { return true }
+func (tt *testTimer) IsImmediately() bool        { return true }
+
+func TestLifecycleHookOrder(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	record := func(event string) func(app *Application) {
+		return func(app *Application) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, event)
+		}
+	}
+	app := newTestApp(t)
+	app.AddBefore(record("beforeRun")).AddAfterStart(record("afterStart")).
+		AddBeforeShutdown(record("beforeShutdown")).AddAfterShutdown(record("afterShutdown"))
+	runErr := startTestApp(t, app)
+	if err := app.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if err := waitRun(t, runErr); err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+	want := []string{"beforeRun", "afterStart", "beforeShutdown", "afterShutdown"}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != len(want) {
+		t.Fatalf("events = %v, want %v", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Fatalf("events = %v, want %v", events, want)
+		}
+	}
+}
+
+func TestShutdownIdempotent(t *testing.T) {
+	tests := []struct {
+		name string
+		run  bool // 是否先启动服务
+	}{
+		{"running server", true},
+		{"without server", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var before, after int32
+			app := newTestApp(t)
+			app.AddBeforeShutdown(func(app *Application) {
+				atomic.AddInt32(&before, 1)
+			}).AddAfterShutdown(func(app *Application) {
+				atomic.AddInt32(&after, 1)
+			})
+			var runErr <-chan error
+			if tt.run {
+				runErr = startTestApp(t, app)
+			}
+			var wg sync.WaitGroup
+			for i := 0; i < 5; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if err := app.Shutdown(context.Background()); err != nil {
+						t.Errorf("Shutdown() error = %v", err)
+					}
+				}()
+			}
+			wg.Wait()
+			if err := app.Shutdown(context.Background()); err != nil {
+				t.Errorf("Shutdown() again error = %v", err)
+			}
+			if before != 1 || after != 1 {
+				t.Errorf("hooks called %d/%d times, want 1/1", before, after)
+			}
+			if tt.run {
+				if err := waitRun(t, runErr); err != nil {
+					t.Errorf("Run() error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestShutdownStopsTimers(t *testing.T) {
+	app := newTestApp(t)
+	var runs, running int32
+	app.StartTimer(&testTimer{name: "tick", interval: 5 * time.Millisecond, run: func() {
+		atomic.AddInt32(&running, 1)
+		atomic.AddInt32(&runs, 1)
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+	}})
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&runs) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if err := app.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	// 关闭时等待正在执行的定时器完成
+	if n := atomic.LoadInt32(&running); n != 0 {
+		t.Errorf("running timers after Shutdown = %d, want 0", n)
+	}
+	stopped := atomic.LoadInt32(&runs)
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&runs); n != stopped {
+		t.Errorf("timer ran %d times after Shutdown", n-stopped)
+	}
+	app.timerLock.Lock()
+	defer app.timerLock.Unlock()
+	if len(app.timerPool) != 0 {
+		t.Errorf("timerPool = %v, want empty", app.timerPool)
+	}
+}
+
+func TestRunAfterShutdown(t *testing.T) {
+	app := newTestApp(t)
+	var beforeRun bool
+	app.AddBefore(func(app *Application) {
+		beforeRun = true
+	})
+	if err := app.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if err := app.Run(); !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("Run() error = %v, want http.ErrServerClosed", err)
+	}
+	if beforeRun {
+		t.Error("Run() initialized the app after Shutdown")
+	}
+}
+
+func TestShutdownDuringRunStart(t *testing.T) {
+	app := newTestApp(t)
+	app.serverConfig.Host = "127.0.0.1"
+	app.serverConfig.Port = freePort(t)
+	var afterStart bool
+	shutdownErr := make(chan error, 1)
+	app.AddBefore(func(app *Application) {
+		// 初始化期间调用Shutdown，等待关闭流程开始后再继续启动
+		go func() {
+			shutdownErr <- app.Shutdown(context.Background())
+		}()
+		for {
+			app.serverLock.Lock()
+			shuttingDown := app.shuttingDown
+			app.serverLock.Unlock()
+			if shuttingDown {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}).AddAfterStart(func(app *Application) {
+		afterStart = true
+	})
+	if err := app.Run(); err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+	if err := <-shutdownErr; err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+	if afterStart {
+		t.Error("server started after Shutdown")
+	}
+	if conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(app.serverConfig.Port))); err == nil {
+		conn.Close()
+		t.Error("server is listening after Shutdown")
+	}
+}
@@ -0,0 +1,250 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/funswe/flow/utils/json"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// BindQuery 只使用query参数填充结构体，字段使用query标签，如query:"page"
+func (c *Context) BindQuery(object interface{}) error {
+	query := c.req.getQuery()
+	return bindValues(object, "query", func(name string) ([]string, bool) {
+		values, ok := query[name]
+		return values, ok
+	})
+}
+
+// BindForm 只使用请求实体里的form参数填充结构体，包括multipart/form-data，字段使用form标签，如form:"name"
+func (c *Context) BindForm(object interface{}) error {
+	if err := c.parseForm(); err != nil {
+		return asBodyError(err, "invalid form body")
+	}
+	r := c.req.req
+	return bindValues(object, "form", func(name string) ([]string, bool) {
+		values, ok := r.PostForm[name]
+		return values, ok
+	})
+}
+
+// BindHeader 只使用请求头填充结构体，字段使用header标签，如header:"X-Request-Id"
+func (c *Context) BindHeader(object interface{}) error {
+	header := c.req.req.Header
+	return bindValues(object, "header", func(name string) ([]string, bool) {
+		values := header.Values(name)
+		return values, len(values) > 0
+	})
+}
+
+// BindURI 只使用路由参数填充结构体，字段使用uri标签，如uri:"id"
+func (c *Context) BindURI(object interface{}) error {
+	return bindValues(object, "uri", func(name string) ([]string, bool) {
+		for _, p := range c.uriParams {
+			if p.Key == name {
+				return []string{p.Value}, true
+			}
+		}
+		return nil, false
+	})
+}
+
+// BindJSON 只使用json请求实体填充结构体，字段使用json标签
+func (c *Context) BindJSON(object interface{}) error {
+	body, err := c.GetRawBody()
+	if err != nil {
+		return err
+	}
+	if len(body) == 0 {
+		return NewHTTPError(http.StatusBadRequest, 0, "empty json body")
+	}
+	if err = json.Unmarshal(body, object); err != nil {
+		return NewHTTPError(http.StatusBadRequest, 0, "invalid json body").WithError(err)
+	}
+	return Validate(object)
+}
+
+// 使用给定的参数来源填充结构体，字段的值直接转换类型，填充完成后根据flow标签校验，类型转换错误和校验错误一起返回
+func bindValues(object interface{}, tag string, lookup func(name string) ([]string, bool)) error {
+	v := reflect.ValueOf(object)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errors.New("object must be a non-nil pointer to struct")
+	}
+	var errs FieldValidateErrors
+	bindStruct(v.Elem(), tag, lookup, &errs)
+	if err := validateObject(object, tag); err != nil {
+		var ves FieldValidateErrors
+		if !errors.As(err, &ves) {
+			return err
+		}
+		errs = append(errs, withoutTypeErrorParams(ves, errs)...)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// 去掉已经有类型转换错误的参数的校验错误，转换失败的字段是零值，不再返回其他规则的错误
+func withoutTypeErrorParams(ves, typeErrs FieldValidateErrors) FieldValidateErrors {
+	if len(typeErrs) == 0 {
+		return ves
+	}
+	params := make(map[string]bool, len(typeErrs))
+	for _, e := range typeErrs {
+		params[e.Param] = true
+	}
+	result := make(FieldValidateErrors, 0, len(ves))
+	for _, e := range ves {
+		if !params[e.Param] {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// 填充结构体的字段，没有标签的嵌套结构体会继续填充
+func bindStruct(v reflect.Value, tag string, lookup func(name string) ([]string, bool), errs *FieldValidateErrors) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+		name := strings.Split(field.Tag.Get(tag), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if len(name) == 0 {
+			if fv.Kind() == reflect.Struct && fv.Type() != timeType {
+				bindStruct(fv, tag, lookup, errs)
+			}
+			continue
+		}
+		values, ok := lookup(name)
+		if !ok || len(values) == 0 {
+			continue
+		}
+		if err := setFieldValues(fv, values); err != nil {
+			*errs = append(*errs, &FieldValidateError{
+				Type:  "type",
+				Value: strings.Join(values, ","),
+				Field: field.Name,
+				Param: name,
+				Arg:   typeName(fv.Type()),
+			})
+		}
+	}
+}
+
+// 设置字段的值，数组字段使用所有的值，其他字段使用第一个值
+func setFieldValues(fv reflect.Value, values []string) error {
+	if fv.Kind() == reflect.Ptr {
+		ptr := reflect.New(fv.Type().Elem())
+		if err := setFieldValues(ptr.Elem(), values); err != nil {
+			return err
+		}
+		fv.Set(ptr)
+		return nil
+	}
+	if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+		slice := reflect.MakeSlice(fv.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setFieldValues(slice.Index(i), []string{value}); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	}
+	return setFieldValue(fv, values[0])
+}
+
+// 将字符串转换成字段的类型并设置字段的值
+func setFieldValue(fv reflect.Value, value string) error {
+	switch fv.Type() {
+	case timeType:
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(t))
+		return nil
+	case durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Bool:
+		if len(value) == 0 {
+			fv.SetBool(false)
+			return nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if len(value) == 0 {
+			return nil
+		}
+		n, err := strconv.ParseInt(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if len(value) == 0 {
+			return nil
+		}
+		n, err := strconv.ParseUint(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		if len(value) == 0 {
+			return nil
+		}
+		n, err := strconv.ParseFloat(value, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(n)
+	case reflect.Slice:
+		// []byte
+		fv.SetBytes([]byte(value))
+	default:
+		return fmt.Errorf("unsupported type %s", fv.Type())
+	}
+	return nil
+}
+
+// 返回类型的名称，用于类型转换失败的错误信息
+func typeName(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return "time"
+	case durationType:
+		return "duration"
+	}
+	return t.Kind().String()
+}
@@ -0,0 +1,318 @@
+package flow
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type bindQuery struct {
+	Page    int           `query:"page" flow:"gte:1"`
+	Size    *int          `query:"size"`
+	Tags    []string      `query:"tag"`
+	Active  bool          `query:"active"`
+	Since   time.Time     `query:"since"`
+	Timeout time.Duration `query:"timeout"`
+	Ignored string        `query:"-"`
+}
+
+func TestBindQuery(t *testing.T) {
+	size := 20
+	since, _ := time.Parse(time.RFC3339, "2024-01-02T03:04:05Z")
+	tests := []struct {
+		name    string
+		query   string
+		want    bindQuery
+		errType string // 期望的校验错误类型，为空时期望没有错误
+	}{
+		{"empty", "", bindQuery{}, "gte"},
+		{"all fields", "page=2&size=20&tag=a&tag=b&active=true&since=2024-01-02T03:04:05Z&timeout=1m30s&Ignored=x",
+			bindQuery{Page: 2, Size: &size, Tags: []string{"a", "b"}, Active: true, Since: since, Timeout: 90 * time.Second}, ""},
+		{"empty number is zero", "page=1&size=", bindQuery{Page: 1, Size: new(int)}, ""},
+		{"invalid int", "page=x", bindQuery{}, "type"},
+		{"invalid bool", "page=1&active=maybe", bindQuery{Page: 1}, "type"},
+		{"invalid time", "page=1&since=yesterday", bindQuery{Page: 1}, "type"},
+		{"validation", "page=0", bindQuery{}, "gte"},
+	}
+	app := newTestApp(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestContext(t, app, httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil))
+			var got bindQuery
+			err := c.BindQuery(&got)
+			checkBindError(t, err, tt.errType)
+			if tt.errType == "" && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BindQuery() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBindCollectsAllErrors(t *testing.T) {
+	type params struct {
+		Page   int    `query:"page" flow:"gte:1"`
+		Size   int    `query:"size" flow:"lte:100"`
+		Active bool   `query:"active"`
+		Name   string `query:"name" flow:"required"`
+	}
+	tests := []struct {
+		name   string
+		query  string
+		params []string // 期望的所有错误的参数名
+		types  []string // 期望的所有错误的类型
+	}{
+		{"type errors and validation errors", "page=x&size=1000&active=maybe", []string{"page", "active", "size", "name"}, []string{"type", "type", "lte", "required"}},
+		{"only type errors", "page=x&size=y&name=bob", []string{"page", "size"}, []string{"type", "type"}},
+		{"only validation errors", "page=0&size=1000&name=bob", []string{"page", "size"}, []string{"gte", "lte"}},
+	}
+	app := newTestApp(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestContext(t, app, httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil))
+			var p params
+			var errs FieldValidateErrors
+			if err := c.BindQuery(&p); !errors.As(err, &errs) {
+				t.Fatalf("BindQuery() error = %v, want FieldValidateErrors", err)
+			}
+			var gotParams, gotTypes []string
+			for _, e := range errs {
+				gotParams = append(gotParams, e.Param)
+				gotTypes = append(gotTypes, e.Type)
+			}
+			if !reflect.DeepEqual(gotParams, tt.params) || !reflect.DeepEqual(gotTypes, tt.types) {
+				t.Errorf("errors = %v %v, want %v %v", gotParams, gotTypes, tt.params, tt.types)
+			}
+		})
+	}
+}
+
+func TestBindForm(t *testing.T) {
+	type login struct {
+		User     string `form:"user" flow:"required"`
+		Password string `form:"password" flow:"min:6"`
+	}
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        login
+		errType     string
+		status      int // 期望的HTTPError状态码
+	}{
+		{"urlencoded", "application/x-www-form-urlencoded", "user=bob&password=secret", login{"bob", "secret"}, "", 0},
+		{"multipart", "multipart/form-data; boundary=X",
+			"--X\r\nContent-Disposition: form-data; name=\"user\"\r\n\r\nbob\r\n--X\r\nContent-Disposition: form-data; name=\"password\"\r\n\r\nsecret\r\n--X--\r\n",
+			login{"bob", "secret"}, "", 0},
+		{"query is not used", "application/x-www-form-urlencoded", "password=secret", login{}, "required", 0},
+		{"validation", "application/x-www-form-urlencoded", "user=bob&password=123", login{}, "min", 0},
+		{"invalid multipart", "multipart/form-data; boundary=X", "garbage", login{}, "", http.StatusBadRequest},
+	}
+	app := newTestApp(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/?user=query", strings.NewReader(tt.body))
+			r.Header.Set(HttpHeaderContentType, tt.contentType)
+			c, _ := newTestContext(t, app, r)
+			var got login
+			err := c.BindForm(&got)
+			if tt.status != 0 {
+				checkHTTPError(t, err, tt.status)
+				return
+			}
+			checkBindError(t, err, tt.errType)
+			if tt.errType == "" && got != tt.want {
+				t.Errorf("BindForm() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBindHeaderAndURI(t *testing.T) {
+	type headers struct {
+		RequestId string `header:"X-Request-Id"`
+		Retries   []int  `header:"X-Retry"`
+	}
+	type uri struct {
+		Id   int64  `uri:"id" flow:"gt:0"`
+		Slug string `uri:"slug"`
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("x-request-id", "abc")
+	r.Header.Add("X-Retry", "1")
+	r.Header.Add("X-Retry", "2")
+	app := newTestApp(t)
+	c, _ := newTestContext(t, app, r, httprouter.Param{Key: "id", Value: "42"}, httprouter.Param{Key: "slug", Value: "hello"})
+	var h headers
+	if err := c.BindHeader(&h); err != nil {
+		t.Fatalf("BindHeader() error = %v", err)
+	}
+	if h.RequestId != "abc" || !reflect.DeepEqual(h.Retries, []int{1, 2}) {
+		t.Errorf("BindHeader() = %+v", h)
+	}
+	var u uri
+	if err := c.BindURI(&u); err != nil {
+		t.Fatalf("BindURI() error = %v", err)
+	}
+	if u.Id != 42 || u.Slug != "hello" {
+		t.Errorf("BindURI() = %+v", u)
+	}
+
+	c, _ = newTestContext(t, app, r, httprouter.Param{Key: "id", Value: "abc"})
+	checkBindError(t, c.BindURI(&uri{}), "type")
+	c, _ = newTestContext(t, app, r, httprouter.Param{Key: "id", Value: "0"})
+	checkBindError(t, c.BindURI(&uri{}), "gt")
+}
+
+func TestBindJSON(t *testing.T) {
+	type user struct {
+		Name string `json:"name" flow:"required"`
+		Age  int    `json:"age"`
+	}
+	tests := []struct {
+		name    string
+		body    string
+		want    user
+		errType string
+		status  int
+	}{
+		{"valid", `{"name":"bob","age":3}`, user{"bob", 3}, "", 0},
+		{"empty body", ``, user{}, "", http.StatusBadRequest},
+		{"invalid json", `{"name":`, user{}, "", http.StatusBadRequest},
+		{"validation", `{"age":3}`, user{}, "required", 0},
+	}
+	app := newTestApp(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			r.Header.Set(HttpHeaderContentType, "application/json")
+			c, _ := newTestContext(t, app, r)
+			var got user
+			err := c.BindJSON(&got)
+			if tt.status != 0 {
+				checkHTTPError(t, err, tt.status)
+				return
+			}
+			checkBindError(t, err, tt.errType)
+			if tt.errType == "" && got != tt.want {
+				t.Errorf("BindJSON() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+type parseBase struct {
+	Id int64 `json:"id"`
+}
+
+type parseParams struct {
+	parseBase
+	Name    string        `json:"name" flow:"required"`
+	Age     int           `json:"age"`
+	Count   int           `json:"count" flow:"required"`
+	Active  bool          `json:"active"`
+	Timeout time.Duration `json:"timeout"`
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		body        string
+		want        parseParams
+		errTypes    []string // 期望的所有校验错误类型，为空时期望没有错误
+		contentType string
+	}{
+		{"query strings converted", "/?name=bob&age=18&count=2&active=true&timeout=1s&id=7", "",
+			parseParams{parseBase: parseBase{Id: 7}, Name: "bob", Age: 18, Count: 2, Active: true, Timeout: time.Second}, nil, ""},
+		{"json body", "/", `{"name":"bob","age":18,"count":2}`, parseParams{Name: "bob", Age: 18, Count: 2}, nil, "application/json"},
+		{"json string number", "/", `{"name":"bob","age":"18","count":2}`, parseParams{Name: "bob", Age: 18, Count: 2}, nil, "application/json"},
+		{"invalid query int", "/?name=bob&age=x&count=2", "", parseParams{}, []string{"type"}, ""},
+		{"invalid json type", "/", `{"name":"bob","age":true,"count":2}`, parseParams{}, []string{"type"}, "application/json"},
+		{"type and validation errors together", "/?age=x&active=maybe", "", parseParams{}, []string{"type", "type", "required", "required"}, ""},
+		{"type error replaces validation error", "/?name=bob&count=x", "", parseParams{}, []string{"type"}, ""},
+		// 第一层字段和嵌套字段的required规则一致，零值也是空值
+		{"required zero value", "/?name=bob&count=0", "", parseParams{}, []string{"required"}, ""},
+		{"required empty string", "/?name=&count=1", "", parseParams{}, []string{"required"}, ""},
+	}
+	app := newTestApp(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			if len(tt.contentType) > 0 {
+				r.Header.Set(HttpHeaderContentType, tt.contentType)
+			}
+			c, _ := newTestContext(t, app, r)
+			var got parseParams
+			err := c.Parse(&got)
+			if len(tt.errTypes) == 0 {
+				if err != nil {
+					t.Fatalf("Parse() error = %v", err)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+				}
+				return
+			}
+			var errs FieldValidateErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("Parse() error = %v, want FieldValidateErrors", err)
+			}
+			types := make([]string, 0, len(errs))
+			for _, e := range errs {
+				types = append(types, e.Type)
+			}
+			if !reflect.DeepEqual(types, tt.errTypes) {
+				t.Errorf("error types = %v, want %v", types, tt.errTypes)
+			}
+			// 类型错误和校验错误都返回400
+			checkHTTPError(t, AsHTTPError(err), http.StatusBadRequest)
+		})
+	}
+}
+
+func TestBindRejectsNonStructPointer(t *testing.T) {
+	app := newTestApp(t)
+	c, _ := newTestContext(t, app, httptest.NewRequest(http.MethodGet, "/?a=1", nil))
+	var s struct{}
+	for _, object := range []interface{}{nil, s, new(string)} {
+		if err := c.BindQuery(object); err == nil {
+			t.Errorf("BindQuery(%T) error = nil, want error", object)
+		}
+	}
+}
+
+// 检查绑定的错误，errType为空时期望没有错误，否则期望第一个字段错误的类型是errType
+func checkBindError(t *testing.T, err error, errType string) {
+	t.Helper()
+	if errType == "" {
+		if err != nil {
+			t.Fatalf("error = %v, want nil", err)
+		}
+		return
+	}
+	var fe *FieldValidateError
+	if !errors.As(err, &fe) {
+		t.Fatalf("error = %v, want FieldValidateError %s", err, errType)
+	}
+	if fe.Type != errType {
+		t.Fatalf("error type = %s, want %s", fe.Type, errType)
+	}
+}
+
+// 检查错误是不是给定状态码的HTTPError
+func checkHTTPError(t *testing.T, err error, status int) {
+	t.Helper()
+	var httpError *HTTPError
+	if !errors.As(err, &httpError) {
+		t.Fatalf("error = %v, want HTTPError %d", err, status)
+	}
+	if httpError.Status != status {
+		t.Fatalf("error status = %d, want %d", httpError.Status, status)
+	}
+}
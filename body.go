@@ -0,0 +1,184 @@
+package flow
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ErrBodyConsumed 请求实体已经通过BodyReader读取，不能再获取
+var ErrBodyConsumed = errors.New("request body has been consumed by BodyReader")
+
+// 定义请求实体的读取状态，请求实体在第一次获取时才读取
+type requestBody struct {
+	maxSize      int64 // 请求实体的最大长度，0表示不限制
+	limited      bool  // 是否已经设置了长度限制
+	read         bool  // 是否已经读取到rawBody
+	streamed     bool  // 是否已经通过BodyReader读取
+	formParsed   bool  // 是否已经解析了form参数
+	formErr      error // 解析form参数的错误
+	paramsLoaded bool  // 是否已经加载了请求参数
+	paramsErr    error // 加载请求参数时读取请求实体的错误
+}
+
+// 参数方法读取请求实体失败时的panic值，路由处理方法recover后直接交给错误渲染方法处理
+type paramsPanic struct {
+	err error
+}
+
+// MaxBodySize 返回限制请求实体长度的中间件，可以作用于路由组或者单个路由，后设置的覆盖先设置的，超过限制返回413
+func MaxBodySize(n int64) Middleware {
+	return func(ctx *Context, next Next) {
+		if !ctx.body.limited {
+			ctx.body.maxSize = n
+		}
+		next()
+	}
+}
+
+// 设置请求实体的长度限制，只在第一次读取请求实体前生效
+func (c *Context) limitBody() {
+	if c.body.limited || c.req == nil {
+		return
+	}
+	c.body.limited = true
+	r := c.req.req
+	if c.body.maxSize > 0 && r.Body != nil {
+		r.Body = http.MaxBytesReader(c.res.res, r.Body, c.body.maxSize)
+	}
+}
+
+// 判断请求头里声明的实体长度是否超过限制
+func (c *Context) bodyTooLarge() bool {
+	return c.req != nil && c.body.maxSize > 0 && c.req.req.ContentLength > c.body.maxSize
+}
+
+// 返回请求实体超过长度限制的错误
+func (c *Context) bodyTooLargeError(err error) *HTTPError {
+	return NewHTTPError(http.StatusRequestEntityTooLarge, 0,
+		fmt.Sprintf("request body too large, limit %d bytes", c.body.maxSize)).WithError(err)
+}
+
+// 读取请求实体到rawBody，只会读取一次
+func (c *Context) readBody() {
+	if c.body.read || c.req == nil {
+		return
+	}
+	c.body.read = true
+	if c.body.streamed {
+		c.rawBodyErr = ErrBodyConsumed
+		return
+	}
+	c.limitBody()
+	r := c.req.req
+	if r.Body == nil {
+		return
+	}
+	c.rawBody, c.rawBodyErr = io.ReadAll(r.Body)
+	var maxBytesError *http.MaxBytesError
+	if errors.As(c.rawBodyErr, &maxBytesError) {
+		c.rawBodyErr = c.bodyTooLargeError(c.rawBodyErr)
+	}
+}
+
+// BodyReader 返回请求实体的reader，用于流式读取大的请求实体，调用后不能再通过GetRawBody和参数方法获取请求实体
+func (c *Context) BodyReader() io.Reader {
+	if c.req == nil || c.req.req.Body == nil {
+		return http.NoBody
+	}
+	if c.body.read {
+		return bytes.NewReader(c.rawBody)
+	}
+	c.limitBody()
+	c.body.streamed = true
+	return c.req.req.Body
+}
+
+// 解析form参数，multipart/form-data请求会同时解析上传的文件
+func (c *Context) parseForm() error {
+	if c.body.formParsed || c.req == nil {
+		return c.body.formErr
+	}
+	c.body.formParsed = true
+	r := c.req.req
+	if c.body.streamed || c.body.read {
+		// 请求实体已经被读取，只能解析query参数
+		r.Form = r.URL.Query()
+		r.PostForm = make(map[string][]string)
+		return nil
+	}
+	c.limitBody()
+	if strings.HasPrefix(c.req.getHeader(HttpHeaderContentType), "multipart/form-data") {
+		c.body.formErr = r.ParseMultipartForm(defaultMultipartMemory)
+	} else {
+		c.body.formErr = r.ParseForm()
+	}
+	var maxBytesError *http.MaxBytesError
+	if errors.As(c.body.formErr, &maxBytesError) {
+		c.body.formErr = c.bodyTooLargeError(c.body.formErr)
+	}
+	return c.body.formErr
+}
+
+// 获取请求的参数，读取请求实体失败时panic，由路由处理方法返回对应的错误，如超过长度限制返回413
+func (c *Context) getParams() map[string]interface{} {
+	if err := c.loadParams(); err != nil {
+		panic(paramsPanic{err: err})
+	}
+	return c.params
+}
+
+// 加载请求的参数，第一次调用时解析路由参数、form参数和请求实体，返回读取请求实体的错误
+func (c *Context) loadParams() error {
+	if c.body.paramsLoaded {
+		return c.body.paramsErr
+	}
+	c.body.paramsLoaded = true
+	c.params = make(map[string]interface{})
+	if c.req == nil {
+		return nil
+	}
+	for i := range c.uriParams {
+		c.params[c.uriParams[i].Key] = c.uriParams[i].Value
+	}
+	r := c.req.req
+	if err := c.parseForm(); err != nil {
+		c.body.paramsErr = asBodyError(err, "invalid form body")
+		return c.body.paramsErr
+	}
+	for k := range r.Form {
+		c.params[k] = r.Form.Get(k)
+	}
+	// 如果是json，yaml，msgpack等可以解析成map的请求实体，解析后合并到参数里，如果form参数和请求实体的参数相同，请求实体的参数覆盖form参数
+	codec, ok := c.app.codecs.get(c.req.getHeader(HttpHeaderContentType))
+	if !ok || c.body.streamed {
+		return nil
+	}
+	rawBody, err := c.GetRawBody()
+	if err != nil {
+		c.body.paramsErr = asBodyError(err, "read request body failed")
+		return c.body.paramsErr
+	}
+	if len(rawBody) == 0 {
+		return nil
+	}
+	bodyMap := make(map[string]interface{})
+	if codec.Unmarshal(rawBody, &bodyMap) == nil {
+		for k := range bodyMap {
+			c.params[k] = bodyMap[k]
+		}
+	}
+	return nil
+}
+
+// 将读取请求实体的错误转换成HTTPError，超过长度限制的已经是413，其他的返回400
+func asBodyError(err error, message string) error {
+	var httpError *HTTPError
+	if errors.As(err, &httpError) {
+		return err
+	}
+	return NewHTTPError(http.StatusBadRequest, 0, message).WithError(err)
+}
@@ -0,0 +1,166 @@
+package flow
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// 没有Content-Length的请求实体，模拟chunked请求
+type chunkedReader struct {
+	io.Reader
+}
+
+func TestMaxBodySize(t *testing.T) {
+	type params struct {
+		Name string `json:"name" flow:"required"`
+	}
+	app := newTestApp(t)
+	app.POST("/parse", func(ctx *Context) {
+		var p params
+		if err := ctx.Parse(&p); err != nil {
+			ctx.Error(err)
+			return
+		}
+		ctx.Text(p.Name)
+	}, MaxBodySize(16))
+	app.POST("/param", func(ctx *Context) {
+		ctx.Text(ctx.GetStringParam("name"))
+	}, MaxBodySize(16))
+	app.POST("/raw", func(ctx *Context) {
+		body, err := ctx.GetRawBody()
+		if err != nil {
+			ctx.Error(err)
+			return
+		}
+		ctx.Text(string(body))
+	}, MaxBodySize(16))
+	app.POST("/bind", func(ctx *Context) {
+		var p params
+		if err := ctx.BindJSON(&p); err != nil {
+			ctx.Error(err)
+			return
+		}
+		ctx.Text(p.Name)
+	}, MaxBodySize(16))
+	app.POST("/form", func(ctx *Context) {
+		var p struct {
+			Name string `form:"name"`
+		}
+		if err := ctx.BindForm(&p); err != nil {
+			ctx.Error(err)
+			return
+		}
+		ctx.Text(p.Name)
+	}, MaxBodySize(16))
+	// 路由的限制覆盖路由组的限制
+	app.Group("/big", MaxBodySize(4)).POST("/raw", func(ctx *Context) {
+		body, _ := ctx.GetRawBody()
+		ctx.Text(string(body))
+	}, MaxBodySize(64))
+
+	const small = `{"name":"bob"}`
+	const large = `{"name":"aaaaaaaaaaaaaaaaaaaaaaaa"}`
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		chunked     bool
+		status      int
+		want        string
+	}{
+		{"parse small", "/parse", "application/json", small, false, http.StatusOK, "bob"},
+		{"parse declared length", "/parse", "application/json", large, false, http.StatusRequestEntityTooLarge, ""},
+		{"parse chunked", "/parse", "application/json", large, true, http.StatusRequestEntityTooLarge, ""},
+		{"parse chunked form", "/parse", "application/x-www-form-urlencoded", "name=aaaaaaaaaaaaaaaaaaaa", true, http.StatusRequestEntityTooLarge, ""},
+		{"param small chunked", "/param", "application/json", small, true, http.StatusOK, "bob"},
+		{"param chunked", "/param", "application/json", large, true, http.StatusRequestEntityTooLarge, ""},
+		{"raw chunked", "/raw", "text/plain", large, true, http.StatusRequestEntityTooLarge, ""},
+		{"bind chunked", "/bind", "application/json", large, true, http.StatusRequestEntityTooLarge, ""},
+		{"form chunked", "/form", "application/x-www-form-urlencoded", "name=aaaaaaaaaaaaaaaaaaaa", true, http.StatusRequestEntityTooLarge, ""},
+		{"route overrides group", "/big/raw", "text/plain", large, true, http.StatusOK, large},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader = strings.NewReader(tt.body)
+			if tt.chunked {
+				body = chunkedReader{body}
+			}
+			r := httptest.NewRequest(http.MethodPost, tt.path, body)
+			r.Header.Set(HttpHeaderContentType, tt.contentType)
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.status == http.StatusOK && w.Body.String() != tt.want {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestServerMaxBodySize(t *testing.T) {
+	serverConfig := defServerConfig()
+	serverConfig.MaxBodySize = 8
+	app := newTestApp(t, WithServerConfig(serverConfig))
+	app.POST("/raw", func(ctx *Context) {
+		body, err := ctx.GetRawBody()
+		if err != nil {
+			ctx.Error(err)
+			return
+		}
+		ctx.Text(string(body))
+	})
+	if w := serve(app, http.MethodPost, "/raw", strings.NewReader("12345678")); w.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", w.Code)
+	}
+	if w := serve(app, http.MethodPost, "/raw", chunkedReader{strings.NewReader("123456789")}); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413", w.Code)
+	}
+}
+
+func TestBodyReader(t *testing.T) {
+	app := newTestApp(t)
+	tests := []struct {
+		name string
+		read func(ctx *Context) (string, error)
+		want string
+		err  error
+	}{
+		{"stream", func(ctx *Context) (string, error) {
+			b, err := io.ReadAll(ctx.BodyReader())
+			return string(b), err
+		}, "hello", nil},
+		{"raw body after stream", func(ctx *Context) (string, error) {
+			_, _ = io.ReadAll(ctx.BodyReader())
+			b, err := ctx.GetRawBody()
+			return string(b), err
+		}, "", ErrBodyConsumed},
+		{"stream after raw body", func(ctx *Context) (string, error) {
+			_, _ = ctx.GetRawBody()
+			b, err := io.ReadAll(ctx.BodyReader())
+			return string(b), err
+		}, "hello", nil},
+		{"raw body is cached", func(ctx *Context) (string, error) {
+			_, _ = ctx.GetRawBody()
+			return ctx.GetRawStringBody()
+		}, "hello", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestContext(t, app, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("hello")))
+			got, err := tt.read(c)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
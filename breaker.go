@@ -0,0 +1,157 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrCircuitOpen 熔断器打开，请求没有发送
+var ErrCircuitOpen = errors.New("curl circuit breaker is open")
+
+// CurlBreakerConfig 定义按域名熔断的配置
+type CurlBreakerConfig struct {
+	FailureThreshold int           // 连续失败多少次后熔断，网络错误和5xx状态码算失败，默认值5
+	OpenTimeout      time.Duration // 熔断后多久进入半开状态，默认值30秒
+	HalfOpenRequests int           // 半开状态允许同时发送的探测请求数，探测成功后恢复，失败后重新熔断，默认值1
+}
+
+// 填充熔断配置的默认值
+func fillCurlBreakerConfig(breakerConfig *CurlBreakerConfig) *CurlBreakerConfig {
+	if breakerConfig == nil {
+		return nil
+	}
+	if breakerConfig.FailureThreshold <= 0 {
+		breakerConfig.FailureThreshold = 5
+	}
+	if breakerConfig.OpenTimeout <= 0 {
+		breakerConfig.OpenTimeout = 30 * time.Second
+	}
+	if breakerConfig.HalfOpenRequests <= 0 {
+		breakerConfig.HalfOpenRequests = 1
+	}
+	return breakerConfig
+}
+
+// 定义熔断器的状态
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// 定义一个域名的熔断器
+type circuitBreaker struct {
+	mu       sync.Mutex
+	host     string
+	config   *CurlBreakerConfig
+	logger   *zap.Logger
+	state    breakerState
+	failures int       // 连续失败的次数
+	openedAt time.Time // 熔断的时间
+	probes   int       // 半开状态正在执行的探测请求数
+}
+
+// 判断是否允许发送请求，返回的方法用于记录请求结果
+func (cb *circuitBreaker) allow() (func(success bool), error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.state == breakerOpen {
+		if time.Since(cb.openedAt) < cb.config.OpenTimeout {
+			return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, cb.host)
+		}
+		cb.setState(breakerHalfOpen)
+	}
+	if cb.state == breakerHalfOpen {
+		if cb.probes >= cb.config.HalfOpenRequests {
+			return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, cb.host)
+		}
+		cb.probes++
+		return cb.probeDone, nil
+	}
+	return cb.done, nil
+}
+
+// 记录关闭状态下的请求结果
+func (cb *circuitBreaker) done(success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if success {
+		cb.failures = 0
+		return
+	}
+	cb.failures++
+	if cb.state == breakerClosed && cb.failures >= cb.config.FailureThreshold {
+		cb.open()
+	}
+}
+
+// 记录半开状态下探测请求的结果
+func (cb *circuitBreaker) probeDone(success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.probes > 0 {
+		cb.probes--
+	}
+	if cb.state != breakerHalfOpen {
+		return
+	}
+	if success {
+		cb.failures = 0
+		cb.setState(breakerClosed)
+		return
+	}
+	cb.open()
+}
+
+func (cb *circuitBreaker) open() {
+	cb.openedAt = time.Now()
+	cb.setState(breakerOpen)
+}
+
+// 修改状态并打印日志
+func (cb *circuitBreaker) setState(state breakerState) {
+	if cb.state == state {
+		return
+	}
+	cb.logger.Warn("curl circuit breaker state changed", zap.String("host", cb.host),
+		zap.String("from", cb.state.String()), zap.String("to", state.String()), zap.Int("failures", cb.failures))
+	cb.state = state
+}
+
+// 定义所有域名的熔断器，绑定请求的Curl对象共用
+type curlBreakers struct {
+	logger   *zap.Logger
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+// 获取域名的熔断器，没有开启熔断时返回nil
+func (c *Curl) breaker(host string) *circuitBreaker {
+	if c.config.Breaker == nil {
+		return nil
+	}
+	c.breakers.mu.Lock()
+	defer c.breakers.mu.Unlock()
+	cb, ok := c.breakers.breakers[host]
+	if !ok {
+		cb = &circuitBreaker{host: host, config: c.config.Breaker, logger: c.breakers.logger}
+		c.breakers.breakers[host] = cb
+	}
+	return cb
+}
@@ -0,0 +1,156 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestFillCurlBreakerConfig(t *testing.T) {
+	if fillCurlBreakerConfig(nil) != nil {
+		t.Error("fillCurlBreakerConfig(nil) != nil")
+	}
+	got := fillCurlBreakerConfig(&CurlBreakerConfig{})
+	if got.FailureThreshold != 5 || got.OpenTimeout != 30*time.Second || got.HalfOpenRequests != 1 {
+		t.Errorf("fillCurlBreakerConfig() = %+v", got)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	const (
+		ok      = "ok"      // 请求成功
+		fail    = "fail"    // 请求失败
+		reject  = "reject"  // 请求被熔断
+		wait    = "wait"    // 等待熔断超时
+		probe   = "probe"   // 开始一个半开状态的探测请求，不结束
+		probeOk = "probeOk" // 结束之前开始的探测请求，结果成功
+	)
+	tests := []struct {
+		name  string
+		steps []string
+		want  breakerState
+	}{
+		{"stays closed below threshold", []string{fail, fail, ok, fail, fail}, breakerClosed},
+		{"opens at threshold", []string{fail, fail, fail}, breakerOpen},
+		{"rejects while open", []string{fail, fail, fail, reject, reject}, breakerOpen},
+		{"half open after timeout", []string{fail, fail, fail, wait, probe}, breakerHalfOpen},
+		{"half open limits probes", []string{fail, fail, fail, wait, probe, reject}, breakerHalfOpen},
+		{"probe success closes", []string{fail, fail, fail, wait, ok}, breakerClosed},
+		{"probe failure reopens", []string{fail, fail, fail, wait, fail, reject}, breakerOpen},
+		{"concurrent probe finishes", []string{fail, fail, fail, wait, probe, probeOk, ok}, breakerClosed},
+		{"closed again counts from zero", []string{fail, fail, fail, wait, ok, fail, fail}, breakerClosed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb := &circuitBreaker{
+				host:   "upstream.test",
+				config: &CurlBreakerConfig{FailureThreshold: 3, OpenTimeout: 20 * time.Millisecond, HalfOpenRequests: 1},
+				logger: zap.NewNop(),
+			}
+			var pending []func(bool)
+			for i, step := range tt.steps {
+				if step == wait {
+					time.Sleep(30 * time.Millisecond)
+					continue
+				}
+				if step == probeOk {
+					pending[0](true)
+					pending = pending[1:]
+					continue
+				}
+				done, err := cb.allow()
+				if step == reject {
+					if !errors.Is(err, ErrCircuitOpen) {
+						t.Fatalf("step %d: allow() error = %v, want ErrCircuitOpen", i, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("step %d: allow() error = %v", i, err)
+				}
+				switch step {
+				case probe:
+					pending = append(pending, done)
+				default:
+					done(step == ok)
+				}
+			}
+			if cb.state != tt.want {
+				t.Errorf("state = %s, want %s", cb.state, tt.want)
+			}
+		})
+	}
+}
+
+func TestCurlBreaker(t *testing.T) {
+	var calls int32
+	core, logs := observer.New(zapcore.WarnLevel)
+	app := newTestApp(t, WithCurlConfig(&CurlConfig{
+		Breaker:   &CurlBreakerConfig{FailureThreshold: 2, OpenTimeout: time.Hour},
+		Transport: statusTransport(&calls, http.StatusBadGateway),
+	}))
+	app.Logger = zap.New(core)
+	c := NewCurl(app)
+	do := func(url string) error {
+		_, err := c.R().URL(url).Do(context.Background())
+		return err
+	}
+
+	tests := []struct {
+		name  string
+		url   string
+		calls int32
+		open  bool
+	}{
+		{"first failure", "http://a.test/x", 1, false},
+		{"second failure opens", "http://a.test/y", 2, false},
+		{"open rejects without sending", "http://a.test/z", 2, true},
+		{"other host is not affected", "http://b.test/x", 3, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := do(tt.url)
+			if errors.Is(err, ErrCircuitOpen) != tt.open {
+				t.Errorf("Do() error = %v, want circuit open %v", err, tt.open)
+			}
+			if calls != tt.calls {
+				t.Errorf("calls = %d, want %d", calls, tt.calls)
+			}
+		})
+	}
+
+	// 状态变化通过app.Logger打印
+	entries := logs.FilterMessage("curl circuit breaker state changed").All()
+	if len(entries) != 1 {
+		t.Fatalf("got %d state change logs, want 1", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if fields["host"] != "a.test" || fields["from"] != "closed" || fields["to"] != "open" {
+		t.Errorf("state change log = %v", fields)
+	}
+}
+
+func TestCurlBreakerIgnoresCanceledRequests(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := newTestCurl(t, &CurlConfig{
+		Breaker: &CurlBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Hour},
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			cancel()
+			<-r.Context().Done()
+			return nil, r.Context().Err()
+		}),
+	})
+	if _, err := c.R().URL("http://a.test/").Do(ctx); err == nil {
+		t.Fatal("Do() error = nil, want error")
+	}
+	// 调用方取消的请求不计入熔断
+	if state := c.breaker("a.test").state; state != breakerClosed {
+		t.Errorf("state = %s, want closed", state)
+	}
+}
@@ -0,0 +1,270 @@
+package flow
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/funswe/flow/utils/json"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// 定义内置编解码器支持的MIME类型
+const (
+	MIMEJson     = "application/json"
+	MIMEXml      = "application/xml"
+	MIMETextXml  = "text/xml"
+	MIMEYaml     = "application/yaml"
+	MIMEXYaml    = "application/x-yaml"
+	MIMEMsgPack  = "application/msgpack"
+	MIMEXMsgPack = "application/x-msgpack"
+	MIMEProtobuf = "application/x-protobuf"
+)
+
+// Codec 定义编解码器，用于请求实体的解析和返回数据的编码
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type xmlCodec struct{}
+
+func (xmlCodec) Marshal(v interface{}) ([]byte, error) {
+	return xml.Marshal(v)
+}
+
+func (xmlCodec) Unmarshal(data []byte, v interface{}) error {
+	return xml.Unmarshal(data, v)
+}
+
+type yamlCodec struct{}
+
+func (yamlCodec) Marshal(v interface{}) ([]byte, error) {
+	return yaml.Marshal(v)
+}
+
+func (yamlCodec) Unmarshal(data []byte, v interface{}) error {
+	return yaml.Unmarshal(data, v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	// 整数统一解析成int64，浮点数统一解析成float64，和json的参数类型保持一致
+	dec.UseLooseInterfaceDecoding(true)
+	return dec.Decode(v)
+}
+
+type protobufCodec struct{}
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, errors.New("protobuf codec: value is not a proto.Message")
+	}
+	return proto.Marshal(m)
+}
+
+func (protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return errors.New("protobuf codec: value is not a proto.Message")
+	}
+	return proto.Unmarshal(data, m)
+}
+
+// 定义编解码器注册表，按注册顺序协商，Accept为*/*时使用第一个注册的编解码器
+type codecRegistry struct {
+	codecs map[string]Codec
+	order  []string
+}
+
+// 返回默认的编解码器注册表
+func defCodecRegistry() *codecRegistry {
+	cr := &codecRegistry{codecs: make(map[string]Codec)}
+	cr.register(MIMEJson, jsonCodec{})
+	cr.register(MIMEXml, xmlCodec{})
+	cr.register(MIMETextXml, xmlCodec{})
+	cr.register(MIMEYaml, yamlCodec{})
+	cr.register(MIMEXYaml, yamlCodec{})
+	cr.register(MIMEMsgPack, msgpackCodec{})
+	cr.register(MIMEXMsgPack, msgpackCodec{})
+	cr.register(MIMEProtobuf, protobufCodec{})
+	return cr
+}
+
+// 注册编解码器，相同的MIME类型会被覆盖
+func (cr *codecRegistry) register(mimeType string, codec Codec) {
+	mimeType = strings.ToLower(mimeType)
+	if _, ok := cr.codecs[mimeType]; !ok {
+		cr.order = append(cr.order, mimeType)
+	}
+	cr.codecs[mimeType] = codec
+}
+
+// 根据Content-Type获取编解码器
+func (cr *codecRegistry) get(contentType string) (Codec, bool) {
+	mimeType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	codec, ok := cr.codecs[mimeType]
+	return codec, ok
+}
+
+// 根据Accept头返回可以使用的MIME类型，按优先级排序，没有Accept头时按注册顺序返回所有的MIME类型
+func (cr *codecRegistry) negotiate(accept string) []string {
+	if len(strings.TrimSpace(accept)) == 0 {
+		return append([]string{}, cr.order...)
+	}
+	result := make([]string, 0)
+	added := make(map[string]bool)
+	add := func(mimeType string) {
+		if !added[mimeType] {
+			added[mimeType] = true
+			result = append(result, mimeType)
+		}
+	}
+	for _, mimeType := range parseAccept(accept) {
+		if mimeType == "*/*" {
+			for _, m := range cr.order {
+				add(m)
+			}
+			continue
+		}
+		if strings.HasSuffix(mimeType, "/*") {
+			prefix := strings.TrimSuffix(mimeType, "*")
+			for _, m := range cr.order {
+				if strings.HasPrefix(m, prefix) {
+					add(m)
+				}
+			}
+			continue
+		}
+		if _, ok := cr.codecs[mimeType]; ok {
+			add(mimeType)
+		}
+	}
+	return result
+}
+
+// 解析Accept头，按q值从大到小返回MIME类型，q=0的不返回
+func parseAccept(accept string) []string {
+	type acceptItem struct {
+		mimeType string
+		q        float64
+	}
+	items := make([]acceptItem, 0)
+	for _, part := range strings.Split(accept, ",") {
+		mimeType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		items = append(items, acceptItem{mimeType: mimeType, q: q})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].q > items[j].q
+	})
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.mimeType)
+	}
+	return result
+}
+
+// codecWriter 使用编解码器返回数据
+type codecWriter struct {
+	mimeType string
+	codec    Codec
+	data     interface{}
+	body     []byte // 已经编码的数据，不为空时不再编码
+}
+
+func (cw *codecWriter) SetHeader(c *Context) {
+	contentType := cw.mimeType
+	if strings.HasPrefix(contentType, "text/") || contentType == MIMEJson || contentType == MIMEXml || contentType == MIMEYaml || contentType == MIMEXYaml {
+		contentType += "; charset=utf-8"
+	}
+	c.SetHeader(HttpHeaderContentType, contentType)
+}
+
+func (cw *codecWriter) Data() ([]byte, error) {
+	if cw.body != nil {
+		return cw.body, nil
+	}
+	return cw.codec.Marshal(cw.data)
+}
+
+// RegisterCodec 注册编解码器，用于请求实体的解析和Negotiate返回数据
+func (app *Application) RegisterCodec(mimeType string, codec Codec) *Application {
+	app.codecs.register(mimeType, codec)
+	return app
+}
+
+// BindBody 根据请求的Content-Type选择编解码器解析请求实体，填充完成后根据flow标签校验
+func (c *Context) BindBody(object interface{}) error {
+	codec, ok := c.app.codecs.get(c.GetHeader(HttpHeaderContentType))
+	if !ok {
+		return NewHTTPError(http.StatusUnsupportedMediaType, 0, "")
+	}
+	body, err := c.GetRawBody()
+	if err != nil {
+		return err
+	}
+	if len(body) == 0 {
+		return NewHTTPError(http.StatusBadRequest, 0, "empty request body")
+	}
+	if err = codec.Unmarshal(body, object); err != nil {
+		return NewHTTPError(http.StatusBadRequest, 0, "invalid request body").WithError(err)
+	}
+	return Validate(object)
+}
+
+// Negotiate 根据请求的Accept头选择编码格式返回数据，不能编码数据的格式会跳过，例如xml不能编码map，没有可用的格式时返回406
+func (c *Context) Negotiate(data interface{}) {
+	c.res.addVary(HttpHeaderAccept)
+	var errs []error
+	for _, mimeType := range c.app.codecs.negotiate(c.GetHeader(HttpHeaderAccept)) {
+		codec := c.app.codecs.codecs[mimeType]
+		body, err := codec.Marshal(data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", mimeType, err))
+			continue
+		}
+		c.Res(&codecWriter{mimeType: mimeType, codec: codec, data: data, body: body})
+		return
+	}
+	c.Error(NewHTTPError(http.StatusNotAcceptable, 0, "").WithError(errors.Join(errs...)))
+}
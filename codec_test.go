@@ -0,0 +1,243 @@
+package flow
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type codecItem struct {
+	Name  string `json:"name" xml:"name" yaml:"name" msgpack:"name" flow:"required"`
+	Count int64  `json:"count" xml:"count" yaml:"count" msgpack:"count"`
+}
+
+// 测试用的编解码器，返回固定的内容
+type textCodec struct{}
+
+func (textCodec) Marshal(v interface{}) ([]byte, error) {
+	return []byte("text"), nil
+}
+
+func (textCodec) Unmarshal(data []byte, v interface{}) error {
+	return nil
+}
+
+func TestParseAccept(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   []string
+	}{
+		{"application/json", []string{"application/json"}},
+		{"application/xml;q=0.5, application/json", []string{"application/json", "application/xml"}},
+		{"text/*;q=0.3, application/yaml;q=0.8, */*;q=0.1", []string{"application/yaml", "text/*", "*/*"}},
+		{"application/json;q=0, application/xml", []string{"application/xml"}},
+		{"Application/JSON", []string{"application/json"}},
+		{"invalid;;, application/json", []string{"application/json"}},
+		// 相同的q值保持原来的顺序
+		{"application/yaml, application/json", []string{"application/yaml", "application/json"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			if got := parseAccept(tt.accept); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseAccept() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCodecRegistryNegotiate(t *testing.T) {
+	cr := defCodecRegistry()
+	tests := []struct {
+		name   string
+		accept string
+		want   []string
+	}{
+		{"no accept", "", cr.order},
+		{"exact", "application/yaml", []string{MIMEYaml}},
+		{"q values", "application/json;q=0.5, application/x-msgpack", []string{MIMEXMsgPack, MIMEJson}},
+		{"type wildcard", "text/*", []string{MIMETextXml}},
+		{"any", "application/xml, */*;q=0.1", append([]string{MIMEXml, MIMEJson}, cr.order[2:]...)},
+		{"unknown", "text/html", []string{}},
+		{"rejected by q=0", "application/json;q=0", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cr.negotiate(tt.accept); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("negotiate(%q) = %v, want %v", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCodecRegistry(t *testing.T) {
+	cr := defCodecRegistry()
+	n := len(cr.order)
+	tests := []struct {
+		contentType string
+		ok          bool
+	}{
+		{"application/json", true},
+		{"application/json; charset=utf-8", true},
+		{"Application/X-YAML", true},
+		{"text/plain", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			if _, ok := cr.get(tt.contentType); ok != tt.ok {
+				t.Errorf("get(%q) ok = %v, want %v", tt.contentType, ok, tt.ok)
+			}
+		})
+	}
+	// 覆盖已经注册的类型不改变协商顺序，新的类型加到最后
+	cr.register("Application/JSON", textCodec{})
+	cr.register("text/plain", textCodec{})
+	if len(cr.order) != n+1 || cr.order[0] != MIMEJson || cr.order[n] != "text/plain" {
+		t.Errorf("order = %v", cr.order)
+	}
+	if codec, _ := cr.get(MIMEJson); codec != (textCodec{}) {
+		t.Errorf("get(json) = %T, want textCodec", codec)
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	item := codecItem{Name: "bob", Count: 3}
+	for _, mimeType := range []string{MIMEJson, MIMEXml, MIMEYaml, MIMEMsgPack} {
+		t.Run(mimeType, func(t *testing.T) {
+			codec, _ := defCodecRegistry().get(mimeType)
+			data, err := codec.Marshal(item)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			var got codecItem
+			if err = codec.Unmarshal(data, &got); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if got != item {
+				t.Errorf("got %+v, want %+v", got, item)
+			}
+		})
+	}
+	t.Run(MIMEProtobuf, func(t *testing.T) {
+		codec, _ := defCodecRegistry().get(MIMEProtobuf)
+		data, err := codec.Marshal(wrapperspb.String("bob"))
+		if err != nil {
+			t.Fatalf("Marshal() error = %v", err)
+		}
+		got := &wrapperspb.StringValue{}
+		if err = codec.Unmarshal(data, got); err != nil || got.GetValue() != "bob" {
+			t.Errorf("Unmarshal() = %v, %v", got, err)
+		}
+		if _, err = codec.Marshal(item); err == nil {
+			t.Error("Marshal(struct) error = nil, want error")
+		}
+		if err = codec.Unmarshal(data, &item); err == nil {
+			t.Error("Unmarshal(struct) error = nil, want error")
+		}
+	})
+	// msgpack解析到map时整数是int64，和json参数类型一致
+	codec, _ := defCodecRegistry().get(MIMEMsgPack)
+	data, _ := codec.Marshal(map[string]interface{}{"count": 3})
+	m := make(map[string]interface{})
+	if err := codec.Unmarshal(data, &m); err != nil || reflect.TypeOf(m["count"]).Kind() != reflect.Int64 {
+		t.Errorf("Unmarshal(map) = %#v, %v", m, err)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        interface{}
+		accept      string
+		status      int
+		contentType string
+	}{
+		{"default json", codecItem{Name: "bob"}, "", http.StatusOK, "application/json; charset=utf-8"},
+		{"xml", codecItem{Name: "bob"}, "application/xml", http.StatusOK, "application/xml; charset=utf-8"},
+		{"yaml by q value", codecItem{Name: "bob"}, "application/json;q=0.1, application/yaml", http.StatusOK, "application/yaml; charset=utf-8"},
+		{"msgpack", codecItem{Name: "bob"}, "application/msgpack", http.StatusOK, "application/msgpack"},
+		{"protobuf", wrapperspb.String("bob"), "application/x-protobuf", http.StatusOK, "application/x-protobuf"},
+		{"skip codec that cannot encode", map[string]interface{}{"name": "bob"}, "application/xml, application/json;q=0.5", http.StatusOK, "application/json; charset=utf-8"},
+		{"wildcard", codecItem{Name: "bob"}, "text/*", http.StatusOK, "text/xml; charset=utf-8"},
+		{"not acceptable", codecItem{Name: "bob"}, "text/html", http.StatusNotAcceptable, "application/json; charset=utf-8"},
+		{"no codec can encode", map[string]interface{}{"name": "bob"}, "application/xml", http.StatusNotAcceptable, "application/json; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			app.GET("/", func(ctx *Context) {
+				ctx.Negotiate(tt.data)
+			})
+			w := serve(app, http.MethodGet, "/", nil, HttpHeaderAccept, tt.accept)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if ct := w.Header().Get(HttpHeaderContentType); ct != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", ct, tt.contentType)
+			}
+			if !strings.Contains(w.Header().Get(HttpHeaderVary), HttpHeaderAccept) {
+				t.Errorf("Vary = %q, want Accept", w.Header().Get(HttpHeaderVary))
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			// 返回的实体可以用同一个编解码器解析
+			codec, _ := app.codecs.get(tt.contentType)
+			if m, ok := tt.data.(proto.Message); ok {
+				got := proto.Clone(m)
+				proto.Reset(got)
+				if err := codec.Unmarshal(w.Body.Bytes(), got); err != nil || !proto.Equal(got, m) {
+					t.Errorf("body = %v, %v", got, err)
+				}
+				return
+			}
+			var got codecItem
+			if err := codec.Unmarshal(w.Body.Bytes(), &got); err != nil || got.Name != "bob" {
+				t.Errorf("body = %+v, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestBindBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int // 期望的HTTPError状态码，0表示期望没有错误
+		errType     string
+	}{
+		{"json", "application/json", `{"name":"bob","count":2}`, 0, ""},
+		{"yaml", "application/yaml", "name: bob\ncount: 2\n", 0, ""},
+		{"xml", "text/xml; charset=utf-8", "<codecItem><name>bob</name><count>2</count></codecItem>", 0, ""},
+		{"custom codec", "text/plain", "anything", 0, "required"},
+		{"unsupported media type", "text/html", "<p>bob</p>", http.StatusUnsupportedMediaType, ""},
+		{"empty body", "application/json", "", http.StatusBadRequest, ""},
+		{"invalid body", "application/json", "{", http.StatusBadRequest, ""},
+		{"validation", "application/json", `{"count":2}`, 0, "required"},
+	}
+	app := newTestApp(t)
+	app.RegisterCodec("text/plain", textCodec{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			r.Header.Set(HttpHeaderContentType, tt.contentType)
+			c, _ := newTestContext(t, app, r)
+			var got codecItem
+			err := c.BindBody(&got)
+			if tt.status != 0 {
+				checkHTTPError(t, err, tt.status)
+				return
+			}
+			checkBindError(t, err, tt.errType)
+			if tt.errType == "" && (got.Name != "bob" || got.Count != 2) {
+				t.Errorf("BindBody() = %+v", got)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package flow
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"errors"
@@ -9,7 +10,6 @@ import (
 	"github.com/funswe/flow/utils/json"
 	"github.com/julienschmidt/httprouter"
 	"go.uber.org/zap"
-	"io"
 	"mime/multipart"
 	"net/http"
 	"net/url"
@@ -22,33 +22,21 @@ import (
 
 const defaultMultipartMemory = 32 << 20 // 32 MB
 
-type FieldValidateError struct {
-	Type  string
-	Value interface{}
-	Field string
-	Param string
-}
-
-func (e *FieldValidateError) Error() string {
-	switch e.Type {
-	case "required":
-		return fmt.Sprintf("required param `%s` is nil", e.Param)
-	default:
-		return fmt.Sprintf("required param `%s` is nil", e.Param)
-	}
-}
-
 // Context 定义请求上下文对象
 type Context struct {
 	req        *request               // 请求封装的request对象
 	res        *response              // 请求封装的response对象
-	statusCode int                    // 返回的http状态码
 	mu         sync.RWMutex           // 互斥锁，用于data map
-	rawBody    []byte                 // 原始的请求实体
+	rawBody    []byte                 // 原始的请求实体，第一次获取时才读取
 	rawBodyErr error                  // 获取原始请求实体的错误
 	data       map[string]interface{} // 用于保存用户定义的数据
-	params     map[string]interface{} // 请求的参数，包括POST，GET和路由的参数
+	params     map[string]interface{} // 请求的参数，包括POST，GET和路由的参数，第一次获取时才解析
+	uriParams  httprouter.Params      // 路由的参数
+	body       requestBody            // 请求实体的读取状态
 	app        *Application           // 服务的APP对象
+	group      *RouterGroup           // 请求匹配的路由所属的路由组
+	route      string                 // 请求匹配的路由路径，如/users/:id
+	session    *Session               // 请求的session对象，使用session中间件时才有
 	Logger     *zap.Logger            // 上下文的logger对象，打印日志会自动带上请求的相关参数
 	Orm        *Orm                   // 数据库操作对象，引用app的orm对象
 	Redis      *RedisClient           // redis操作对象，引用app的redis对象
@@ -70,38 +58,6 @@ func newContext(w http.ResponseWriter, r *http.Request, params httprouter.Params
 	req := newRequest(r, reqId, app)
 	// 封装请求的response对象
 	res := newResponse(w, req, app)
-	// 判断是不是上传文件
-	if strings.HasPrefix(req.getHeader("Content-Type"), "multipart/form-data") {
-		_ = r.ParseMultipartForm(defaultMultipartMemory)
-	} else {
-		_ = r.ParseForm()
-	}
-	mapParams := make(map[string]interface{})
-	if len(params) > 0 {
-		for i := range params {
-			mapParams[params[i].Key] = params[i].Value
-		}
-	}
-	for k := range r.Form {
-		mapParams[k] = r.FormValue(k)
-	}
-	var rawBody []byte
-	var err error
-	if r.Body != nil {
-		rawBody, err = io.ReadAll(r.Body)
-	}
-	// 如果是json请求，解析json数据，如果form参数和json参数相同，json参数覆盖form参数
-	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
-		if err == nil && len(rawBody) > 0 {
-			jsonMap := make(map[string]interface{})
-			err = json.Unmarshal(rawBody, &jsonMap)
-			if err == nil {
-				for k := range jsonMap {
-					mapParams[k] = jsonMap[k]
-				}
-			}
-		}
-	}
 	h := md5.New()
 	h.Write([]byte(fmt.Sprintf("request-%s-%d", req.id, time.Now().Nanosecond())))
 	suffix := hex.EncodeToString(h.Sum(nil))
@@ -112,7 +68,10 @@ func newContext(w http.ResponseWriter, r *http.Request, params httprouter.Params
 		"logId": logId,
 		"ua":    req.getUserAgent(),
 	})
-	return &Context{req: req, res: res, params: mapParams, rawBody: rawBody, rawBodyErr: err, Logger: ctxLogger, app: app, Orm: app.Orm, Redis: app.Redis, Curl: app.Curl, Jwt: app.Jwt}
+	c := &Context{req: req, res: res, uriParams: params, body: requestBody{maxSize: app.serverConfig.MaxBodySize}, Logger: ctxLogger, app: app, Orm: app.Orm, Redis: app.Redis, Jwt: app.Jwt}
+	// 绑定当前请求，请求取消时发出的请求也会取消
+	c.Curl = app.Curl.bind(c)
+	return c
 }
 
 // SetData 保存key / value数据
@@ -135,8 +94,8 @@ func (c *Context) GetData(key string) (value interface{}, exists bool) {
 
 // GetStringParam 获取请求的string参数，如果参数类型不是string，则会转换成string，只支持基本类型转换
 func (c *Context) GetStringParam(key string) (value string) {
-	if val, ok := c.params[key]; ok && val != nil {
-		switch jv := c.params[key].(type) {
+	if val, ok := c.getParams()[key]; ok && val != nil {
+		switch jv := c.getParams()[key].(type) {
 		case string:
 			value = jv
 		case int:
@@ -172,8 +131,8 @@ func (c *Context) GetStringParamDefault(key string, def string) (value string) {
 
 // GetIntParam 获取请求的int参数，如果参数类型不是int，则会转换成int，只支持基本类型转换
 func (c *Context) GetIntParam(key string) (value int) {
-	if val, ok := c.params[key]; ok && val != nil {
-		switch jv := c.params[key].(type) {
+	if val, ok := c.getParams()[key]; ok && val != nil {
+		switch jv := c.getParams()[key].(type) {
 		case string:
 			value, _ = strconv.Atoi(jv)
 		case int:
@@ -209,8 +168,8 @@ func (c *Context) GetIntParamDefault(key string, def int) (value int) {
 
 // GetInt64Param 获取请求的int64参数，如果参数类型不是int64，则会转换成int64，只支持基本类型转换
 func (c *Context) GetInt64Param(key string) (value int64) {
-	if val, ok := c.params[key]; ok && val != nil {
-		switch jv := c.params[key].(type) {
+	if val, ok := c.getParams()[key]; ok && val != nil {
+		switch jv := c.getParams()[key].(type) {
 		case string:
 			v, _ := strconv.Atoi(jv)
 			value = int64(v)
@@ -247,8 +206,8 @@ func (c *Context) GetInt64ParamDefault(key string, def int64) (value int64) {
 
 // GetFloat64Param 获取请求的float64参数，如果参数类型不是float64，则会转换成float64，只支持基本类型转换
 func (c *Context) GetFloat64Param(key string) (value float64) {
-	if val, ok := c.params[key]; ok && val != nil {
-		switch jv := c.params[key].(type) {
+	if val, ok := c.getParams()[key]; ok && val != nil {
+		switch jv := c.getParams()[key].(type) {
 		case string:
 			v, _ := strconv.Atoi(jv)
 			value = float64(v)
@@ -285,8 +244,8 @@ func (c *Context) GetFloat64ParamDefault(key string, def float64) (value float64
 
 // GetBoolParam 获取请求的bool参数，如果参数类型不是bool，则会转换成bool，只支持基本类型转换
 func (c *Context) GetBoolParam(key string) (value bool) {
-	if val, ok := c.params[key]; ok && val != nil {
-		switch jv := c.params[key].(type) {
+	if val, ok := c.getParams()[key]; ok && val != nil {
+		switch jv := c.getParams()[key].(type) {
 		case string:
 			v, _ := strconv.Atoi(jv)
 			value = v > 0
@@ -318,17 +277,19 @@ func (c *Context) GetBoolParamDefault(key string, def bool) (value bool) {
 	return val
 }
 
-// GetRawBody 获取原始请求实体
+// GetRawBody 获取原始请求实体，第一次调用时读取请求实体
 func (c *Context) GetRawBody() ([]byte, error) {
+	c.readBody()
 	return c.rawBody, c.rawBodyErr
 }
 
 // GetRawStringBody 获取原始请求实体string
 func (c *Context) GetRawStringBody() (string, error) {
+	c.readBody()
 	return string(c.rawBody), c.rawBodyErr
 }
 
-// Parse 解析请求的参数，将参数赋值到给定的对象里
+// Parse 解析请求的参数，将参数赋值到给定的对象里，并根据flow标签校验参数，返回所有字段的校验错误
 func (c *Context) Parse(object interface{}) error {
 	if object == nil {
 		return errors.New("object can not be nil")
@@ -337,42 +298,97 @@ func (c *Context) Parse(object interface{}) error {
 	if t.Kind() == reflect.Ptr {
 		t = t.Elem()
 	}
-	fieldNum := t.NumField()
-	for i := 0; i < fieldNum; i++ {
+	if t.Kind() != reflect.Struct {
+		return errors.New("object must be a pointer to struct")
+	}
+	// 读取请求实体失败的直接返回，如超过长度限制返回413
+	if err := c.loadParams(); err != nil {
+		return err
+	}
+	// query，form和路由参数都是字符串，先转换成字段的类型，类型不匹配的参数返回type错误
+	params, errs := convertParams(t, c.getParams())
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(body, object); err != nil {
+		return NewHTTPError(http.StatusBadRequest, 0, "invalid params").WithError(err)
+	}
+	if err = validateObject(object, "json"); err != nil {
+		var ves FieldValidateErrors
+		if !errors.As(err, &ves) {
+			return err
+		}
+		errs = append(errs, withoutTypeErrorParams(ves, errs)...)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// 将参数转换成结构体字段的类型，返回转换后的参数，不能转换的参数从结果里去掉并返回type错误
+func convertParams(t reflect.Type, params map[string]interface{}) (map[string]interface{}, FieldValidateErrors) {
+	result := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		result[k] = v
+	}
+	var errs FieldValidateErrors
+	convertFields(t, result, &errs)
+	return result, errs
+}
+
+// 转换结构体第一层字段对应的参数，匿名嵌入的结构体字段和当前结构体在同一层
+func convertFields(t reflect.Type, params map[string]interface{}, errs *FieldValidateErrors) {
+	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
-		flowTag := field.Tag.Get("flow")
-		if len(flowTag) == 0 {
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" || (!field.IsExported() && !field.Anonymous) {
 			continue
 		}
-		ss := strings.Split(flowTag, ";")
-		for _, tag := range ss {
-			kv := strings.Split(tag, ":")
-			if kv[0] == "required" && kv[1] == "true" {
-				showName := field.Name
-				jsonTag := field.Tag.Get("json")
-				if len(jsonTag) > 0 {
-					jsonName := strings.Split(jsonTag, ",")
-					showName = jsonName[0]
-				}
-				if _, ok := c.params[showName]; !ok {
-					return &FieldValidateError{
-						Type:  "required",
-						Field: field.Name,
-						Param: showName,
-					}
-				}
-				break
+		if field.Anonymous && len(name) == 0 {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				convertFields(ft, params, errs)
 			}
+			continue
 		}
+		if !field.IsExported() {
+			continue
+		}
+		if len(name) == 0 {
+			name = field.Name
+		}
+		value, ok := params[name]
+		if !ok || value == nil {
+			continue
+		}
+		// 先按json转换，字符串参数转换失败时再按字段类型转换，如"18"转换成int
+		fv := reflect.New(field.Type)
+		b, err := json.Marshal(value)
+		if err == nil && json.Unmarshal(b, fv.Interface()) == nil {
+			continue
+		}
+		if s, isString := value.(string); isString && setFieldValues(fv.Elem(), []string{s}) == nil {
+			params[name] = fv.Elem().Interface()
+			continue
+		}
+		delete(params, name)
+		*errs = append(*errs, &FieldValidateError{
+			Type:  "type",
+			Value: value,
+			Field: field.Name,
+			Param: name,
+			Arg:   typeName(field.Type),
+		})
 	}
-	body, err := json.Marshal(c.params)
-	if err != nil {
-		return err
-	}
-	return json.Unmarshal(body, object)
 }
 
 func (c *Context) FormFile(name string) (*multipart.FileHeader, error) {
+	c.limitBody()
 	if c.req.req.MultipartForm == nil {
 		if err := c.req.req.ParseMultipartForm(defaultMultipartMemory); err != nil {
 			return nil, err
@@ -469,7 +485,6 @@ func (c *Context) SetHeader(key, value string) *Context {
 
 // SetStatus 设置返回的http状态码
 func (c *Context) SetStatus(code int) *Context {
-	c.statusCode = code
 	c.res.setStatus(code)
 	return c
 }
@@ -503,6 +518,41 @@ func (c *Context) Json(data map[string]interface{}) {
 	c.Res(jw)
 }
 
+// Error 通过app的错误渲染方法返回错误信息
+func (c *Context) Error(err error) {
+	c.app.renderError(c, err)
+}
+
+// Context 获取请求的context，客户端断开或者请求结束时取消
+func (c *Context) Context() context.Context {
+	if c.req == nil {
+		return context.Background()
+	}
+	return c.req.req.Context()
+}
+
+// GetRequestId 获取请求ID，优先使用请求头X-Request-Id，没有或者格式不合法时使用生成的请求ID
+func (c *Context) GetRequestId() string {
+	if id := c.req.getHeader(HttpHeaderXRequestId); validRequestId(id) {
+		return id
+	}
+	return c.req.id
+}
+
+// 校验客户端传入的请求ID，最长128个字符，只能包含字母、数字和-_.:，避免转发给上游服务时注入请求头或者污染日志
+func validRequestId(id string) bool {
+	if len(id) == 0 || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		ch := id[i]
+		if !(ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch == '-' || ch == '_' || ch == '.' || ch == ':') {
+			return false
+		}
+	}
+	return true
+}
+
 // GetApp 获取app对象
 func (c *Context) GetApp() *Application {
 	return c.app
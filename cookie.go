@@ -0,0 +1,243 @@
+package flow
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrCookieKeysNotSet 没有设置cookie密钥，不能使用签名和加密的cookie
+	ErrCookieKeysNotSet = errors.New("cookie keys are not set")
+	// ErrInvalidCookie cookie的签名校验或者解密失败
+	ErrInvalidCookie = errors.New("invalid cookie value")
+)
+
+// CookieConfig 定义cookie配置
+type CookieConfig struct {
+	Keys     []string      // 签名和加密cookie的密钥，第一个密钥用于签名和加密，所有的密钥都用于校验和解密，轮换密钥时把新密钥放在第一个
+	Path     string        // cookie默认的路径，默认值/
+	Domain   string        // cookie默认的域名
+	Secure   bool          // cookie默认是否只在https下发送
+	HttpOnly *bool         // cookie默认是否禁止js读取，为nil时默认值true，需要关闭时使用flow.Bool(false)
+	SameSite http.SameSite // cookie默认的SameSite，默认值Lax
+}
+
+// 返回默认的cookie配置
+func defCookieConfig() *CookieConfig {
+	return &CookieConfig{
+		Path:     "/",
+		HttpOnly: Bool(true),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// CookieOptions 定义设置cookie的选项，没有设置的字段使用cookie配置里的默认值
+type CookieOptions struct {
+	MaxAge   int           // cookie的有效期，单位秒，0表示会话cookie，小于0表示删除
+	Expires  time.Time     // cookie的过期时间，兼容不支持MaxAge的客户端
+	Path     string        // cookie的路径，为空时使用cookie配置的路径
+	Domain   string        // cookie的域名，为空时使用cookie配置的域名
+	Secure   *bool         // 是否只在https下发送，为nil时使用cookie配置的Secure
+	HttpOnly *bool         // 是否禁止js读取，为nil时使用cookie配置的HttpOnly
+	SameSite http.SameSite // SameSite属性，为0时使用cookie配置的SameSite
+}
+
+// Bool 返回bool值的指针，用于设置CookieConfig和CookieOptions的HttpOnly等字段，如flow.Bool(false)
+func Bool(v bool) *bool {
+	return &v
+}
+
+// SetCookieConfig 设置cookie配置
+func (app *Application) SetCookieConfig(cookieConfig *CookieConfig) *Application {
+	if cookieConfig == nil {
+		cookieConfig = defCookieConfig()
+	}
+	if len(cookieConfig.Path) == 0 {
+		cookieConfig.Path = defCookieConfig().Path
+	}
+	if cookieConfig.HttpOnly == nil {
+		cookieConfig.HttpOnly = defCookieConfig().HttpOnly
+	}
+	if cookieConfig.SameSite == 0 {
+		cookieConfig.SameSite = defCookieConfig().SameSite
+	}
+	app.cookieConfig = cookieConfig
+	return app
+}
+
+// GetCookieConfig 获取cookie配置
+func (app *Application) GetCookieConfig() *CookieConfig {
+	return app.cookieConfig
+}
+
+// 根据选项创建cookie，没有选项时使用cookie配置里的默认值
+func (c *Context) newCookie(name, value string, options []*CookieOptions) *http.Cookie {
+	cc := c.app.cookieConfig
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     cc.Path,
+		Domain:   cc.Domain,
+		Secure:   cc.Secure,
+		HttpOnly: *cc.HttpOnly,
+		SameSite: cc.SameSite,
+	}
+	if len(options) == 0 || options[0] == nil {
+		return cookie
+	}
+	opts := options[0]
+	cookie.MaxAge = opts.MaxAge
+	cookie.Expires = opts.Expires
+	if len(opts.Path) > 0 {
+		cookie.Path = opts.Path
+	}
+	if len(opts.Domain) > 0 {
+		cookie.Domain = opts.Domain
+	}
+	if opts.Secure != nil {
+		cookie.Secure = *opts.Secure
+	}
+	if opts.HttpOnly != nil {
+		cookie.HttpOnly = *opts.HttpOnly
+	}
+	if opts.SameSite != 0 {
+		cookie.SameSite = opts.SameSite
+	}
+	return cookie
+}
+
+// Cookie 获取cookie的值，cookie不存在时返回http.ErrNoCookie
+func (c *Context) Cookie(name string) (string, error) {
+	cookie, err := c.req.req.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	return cookie.Value, nil
+}
+
+// SetCookie 设置cookie，options为空时使用cookie配置里的默认值
+func (c *Context) SetCookie(name, value string, options ...*CookieOptions) {
+	http.SetCookie(c.res.res, c.newCookie(name, value, options))
+}
+
+// ClearCookie 删除cookie，设置cookie时指定了Path和Domain的，删除时也要指定相同的值
+func (c *Context) ClearCookie(name string, options ...*CookieOptions) {
+	cookie := c.newCookie(name, "", options)
+	cookie.MaxAge = -1
+	cookie.Expires = time.Unix(0, 0)
+	http.SetCookie(c.res.res, cookie)
+}
+
+// SetSignedCookie 设置签名的cookie，值是明文的，但是客户端不能篡改
+func (c *Context) SetSignedCookie(name, value string, options ...*CookieOptions) error {
+	keys := c.app.cookieConfig.Keys
+	if len(keys) == 0 {
+		return ErrCookieKeysNotSet
+	}
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(value))
+	c.SetCookie(name, encoded+"."+signCookie(keys[0], name, encoded), options...)
+	return nil
+}
+
+// SignedCookie 获取签名的cookie的值，签名校验失败时返回ErrInvalidCookie
+func (c *Context) SignedCookie(name string) (string, error) {
+	keys := c.app.cookieConfig.Keys
+	if len(keys) == 0 {
+		return "", ErrCookieKeysNotSet
+	}
+	raw, err := c.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	i := strings.LastIndexByte(raw, '.')
+	if i < 0 {
+		return "", ErrInvalidCookie
+	}
+	encoded, signature := raw[:i], raw[i+1:]
+	for _, key := range keys {
+		if hmac.Equal([]byte(signature), []byte(signCookie(key, name, encoded))) {
+			value, err := base64.RawURLEncoding.DecodeString(encoded)
+			if err != nil {
+				return "", ErrInvalidCookie
+			}
+			return string(value), nil
+		}
+	}
+	return "", ErrInvalidCookie
+}
+
+// SetEncryptedCookie 设置AES-GCM加密的cookie，客户端不能读取和篡改
+func (c *Context) SetEncryptedCookie(name, value string, options ...*CookieOptions) error {
+	keys := c.app.cookieConfig.Keys
+	if len(keys) == 0 {
+		return ErrCookieKeysNotSet
+	}
+	gcm, err := cookieCipher(keys[0])
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	// cookie名称作为附加数据，防止把一个cookie的值用到另一个cookie上
+	sealed := gcm.Seal(nonce, nonce, []byte(value), []byte(name))
+	c.SetCookie(name, base64.RawURLEncoding.EncodeToString(sealed), options...)
+	return nil
+}
+
+// EncryptedCookie 获取加密的cookie的值，解密失败时返回ErrInvalidCookie
+func (c *Context) EncryptedCookie(name string) (string, error) {
+	keys := c.app.cookieConfig.Keys
+	if len(keys) == 0 {
+		return "", ErrCookieKeysNotSet
+	}
+	raw, err := c.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+	for _, key := range keys {
+		gcm, err := cookieCipher(key)
+		if err != nil {
+			return "", err
+		}
+		if len(sealed) < gcm.NonceSize() {
+			return "", ErrInvalidCookie
+		}
+		nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+		if value, err := gcm.Open(nil, nonce, ciphertext, []byte(name)); err == nil {
+			return string(value), nil
+		}
+	}
+	return "", ErrInvalidCookie
+}
+
+// 计算cookie的签名，签名包含cookie名称
+func signCookie(key, name, value string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(name + "=" + value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// 根据密钥返回AES-GCM加密对象，密钥经过sha256得到32字节的AES-256密钥
+func cookieCipher(key string) (cipher.AEAD, error) {
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,191 @@
+package flow
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewCookie(t *testing.T) {
+	app := newTestApp(t, WithCookieConfig(&CookieConfig{
+		Domain:   "example.com",
+		Secure:   true,
+		HttpOnly: Bool(true),
+	}))
+	tests := []struct {
+		name    string
+		options []*CookieOptions
+		want    http.Cookie
+	}{
+		{"config defaults", nil, http.Cookie{Path: "/", Domain: "example.com", Secure: true, HttpOnly: true, SameSite: http.SameSiteLaxMode}},
+		{"nil options", []*CookieOptions{nil}, http.Cookie{Path: "/", Domain: "example.com", Secure: true, HttpOnly: true, SameSite: http.SameSiteLaxMode}},
+		{"empty options keep defaults", []*CookieOptions{{MaxAge: 60}},
+			http.Cookie{Path: "/", Domain: "example.com", MaxAge: 60, Secure: true, HttpOnly: true, SameSite: http.SameSiteLaxMode}},
+		{"override all", []*CookieOptions{{Path: "/api", Domain: "api.example.com", Secure: Bool(false), HttpOnly: Bool(false), SameSite: http.SameSiteStrictMode}},
+			http.Cookie{Path: "/api", Domain: "api.example.com", SameSite: http.SameSiteStrictMode}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestContext(t, app, httptest.NewRequest(http.MethodGet, "/", nil))
+			got := c.newCookie("sid", "v", tt.options)
+			tt.want.Name, tt.want.Value = "sid", "v"
+			if got.String() != tt.want.String() {
+				t.Errorf("newCookie() = %q, want %q", got.String(), tt.want.String())
+			}
+		})
+	}
+}
+
+func TestCookieConfigDefaults(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   *CookieConfig
+		httpOnly bool
+	}{
+		{"nil config", nil, true},
+		{"only keys", &CookieConfig{Keys: []string{"k1"}}, true},
+		{"disable http only", &CookieConfig{HttpOnly: Bool(false)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, WithCookieConfig(tt.config))
+			c, w := newTestContext(t, app, httptest.NewRequest(http.MethodGet, "/", nil))
+			c.SetCookie("a", "v")
+			if err := c.SetSignedCookie("b", "v"); tt.config != nil && len(tt.config.Keys) > 0 && err != nil {
+				t.Fatalf("SetSignedCookie() error = %v", err)
+			}
+			for _, cookie := range w.Result().Cookies() {
+				if cookie.HttpOnly != tt.httpOnly || cookie.Path != "/" || cookie.SameSite != http.SameSiteLaxMode {
+					t.Errorf("cookie %s = %q, want HttpOnly %v", cookie.Name, cookie.String(), tt.httpOnly)
+				}
+			}
+		})
+	}
+}
+
+func TestClearCookie(t *testing.T) {
+	app := newTestApp(t)
+	c, w := newTestContext(t, app, httptest.NewRequest(http.MethodGet, "/", nil))
+	c.ClearCookie("sid", &CookieOptions{Path: "/api"})
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("got %d cookies, want 1", len(cookies))
+	}
+	if cookie := cookies[0]; cookie.MaxAge != -1 || cookie.Path != "/api" || !cookie.Expires.Equal(time.Unix(0, 0)) {
+		t.Errorf("ClearCookie() = %q", cookie.String())
+	}
+}
+
+func TestSignedAndEncryptedCookie(t *testing.T) {
+	type cookieFuncs struct {
+		set func(c *Context, name, value string) error
+		get func(c *Context, name string) (string, error)
+	}
+	kinds := map[string]cookieFuncs{
+		"signed": {
+			func(c *Context, name, value string) error { return c.SetSignedCookie(name, value) },
+			func(c *Context, name string) (string, error) { return c.SignedCookie(name) },
+		},
+		"encrypted": {
+			func(c *Context, name, value string) error { return c.SetEncryptedCookie(name, value) },
+			func(c *Context, name string) (string, error) { return c.EncryptedCookie(name) },
+		},
+	}
+	tests := []struct {
+		name    string
+		setKeys []string
+		getKeys []string
+		modify  func(cookie *http.Cookie) // 修改客户端带回来的cookie
+		want    string
+		err     error
+	}{
+		{"round trip", []string{"k1"}, []string{"k1"}, nil, "user=1;a.b", nil},
+		{"old key still valid", []string{"k1"}, []string{"k2", "k1"}, nil, "user=1;a.b", nil},
+		{"removed key", []string{"k1"}, []string{"k2"}, nil, "", ErrInvalidCookie},
+		{"tampered value", []string{"k1"}, []string{"k1"}, tamperCookie, "", ErrInvalidCookie},
+		{"renamed cookie", []string{"k1"}, []string{"k1"}, func(cookie *http.Cookie) { cookie.Name = "other" }, "", http.ErrNoCookie},
+		{"not signed", []string{"k1"}, []string{"k1"}, func(cookie *http.Cookie) { cookie.Value = "plain" }, "", ErrInvalidCookie},
+	}
+	for kind, funcs := range kinds {
+		for _, tt := range tests {
+			t.Run(kind+" "+tt.name, func(t *testing.T) {
+				app := newTestApp(t, WithCookieConfig(&CookieConfig{Keys: tt.setKeys}))
+				c, w := newTestContext(t, app, httptest.NewRequest(http.MethodGet, "/", nil))
+				if err := funcs.set(c, "sid", "user=1;a.b"); err != nil {
+					t.Fatalf("set error = %v", err)
+				}
+				cookie := w.Result().Cookies()[0]
+				if cookie.Value == "user=1;a.b" {
+					t.Fatalf("cookie value is not encoded: %q", cookie.Value)
+				}
+				if tt.modify != nil {
+					tt.modify(cookie)
+				}
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.AddCookie(cookie)
+				app.SetCookieConfig(&CookieConfig{Keys: tt.getKeys})
+				c, _ = newTestContext(t, app, r)
+				got, err := funcs.get(c, "sid")
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("get error = %v, want %v", err, tt.err)
+				}
+				if got != tt.want {
+					t.Errorf("get = %q, want %q", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+// 修改cookie值的第一个字符
+func tamperCookie(cookie *http.Cookie) {
+	first := "A"
+	if cookie.Value[0] == 'A' {
+		first = "B"
+	}
+	cookie.Value = first + cookie.Value[1:]
+}
+
+func TestEncryptedCookieNameBinding(t *testing.T) {
+	app := newTestApp(t, WithCookieConfig(&CookieConfig{Keys: []string{"k1"}}))
+	c, w := newTestContext(t, app, httptest.NewRequest(http.MethodGet, "/", nil))
+	_ = c.SetEncryptedCookie("a", "v")
+	_ = c.SetSignedCookie("b", "v")
+	cookies := w.Result().Cookies()
+	// 把一个cookie的值用到另一个cookie上
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: "x", Value: cookies[0].Value})
+	r.AddCookie(&http.Cookie{Name: "y", Value: cookies[1].Value})
+	c, _ = newTestContext(t, app, r)
+	if _, err := c.EncryptedCookie("x"); !errors.Is(err, ErrInvalidCookie) {
+		t.Errorf("EncryptedCookie() error = %v, want ErrInvalidCookie", err)
+	}
+	if _, err := c.SignedCookie("y"); !errors.Is(err, ErrInvalidCookie) {
+		t.Errorf("SignedCookie() error = %v, want ErrInvalidCookie", err)
+	}
+}
+
+func TestCookieKeysNotSet(t *testing.T) {
+	app := newTestApp(t)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: "sid", Value: "v"})
+	c, _ := newTestContext(t, app, r)
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"SetSignedCookie", func() error { return c.SetSignedCookie("sid", "v") }},
+		{"SignedCookie", func() error { _, err := c.SignedCookie("sid"); return err }},
+		{"SetEncryptedCookie", func() error { return c.SetEncryptedCookie("sid", "v") }},
+		{"EncryptedCookie", func() error { _, err := c.EncryptedCookie("sid"); return err }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, ErrCookieKeysNotSet) {
+				t.Errorf("error = %v, want ErrCookieKeysNotSet", err)
+			}
+		})
+	}
+}
@@ -1,10 +1,25 @@
 package flow
 
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
 // CorsConfig 定义跨域配置
 type CorsConfig struct {
-	AllowOrigin    string
-	AllowedHeaders string
-	AllowedMethods string
+	Disable          bool                     // 是否关闭跨域支持，默认值false
+	AllowOrigin      string                   // 允许的源，多个用逗号分隔，没有设置AllowOrigins和AllowOriginFunc时默认值*
+	AllowOrigins     []string                 // 允许的源列表，支持通配子域名，如https://*.example.com，*表示允许所有的源
+	AllowOriginFunc  func(origin string) bool // 自定义的源校验方法，返回true表示允许，设置后不再校验AllowOrigin和AllowOrigins
+	AllowedHeaders   string                   // 允许的请求头，为空时返回预检请求的Access-Control-Request-Headers
+	AllowedMethods   string                   // 允许的请求方法，默认值GET, POST, HEAD, OPTIONS, PUT, PATCH, DELETE, TRACE
+	ExposeHeaders    string                   // 允许客户端读取的返回头，多个用逗号分隔
+	AllowCredentials bool                     // 是否允许携带cookie等凭证，开启后必须设置允许的源列表或者AllowOriginFunc，不能使用*
+	MaxAge           time.Duration            // 预检请求结果的缓存时间，默认值48小时，小于0时不返回
 }
 
 // 返回默认的跨域配置
@@ -12,5 +27,180 @@ func defCorsConfig() *CorsConfig {
 	return &CorsConfig{
 		AllowOrigin:    "*",
 		AllowedMethods: "GET, POST, HEAD, OPTIONS, PUT, PATCH, DELETE, TRACE",
+		MaxAge:         48 * time.Hour,
+	}
+}
+
+// 填充跨域配置的默认值
+func fillCorsConfig(corsConfig *CorsConfig) *CorsConfig {
+	if corsConfig == nil {
+		return defCorsConfig()
+	}
+	if len(corsConfig.AllowOrigin) == 0 && len(corsConfig.AllowOrigins) == 0 && corsConfig.AllowOriginFunc == nil {
+		corsConfig.AllowOrigin = defCorsConfig().AllowOrigin
+	}
+	if len(corsConfig.AllowedMethods) == 0 {
+		corsConfig.AllowedMethods = defCorsConfig().AllowedMethods
+	}
+	if corsConfig.MaxAge == 0 {
+		corsConfig.MaxAge = defCorsConfig().MaxAge
+	}
+	return corsConfig
+}
+
+// 校验跨域配置，允许携带凭证时必须设置明确的源列表或者AllowOriginFunc
+func (cc *CorsConfig) validate() error {
+	if cc.AllowCredentials && cc.AllowOriginFunc == nil && !cc.hasExplicitOrigins() {
+		// 允许携带凭证时返回任意的源会让所有网站都能读取带凭证的跨域请求
+		return errors.New("cors: AllowCredentials can not be used with the * origin, set AllowOrigins or AllowOriginFunc")
+	}
+	return nil
+}
+
+// 校验app和所有路由组的跨域配置，服务启动时调用
+func validateCorsConfigs(app *Application) error {
+	if err := app.corsConfig.validate(); err != nil {
+		return err
+	}
+	for _, rg := range app.corsGroups {
+		if err := rg.cors.validate(); err != nil {
+			return fmt.Errorf("router group %s: %w", rg.prefix, err)
+		}
+	}
+	return nil
+}
+
+// 返回AllowOrigin和AllowOrigins里所有的源
+func (cc *CorsConfig) originPatterns() []string {
+	patterns := make([]string, 0, len(cc.AllowOrigins))
+	for _, v := range cc.AllowOrigins {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			patterns = append(patterns, v)
+		}
+	}
+	for _, v := range strings.Split(cc.AllowOrigin, ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			patterns = append(patterns, v)
+		}
+	}
+	return patterns
+}
+
+// 判断是否设置了明确的源列表，没有设置或者包含*的返回false
+func (cc *CorsConfig) hasExplicitOrigins() bool {
+	patterns := cc.originPatterns()
+	for _, pattern := range patterns {
+		if pattern == "*" {
+			return false
+		}
+	}
+	return len(patterns) > 0
+}
+
+// 判断源是否允许跨域，返回Access-Control-Allow-Origin的值
+func (cc *CorsConfig) allowOrigin(origin string) (string, bool) {
+	if cc.AllowOriginFunc != nil {
+		if cc.AllowOriginFunc(origin) {
+			return origin, true
+		}
+		return "", false
+	}
+	for _, pattern := range cc.originPatterns() {
+		if pattern == "*" {
+			// 携带凭证时不能返回*，也不能返回任意的源
+			if cc.AllowCredentials {
+				continue
+			}
+			return "*", true
+		}
+		if matchOrigin(pattern, origin) {
+			return origin, true
+		}
+	}
+	return "", false
+}
+
+// 匹配源，支持一个*通配符，如https://*.example.com匹配https://api.example.com，不匹配https://example.com
+func matchOrigin(pattern, origin string) bool {
+	pattern, origin = strings.ToLower(pattern), strings.ToLower(origin)
+	prefix, suffix, wildcard := strings.Cut(pattern, "*")
+	if !wildcard {
+		return pattern == origin
+	}
+	return len(origin) > len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix)
+}
+
+// 判断是不是跨域的预检请求
+func isPreflight(ctx *Context) bool {
+	return ctx.GetMethod() == HttpMethodOptions && len(ctx.GetHeader(HttpHeaderOrigin)) > 0 &&
+		len(ctx.GetHeader(HttpHeaderCorsRequestMethod)) > 0
+}
+
+// Cors 设置路由组的跨域配置，覆盖父路由组和app的跨域配置，子路由组继承，配置在服务启动时校验
+func (rg *RouterGroup) Cors(corsConfig *CorsConfig) *RouterGroup {
+	if rg.cors == nil {
+		rg.app.corsGroups = append(rg.app.corsGroups, rg)
+	}
+	rg.cors = fillCorsConfig(corsConfig)
+	return rg
+}
+
+// 返回路由组生效的跨域配置，没有设置时使用父路由组的，都没有设置时使用app的
+func (rg *RouterGroup) corsConfig() *CorsConfig {
+	for g := rg; g != nil; g = g.parent {
+		if g.cors != nil {
+			return g.cors
+		}
+	}
+	return rg.app.corsConfig
+}
+
+// 跨域中间件，预检请求直接返回，不再执行后面的中间件和处理器
+func corsMiddleware(ctx *Context, next Next) {
+	cc := ctx.app.corsConfig
+	if ctx.group != nil {
+		cc = ctx.group.corsConfig()
+	}
+	origin := ctx.GetHeader(HttpHeaderOrigin)
+	if cc.Disable || len(origin) == 0 {
+		next()
+		return
+	}
+	ctx.res.addVary(HttpHeaderOrigin)
+	preflight := isPreflight(ctx)
+	if preflight {
+		ctx.res.addVary(HttpHeaderCorsRequestMethod)
+		ctx.res.addVary(HttpHeaderCorsRequestHeaders)
+	}
+	allowOrigin, ok := cc.allowOrigin(origin)
+	if !ok {
+		// 不允许的源不返回跨域头，由浏览器拒绝
+		if preflight {
+			ctx.SetStatus(http.StatusNoContent)
+			return
+		}
+		next()
+		return
+	}
+	ctx.SetHeader(HttpHeaderCorsOrigin, allowOrigin)
+	if cc.AllowCredentials {
+		ctx.SetHeader(HttpHeaderCorsCredentials, "true")
+	}
+	if !preflight {
+		if len(cc.ExposeHeaders) > 0 {
+			ctx.SetHeader(HttpHeaderCorsExposeHeaders, cc.ExposeHeaders)
+		}
+		next()
+		return
+	}
+	ctx.SetHeader(HttpHeaderCorsMethods, cc.AllowedMethods)
+	if len(cc.AllowedHeaders) > 0 {
+		ctx.SetHeader(HttpHeaderCorsHeaders, cc.AllowedHeaders)
+	} else if reqHeaders := ctx.GetHeader(HttpHeaderCorsRequestHeaders); len(reqHeaders) > 0 {
+		ctx.SetHeader(HttpHeaderCorsHeaders, reqHeaders)
+	}
+	if cc.MaxAge > 0 {
+		ctx.SetHeader(HttpHeaderCorsMaxAge, strconv.FormatInt(int64(cc.MaxAge.Seconds()), 10))
 	}
+	ctx.SetStatus(http.StatusNoContent)
 }
@@ -0,0 +1,176 @@
+package flow
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMatchOrigin(t *testing.T) {
+	tests := []struct {
+		pattern string
+		origin  string
+		want    bool
+	}{
+		{"https://example.com", "https://example.com", true},
+		{"https://example.com", "HTTPS://EXAMPLE.COM", true},
+		{"https://example.com", "http://example.com", false},
+		{"https://*.example.com", "https://api.example.com", true},
+		{"https://*.example.com", "https://a.b.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://evil-example.com", false},
+		{"https://*.example.com", "https://api.example.com.evil.io", false},
+	}
+	for _, tt := range tests {
+		if got := matchOrigin(tt.pattern, tt.origin); got != tt.want {
+			t.Errorf("matchOrigin(%q, %q) = %v, want %v", tt.pattern, tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestCorsConfigAllowOrigin(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *CorsConfig
+		origin string
+		want   string
+		ok     bool
+	}{
+		{"default any origin", nil, "https://a.com", "*", true},
+		{"comma separated list", &CorsConfig{AllowOrigin: "https://a.com, https://b.com"}, "https://b.com", "https://b.com", true},
+		{"not in list", &CorsConfig{AllowOrigin: "https://a.com"}, "https://evil.example", "", false},
+		{"wildcard subdomain", &CorsConfig{AllowOrigins: []string{"https://*.a.com"}}, "https://x.a.com", "https://x.a.com", true},
+		{"credentials echo listed origin", &CorsConfig{AllowOrigins: []string{"https://a.com"}, AllowCredentials: true}, "https://a.com", "https://a.com", true},
+		{"credentials reject other origin", &CorsConfig{AllowOrigins: []string{"https://a.com"}, AllowCredentials: true}, "https://evil.example", "", false},
+		{"origin func", &CorsConfig{AllowOriginFunc: func(origin string) bool { return strings.HasSuffix(origin, ".test") }}, "http://x.test", "http://x.test", true},
+		{"origin func reject", &CorsConfig{AllowOriginFunc: func(origin string) bool { return false }, AllowOrigin: "*"}, "http://x.test", "", false},
+		{"credentials with origin func", &CorsConfig{AllowOriginFunc: func(string) bool { return true }, AllowCredentials: true}, "http://x.test", "http://x.test", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := fillCorsConfig(tt.config).allowOrigin(tt.origin)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("allowOrigin(%q) = %q, %v, want %q, %v", tt.origin, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCorsCredentialsRequireExplicitOrigins(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *CorsConfig
+		wantErr bool
+	}{
+		{"no origins", &CorsConfig{AllowCredentials: true}, true},
+		{"star origin", &CorsConfig{AllowCredentials: true, AllowOrigin: "*"}, true},
+		{"star in list", &CorsConfig{AllowCredentials: true, AllowOrigins: []string{"https://a.com", "*"}}, true},
+		{"explicit list", &CorsConfig{AllowCredentials: true, AllowOrigins: []string{"https://a.com"}}, false},
+		{"origin func", &CorsConfig{AllowCredentials: true, AllowOriginFunc: func(string) bool { return true }}, false},
+		{"star without credentials", &CorsConfig{AllowOrigin: "*"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 设置配置时不校验，服务启动时返回错误
+			app := newTestApp(t, WithCorsConfig(tt.config))
+			if err := app.GetCorsConfig().validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			app = newTestApp(t)
+			app.Group("/api").Cors(tt.config)
+			err := validateCorsConfigs(app)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateCorsConfigs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.HasPrefix(err.Error(), "router group /api: cors:") {
+				t.Errorf("error = %v", err)
+			}
+		})
+	}
+}
+
+func TestRunCorsError(t *testing.T) {
+	app := newTestApp(t, WithCorsConfig(&CorsConfig{AllowCredentials: true}))
+	started := false
+	app.AddAfterStart(func(app *Application) {
+		started = true
+	})
+	if err := app.Run(); err == nil || !strings.HasPrefix(err.Error(), "cors:") {
+		t.Errorf("Run() error = %v, want cors error", err)
+	}
+	if started {
+		t.Error("server started with invalid cors config")
+	}
+	// 没有校验的配置也不会返回任意的源
+	app.GET("/", func(ctx *Context) {
+		ctx.Text("ok")
+	})
+	w := serve(app, http.MethodGet, "/", nil, HttpHeaderOrigin, "https://evil.example")
+	if got := w.Header().Get(HttpHeaderCorsOrigin); got != "" {
+		t.Errorf("%s = %q, want empty", HttpHeaderCorsOrigin, got)
+	}
+}
+
+func TestCorsMiddleware(t *testing.T) {
+	app := newTestApp(t, WithCorsConfig(&CorsConfig{
+		AllowOrigins:     []string{"https://a.com"},
+		AllowCredentials: true,
+		ExposeHeaders:    "X-Total",
+		MaxAge:           -1,
+	}))
+	handled := false
+	app.GET("/users", func(ctx *Context) {
+		handled = true
+		ctx.Text("ok")
+	})
+	app.Group("/open").Cors(&CorsConfig{AllowOrigin: "*", AllowedHeaders: "X-Token"}).GET("/ping", func(ctx *Context) {
+		ctx.Text("pong")
+	})
+	app.Group("/off").Cors(&CorsConfig{Disable: true}).GET("/ping", func(ctx *Context) {
+		ctx.Text("pong")
+	})
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		header      []string
+		status      int
+		handled     bool
+		wantHeaders map[string]string // 值为空表示不应该有这个返回头
+	}{
+		{"simple allowed", http.MethodGet, "/users", []string{HttpHeaderOrigin, "https://a.com"}, http.StatusOK, true, map[string]string{
+			HttpHeaderCorsOrigin: "https://a.com", HttpHeaderCorsCredentials: "true", HttpHeaderCorsExposeHeaders: "X-Total", HttpHeaderVary: HttpHeaderOrigin,
+		}},
+		{"simple not allowed", http.MethodGet, "/users", []string{HttpHeaderOrigin, "https://evil.example"}, http.StatusOK, true, map[string]string{
+			HttpHeaderCorsOrigin: "", HttpHeaderCorsCredentials: "",
+		}},
+		{"no origin", http.MethodGet, "/users", nil, http.StatusOK, true, map[string]string{HttpHeaderCorsOrigin: "", HttpHeaderVary: ""}},
+		{"preflight allowed", http.MethodOptions, "/users", []string{HttpHeaderOrigin, "https://a.com", HttpHeaderCorsRequestMethod, "GET", HttpHeaderCorsRequestHeaders, "X-A"},
+			http.StatusNoContent, false, map[string]string{
+				HttpHeaderCorsOrigin: "https://a.com", HttpHeaderCorsHeaders: "X-A", HttpHeaderCorsMaxAge: "",
+			}},
+		{"preflight not allowed", http.MethodOptions, "/users", []string{HttpHeaderOrigin, "https://evil.example", HttpHeaderCorsRequestMethod, "GET"},
+			http.StatusNoContent, false, map[string]string{HttpHeaderCorsOrigin: "", HttpHeaderCorsMethods: ""}},
+		{"group override", http.MethodOptions, "/open/ping", []string{HttpHeaderOrigin, "https://evil.example", HttpHeaderCorsRequestMethod, "GET"},
+			http.StatusNoContent, false, map[string]string{HttpHeaderCorsOrigin: "*", HttpHeaderCorsHeaders: "X-Token", HttpHeaderCorsMaxAge: "172800", HttpHeaderCorsCredentials: ""}},
+		{"group disabled", http.MethodGet, "/off/ping", []string{HttpHeaderOrigin, "https://a.com"}, http.StatusOK, false, map[string]string{HttpHeaderCorsOrigin: ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handled = false
+			w := serve(app, tt.method, tt.path, nil, tt.header...)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.path == "/users" && handled != tt.handled {
+				t.Errorf("handled = %v, want %v", handled, tt.handled)
+			}
+			for k, v := range tt.wantHeaders {
+				if got := w.Header().Get(k); got != v {
+					t.Errorf("header %s = %q, want %q", k, got, v)
+				}
+			}
+		})
+	}
+}
@@ -1,25 +1,84 @@
 package flow
 
 import (
-	"github.com/funswe/flow/utils/json"
-	"github.com/go-resty/resty/v2"
-	"go.uber.org/zap"
+	"context"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"sort"
 	"strings"
 	"time"
+
+	"github.com/funswe/flow/utils/json"
+	"github.com/go-resty/resty/v2"
+	"go.uber.org/zap"
 )
 
 // CurlConfig 定义httpclient配置
 type CurlConfig struct {
-	Timeout time.Duration     // 请求的超时时间，单位秒
-	Headers map[string]string // 统一请求的头信息
+	BaseURL        string             // 请求地址的前缀，请求地址不是http://或者https://开头时拼接在前面
+	Timeout        time.Duration      // 每次请求的超时时间，单位秒
+	Headers        map[string]string  // 统一请求的头信息
+	Retry          *CurlRetryConfig   // 失败重试配置，为空时不重试
+	Breaker        *CurlBreakerConfig // 按域名熔断配置，为空时不熔断
+	Transport      http.RoundTripper  `json:"-"` // 发送请求的RoundTripper，为空时根据下面的TLS，代理和连接池配置创建，测试时可以使用curltest包的mock或者录制回放
+	RedactHeaders  []string           // 日志里隐藏的请求头和返回头，不区分大小写，默认值Authorization，Proxy-Authorization，Cookie，Set-Cookie
+	RedactFields   []string           // 日志里隐藏的json实体，form参数和query参数的字段，不区分大小写，默认值password，secret，token，access_token，refresh_token
+	MaxLogBodySize int                // 日志里打印的实体最大字节数，超过的部分截断，默认值1024，小于0时不打印实体
+
+	// 下面的配置在没有设置Transport时生效
+	TLS                 *CurlTLSConfig // TLS配置，如自定义的CA和mTLS客户端证书
+	Proxy               string         // 代理地址，如http://127.0.0.1:8080，为空时使用环境变量HTTP_PROXY，HTTPS_PROXY和NO_PROXY
+	DialTimeout         time.Duration  // 建立连接的超时时间，默认值30秒
+	KeepAlive           time.Duration  // TCP keep-alive的间隔，默认值30秒，小于0时关闭
+	DisableKeepAlives   bool           // 是否关闭http keep-alive，关闭后每个请求使用新的连接
+	TLSHandshakeTimeout time.Duration  // TLS握手的超时时间，默认值10秒
+	MaxIdleConns        int            // 所有域名最多的空闲连接数，默认值100
+	MaxIdleConnsPerHost int            // 每个域名最多的空闲连接数，默认值10
+	MaxConnsPerHost     int            // 每个域名最多的连接数，包括正在使用的连接，默认值0不限制
+	IdleConnTimeout     time.Duration  // 空闲连接的超时时间，默认值90秒
 }
 
 // 返回默认的httpclient配置
 func defCurlConfig() *CurlConfig {
 	return &CurlConfig{
-		Timeout: 10 * time.Second, // 默认10秒超时时间
+		Timeout:        10 * time.Second, // 默认10秒超时时间
+		RedactHeaders:  []string{HttpHeaderAuthorization, "Proxy-Authorization", "Cookie", "Set-Cookie"},
+		RedactFields:   []string{"password", "secret", "token", "access_token", "refresh_token"},
+		MaxLogBodySize: 1024,
+	}
+}
+
+// 填充httpclient配置的默认值
+func fillCurlConfig(curlConfig *CurlConfig) *CurlConfig {
+	if curlConfig == nil {
+		curlConfig = defCurlConfig()
+	}
+	if curlConfig.RedactHeaders == nil {
+		curlConfig.RedactHeaders = defCurlConfig().RedactHeaders
+	}
+	if curlConfig.RedactFields == nil {
+		curlConfig.RedactFields = defCurlConfig().RedactFields
+	}
+	if curlConfig.MaxLogBodySize == 0 {
+		curlConfig.MaxLogBodySize = defCurlConfig().MaxLogBodySize
+	}
+	curlConfig.Retry = fillCurlRetryConfig(curlConfig.Retry)
+	curlConfig.Breaker = fillCurlBreakerConfig(curlConfig.Breaker)
+	fillCurlTransportConfig(curlConfig)
+	return curlConfig
+}
+
+// 拼接BaseURL和请求地址，请求地址是完整的地址时不拼接
+func (curlConfig *CurlConfig) resolveURL(rawURL string) string {
+	if len(curlConfig.BaseURL) == 0 || strings.HasPrefix(rawURL, "http://") || strings.HasPrefix(rawURL, "https://") {
+		return rawURL
+	}
+	if len(rawURL) == 0 {
+		return curlConfig.BaseURL
 	}
+	return strings.TrimSuffix(curlConfig.BaseURL, "/") + "/" + strings.TrimPrefix(rawURL, "/")
 }
 
 // CurlResult 定义返回的结果
@@ -32,80 +91,575 @@ func (cr *CurlResult) Parse(v interface{}) error {
 	return json.Unmarshal(cr.Body(), v)
 }
 
-// Curl 定义httpclient对象
+// 错误信息里最多保存的返回实体长度
+const curlErrorBodyLimit = 4 << 10
+
+// CurlStatusError 定义上游返回非2xx状态码的错误
+type CurlStatusError struct {
+	Method string      // 请求方法
+	URL    string      // 请求地址
+	Status int         // 返回的状态码
+	Header http.Header // 返回的头信息
+	Body   []byte      // 返回的实体，最多保存4KB
+	Result interface{} // CurlRequest.ErrorInto设置的对象，返回实体解码成功时才有
+}
+
+func (e *CurlStatusError) Error() string {
+	body := e.Body
+	if len(body) > 256 {
+		body = body[:256]
+	}
+	return fmt.Sprintf("curl %s %s: status %d: %s", e.Method, e.URL, e.Status, strings.TrimSpace(string(body)))
+}
+
+// StatusError 返回状态码不是2xx时返回*CurlStatusError，否则返回nil
+func (cr *CurlResult) StatusError() error {
+	if cr.IsSuccess() {
+		return nil
+	}
+	body := cr.Body()
+	if len(body) > curlErrorBodyLimit {
+		body = body[:curlErrorBodyLimit]
+	}
+	return &CurlStatusError{
+		Method: cr.Request.Method,
+		URL:    cr.Request.URL,
+		Status: cr.StatusCode(),
+		Header: cr.Header(),
+		Body:   body,
+	}
+}
+
+// CurlJSON 发送请求，2xx的返回实体使用json解码成T，其他状态码返回*CurlStatusError，
+// 请求设置了ErrorInto时，非2xx的返回实体解码到给定的对象并保存在CurlStatusError.Result，
+// 没有设置Accept请求头时使用application/json，不会修改传入的请求
+func CurlJSON[T any](ctx context.Context, req *CurlRequest) (T, error) {
+	var result T
+	if !req.hasHeader(HttpHeaderAccept) {
+		r := *req
+		r.headers = make(map[string]string, len(req.headers)+1)
+		for k, v := range req.headers {
+			r.headers[k] = v
+		}
+		r.headers[HttpHeaderAccept] = MIMEJson
+		req = &r
+	}
+	res, err := req.Do(ctx)
+	if err != nil {
+		return result, err
+	}
+	if err = res.StatusError(); err != nil {
+		statusError := err.(*CurlStatusError)
+		if req.errorResult != nil && json.Unmarshal(res.Body(), req.errorResult) == nil {
+			statusError.Result = req.errorResult
+		}
+		return result, statusError
+	}
+	if len(res.Body()) == 0 {
+		return result, nil
+	}
+	if err = json.Unmarshal(res.Body(), &result); err != nil {
+		return result, fmt.Errorf("curl %s %s: decode response: %w", req.method, req.url, err)
+	}
+	return result, nil
+}
+
+// Curl 定义httpclient对象，ctx.Curl绑定了当前请求，请求结束或者取消时发出的请求也会取消
 type Curl struct {
-	app    *Application
-	client *resty.Client
+	app      *Application
+	config   *CurlConfig // httpclient配置，命名的httpclient使用自己的配置
+	client   *resty.Client
+	breakers *curlBreakers     // 每个域名的熔断器
+	ctx      context.Context   // 绑定的context，Get，Post等方法和Send使用
+	logger   *zap.Logger       // 打印日志的logger对象，绑定请求时使用请求的logger
+	headers  map[string]string // 绑定请求时转发的请求头，如X-Request-Id
 }
 
-func (c *Curl) Get(url string, data map[string]string, headers map[string]string) (*CurlResult, error) {
-	c.app.Logger.Debug("curl request start", zap.String("method", "get"),
-		zap.String("url", url), zap.Any("data", data), zap.Any("headers", headers))
-	r := c.client.R().SetHeaders(c.app.curlConfig.Headers)
-	if data != nil {
-		r.SetQueryParams(data)
+// WithContext 返回绑定了给定context的Curl对象，Get，Post等方法和Send使用该context
+func (c *Curl) WithContext(ctx context.Context) *Curl {
+	bound := *c
+	bound.ctx = ctx
+	return &bound
+}
+
+// 返回绑定了当前请求的Curl对象，使用请求的context和logger，并转发X-Request-Id请求头
+func (c *Curl) bind(ctx *Context) *Curl {
+	if c == nil {
+		return nil
+	}
+	bound := *c
+	bound.ctx = ctx.Context()
+	bound.logger = ctx.Logger
+	bound.headers = map[string]string{HttpHeaderXRequestId: ctx.GetRequestId()}
+	return &bound
+}
+
+// 定义multipart上传的文件
+type curlFile struct {
+	field    string
+	fileName string
+	reader   io.Reader
+	path     string
+}
+
+// CurlRequest 定义请求构造器，通过Curl.R()创建，Do发送请求
+type CurlRequest struct {
+	curl        *Curl
+	method      string
+	url         string
+	query       map[string]string
+	headers     map[string]string
+	body        interface{}
+	form        map[string]string
+	files       []curlFile
+	username    string
+	password    string
+	timeout     time.Duration
+	attempts    int         // 最多请求的次数，0表示使用重试配置
+	errorResult interface{} // 非2xx时解码返回实体的对象
+	route       string      // 指标里的路由名称，为空时指标只按域名统计
+}
+
+// R 创建请求构造器，默认的请求方法是GET
+func (c *Curl) R() *CurlRequest {
+	return &CurlRequest{
+		curl:    c,
+		method:  http.MethodGet,
+		query:   make(map[string]string),
+		headers: make(map[string]string),
+	}
+}
+
+// Method 设置请求方法，如http.MethodPut
+func (cr *CurlRequest) Method(method string) *CurlRequest {
+	cr.method = strings.ToUpper(method)
+	return cr
+}
+
+// URL 设置请求地址
+func (cr *CurlRequest) URL(url string) *CurlRequest {
+	cr.url = url
+	return cr
+}
+
+// Query 添加query参数
+func (cr *CurlRequest) Query(params map[string]string) *CurlRequest {
+	for k, v := range params {
+		cr.query[k] = v
+	}
+	return cr
+}
+
+// Header 设置请求头，覆盖CurlConfig.Headers里相同的请求头
+func (cr *CurlRequest) Header(key, value string) *CurlRequest {
+	cr.headers[key] = value
+	return cr
+}
+
+// Headers 批量设置请求头
+func (cr *CurlRequest) Headers(headers map[string]string) *CurlRequest {
+	for k, v := range headers {
+		cr.headers[k] = v
+	}
+	return cr
+}
+
+// Body 设置请求实体，可以是string，[]byte，io.Reader，map或者结构体，map和结构体默认使用json编码
+func (cr *CurlRequest) Body(body interface{}) *CurlRequest {
+	cr.body = body
+	return cr
+}
+
+// JSON 设置json编码的请求实体
+func (cr *CurlRequest) JSON(body interface{}) *CurlRequest {
+	cr.headers[HttpHeaderContentType] = MIMEJson
+	cr.body = body
+	return cr
+}
+
+// Form 设置form参数，没有上传文件时使用application/x-www-form-urlencoded编码，否则使用multipart/form-data编码
+func (cr *CurlRequest) Form(data map[string]string) *CurlRequest {
+	if cr.form == nil {
+		cr.form = make(map[string]string)
 	}
-	if len(headers) > 0 {
-		r.SetHeaders(headers)
+	for k, v := range data {
+		cr.form[k] = v
 	}
-	res, err := r.Get(url)
+	return cr
+}
+
+// File 添加上传的文件，使用multipart/form-data编码
+func (cr *CurlRequest) File(field, fileName string, reader io.Reader) *CurlRequest {
+	cr.files = append(cr.files, curlFile{field: field, fileName: fileName, reader: reader})
+	return cr
+}
+
+// FilePath 添加上传的本地文件，使用multipart/form-data编码
+func (cr *CurlRequest) FilePath(field, path string) *CurlRequest {
+	cr.files = append(cr.files, curlFile{field: field, path: path})
+	return cr
+}
+
+// BasicAuth 设置basic认证
+func (cr *CurlRequest) BasicAuth(username, password string) *CurlRequest {
+	cr.username, cr.password = username, password
+	return cr
+}
+
+// Timeout 设置请求的超时时间，覆盖CurlConfig.Timeout
+func (cr *CurlRequest) Timeout(timeout time.Duration) *CurlRequest {
+	cr.timeout = timeout
+	return cr
+}
+
+// Retry 设置最多请求的次数，包括第一次请求，覆盖重试配置，非幂等的请求也会重试，1表示不重试
+func (cr *CurlRequest) Retry(maxAttempts int) *CurlRequest {
+	cr.attempts = maxAttempts
+	return cr
+}
+
+// Route 设置指标里的路由名称，如/users/:id，没有设置时route标签为空，只按域名统计，
+// 不使用地址的路径是因为路径里的ID和token等变量会让指标无限增长
+func (cr *CurlRequest) Route(route string) *CurlRequest {
+	cr.route = route
+	return cr
+}
+
+// ErrorInto 设置非2xx时解码返回实体的对象，用于上游返回结构化错误的场景，v必须是指针，配合CurlJSON使用
+func (cr *CurlRequest) ErrorInto(v interface{}) *CurlRequest {
+	cr.errorResult = v
+	return cr
+}
+
+// 返回最多请求的次数，流式的请求实体只能发送一次
+func (cr *CurlRequest) maxAttempts() int {
+	if _, ok := cr.body.(io.Reader); ok {
+		return 1
+	}
+	for _, f := range cr.files {
+		if f.reader != nil {
+			return 1
+		}
+	}
+	if cr.attempts > 0 {
+		return cr.attempts
+	}
+	retryConfig := cr.curl.config.Retry
+	if retryConfig == nil || (!retryConfig.RetryNonIdempotent && !isIdempotentMethod(cr.method)) {
+		return 1
+	}
+	return retryConfig.MaxAttempts
+}
+
+// 判断是否设置了给定的请求头，包括统一的请求头和转发的请求头，不区分大小写
+func (cr *CurlRequest) hasHeader(key string) bool {
+	for k := range cr.logHeaders() {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// 返回打印日志的请求头，包括统一的请求头和转发的请求头
+func (cr *CurlRequest) logHeaders() map[string]string {
+	headers := make(map[string]string, len(cr.curl.config.Headers)+len(cr.curl.headers)+len(cr.headers))
+	for _, h := range []map[string]string{cr.curl.config.Headers, cr.curl.headers, cr.headers} {
+		for k, v := range h {
+			headers[k] = v
+		}
+	}
+	return headers
+}
+
+// 创建resty请求，每次重试都重新创建
+func (cr *CurlRequest) build(ctx context.Context) *resty.Request {
+	c := cr.curl
+	r := c.client.R().SetContext(ctx).SetHeaders(c.config.Headers).SetHeaders(c.headers).SetHeaders(cr.headers)
+	if len(cr.query) > 0 {
+		r.SetQueryParams(cr.query)
+	}
+	if len(cr.username) > 0 {
+		r.SetBasicAuth(cr.username, cr.password)
+	}
+	switch {
+	case len(cr.files) > 0:
+		r.SetMultipartFormData(cr.form)
+		for _, f := range cr.files {
+			if len(f.path) > 0 {
+				r.SetFile(f.field, f.path)
+			} else {
+				r.SetFileReader(f.field, f.fileName, f.reader)
+			}
+		}
+	case cr.form != nil:
+		r.SetFormData(cr.form)
+	case cr.body != nil:
+		r.SetBody(cr.body)
+	}
+	return r
+}
+
+// 返回打印日志的请求实体，隐藏敏感字段并截断
+func (cr *CurlRequest) logBody() string {
+	curlConfig := cr.curl.config
+	var body interface{}
+	switch {
+	case len(cr.files) > 0:
+		fileNames := make([]string, 0, len(cr.files))
+		for _, f := range cr.files {
+			if len(f.path) > 0 {
+				fileNames = append(fileNames, f.path)
+			} else {
+				fileNames = append(fileNames, f.fileName)
+			}
+		}
+		body = map[string]interface{}{"form": curlConfig.redactValues(cr.form), "files": fileNames}
+	case cr.form != nil:
+		body = curlConfig.redactValues(cr.form)
+	default:
+		switch b := cr.body.(type) {
+		case nil:
+			return ""
+		case string:
+			return curlConfig.logBody([]byte(b))
+		case []byte:
+			return curlConfig.logBody(b)
+		case io.Reader:
+			return "[stream]"
+		}
+		body = cr.body
+	}
+	data, err := json.Marshal(body)
 	if err != nil {
-		c.app.Logger.Error("curl request end", zap.Error(err))
-		return nil, err
+		return ""
+	}
+	return curlConfig.logBody(data)
+}
+
+// 发送一次请求，超时时间作用于每次请求，开启熔断时记录请求结果，开启指标时记录请求的次数和耗时
+func (cr *CurlRequest) execute(ctx context.Context, cb *circuitBreaker, host, route string) (res *resty.Response, err error) {
+	start := time.Now()
+	defer func() {
+		status := 0
+		if err == nil {
+			status = res.StatusCode()
+		}
+		cr.curl.app.Metrics.observeClient(cr.method, host, route, status, time.Since(start), err)
+	}()
+	var done func(success bool)
+	if cb != nil {
+		if done, err = cb.allow(); err != nil {
+			return nil, err
+		}
+	}
+	timeout := cr.timeout
+	if timeout <= 0 {
+		timeout = cr.curl.config.Timeout
+	}
+	attemptCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
-	showBody := false
-	if strings.HasPrefix(res.Header().Get(HttpHeaderContentType), "application/json") || strings.HasPrefix(res.Header().Get(HttpHeaderContentType), "text") {
-		showBody = true
+	res, err = cr.build(attemptCtx).Execute(cr.method, cr.url)
+	if done != nil {
+		// 调用方取消的请求不计入熔断
+		if ctx.Err() != nil {
+			done(true)
+		} else {
+			done(err == nil && res.StatusCode() < http.StatusInternalServerError)
+		}
+	}
+	return res, err
+}
+
+// Send 使用Curl对象绑定的context发送请求，ctx.Curl发出的请求在客户端断开时会取消
+func (cr *CurlRequest) Send() (*CurlResult, error) {
+	return cr.Do(cr.curl.ctx)
+}
+
+// Do 发送请求，ctx取消时请求也会取消，开启重试时失败的请求会按指数退避重试
+func (cr *CurlRequest) Do(ctx context.Context) (*CurlResult, error) {
+	c := cr.curl
+	curlConfig := c.config
+	cr.url = curlConfig.resolveURL(cr.url)
+	logURL := curlConfig.redactURL(cr.url)
+	c.logger.Debug("curl request start", zap.String("method", cr.method), zap.String("url", logURL),
+		zap.Any("query", curlConfig.redactValues(cr.query)), zap.String("data", cr.logBody()), zap.Any("headers", curlConfig.redactHeaders(cr.logHeaders())))
+	var cb *circuitBreaker
+	host, route := "", cr.route
+	if u, err := url.Parse(cr.url); err == nil {
+		host = u.Host
+		cb = c.breaker(host)
+	}
+	retryConfig := c.config.Retry
+	if retryConfig == nil {
+		retryConfig = fillCurlRetryConfig(&CurlRetryConfig{})
+	}
+	maxAttempts := cr.maxAttempts()
+	var res *resty.Response
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		res, err = cr.execute(ctx, cb, host, route)
+		status := 0
+		if err == nil {
+			status = res.StatusCode()
+		}
+		if attempt >= maxAttempts || !retryConfig.shouldRetry(ctx, status, err) {
+			break
+		}
+		backoff := retryConfig.backoff(attempt)
+		c.logger.Warn("curl request retry", zap.String("method", cr.method), zap.String("url", logURL),
+			zap.Int("attempt", attempt), zap.Int("StatusCode", status), zap.Error(err), zap.Duration("backoff", backoff))
+		if sleepErr := sleepContext(ctx, backoff); sleepErr != nil {
+			break
+		}
+	}
+	if err != nil {
+		c.logger.Error("curl request end", zap.String("method", cr.method), zap.String("url", logURL),
+			zap.Int("attempts", attempt), zap.Error(err))
+		return nil, err
 	}
-	if showBody {
-		c.app.Logger.Debug("curl request end", zap.Int("StatusCode", res.StatusCode()),
-			zap.String("CostTime", res.Time().String()), zap.String("body", res.String()))
+	c.logger.Info("curl request end", zap.String("method", cr.method), zap.String("url", logURL),
+		zap.Int("StatusCode", res.StatusCode()), zap.String("CostTime", res.Time().String()), zap.Int("attempts", attempt))
+	contentType := res.Header().Get(HttpHeaderContentType)
+	if strings.HasPrefix(contentType, MIMEJson) || strings.HasPrefix(contentType, "text") {
+		c.logger.Debug("curl response", zap.Any("headers", curlConfig.redactHeader(res.Header())),
+			zap.String("body", curlConfig.logBody(res.Body())))
 	} else {
-		c.app.Logger.Debug("curl request end", zap.Int("StatusCode", res.StatusCode()),
-			zap.String("CostTime", res.Time().String()))
+		c.logger.Debug("curl response", zap.Any("headers", curlConfig.redactHeader(res.Header())))
 	}
 	return &CurlResult{res}, nil
 }
 
+func (c *Curl) Get(url string, data map[string]string, headers map[string]string) (*CurlResult, error) {
+	return c.R().URL(url).Query(data).Headers(headers).Send()
+}
+
+func (c *Curl) Head(url string, data map[string]string, headers map[string]string) (*CurlResult, error) {
+	return c.R().Method(http.MethodHead).URL(url).Query(data).Headers(headers).Send()
+}
+
 func (c *Curl) Post(url string, data interface{}, headers map[string]string) (*CurlResult, error) {
-	c.app.Logger.Debug("curl request start", zap.String("method", "post"),
-		zap.String("url", url), zap.Any("data", data), zap.Any("headers", headers))
-	r := c.client.R().SetHeaders(c.app.curlConfig.Headers)
-	if data != nil {
-		r.SetBody(data)
+	return c.R().Method(http.MethodPost).URL(url).Body(data).Headers(headers).Send()
+}
+
+func (c *Curl) Put(url string, data interface{}, headers map[string]string) (*CurlResult, error) {
+	return c.R().Method(http.MethodPut).URL(url).Body(data).Headers(headers).Send()
+}
+
+func (c *Curl) Patch(url string, data interface{}, headers map[string]string) (*CurlResult, error) {
+	return c.R().Method(http.MethodPatch).URL(url).Body(data).Headers(headers).Send()
+}
+
+func (c *Curl) Delete(url string, data interface{}, headers map[string]string) (*CurlResult, error) {
+	return c.R().Method(http.MethodDelete).URL(url).Body(data).Headers(headers).Send()
+}
+
+// 使用给定的配置创建Curl对象
+func newCurl(app *Application, curlConfig *CurlConfig) (*Curl, error) {
+	transport, err := newCurlTransport(curlConfig)
+	if err != nil {
+		return nil, err
 	}
-	if len(headers) > 0 {
-		r.SetHeaders(headers)
+	logger := app.Logger
+	if logger == nil {
+		logger = getLogger(app, nil)
 	}
-	res, err := r.Post(url)
+	return &Curl{
+		app:    app,
+		config: curlConfig,
+		// 超时时间在每个请求的context上设置，请求可以设置比默认值更长的超时时间
+		client:   resty.NewWithClient(&http.Client{Transport: transport}),
+		breakers: &curlBreakers{logger: logger, breakers: make(map[string]*circuitBreaker)},
+		ctx:      context.Background(),
+		logger:   logger,
+	}, nil
+}
+
+// NewCurl 使用app的httpclient配置创建Curl对象，服务启动时会自动创建，测试时可以直接创建后赋值给app.Curl，
+// TLS证书等配置错误时panic
+func NewCurl(app *Application) *Curl {
+	c, err := newCurl(app, app.curlConfig)
 	if err != nil {
-		c.app.Logger.Error("curl request end", zap.Error(err))
-		return nil, err
+		panic(err)
 	}
-	showBody := false
-	if strings.HasPrefix(res.Header().Get(HttpHeaderContentType), "application/json") || strings.HasPrefix(res.Header().Get(HttpHeaderContentType), "text") {
-		showBody = true
+	return c
+}
+
+// SetCurlClientConfig 设置命名的httpclient配置，每个httpclient有自己的BaseURL，请求头，TLS和连接池，通过CurlFor获取
+func (app *Application) SetCurlClientConfig(name string, curlConfig *CurlConfig) *Application {
+	app.curlClientsLock.Lock()
+	defer app.curlClientsLock.Unlock()
+	if app.curlClientConfigs == nil {
+		app.curlClientConfigs = make(map[string]*CurlConfig)
 	}
-	if showBody {
-		c.app.Logger.Debug("curl request end", zap.Int("StatusCode", res.StatusCode()),
-			zap.String("CostTime", res.Time().String()), zap.String("body", res.String()))
-	} else {
-		c.app.Logger.Debug("curl request end", zap.Int("StatusCode", res.StatusCode()),
-			zap.String("CostTime", res.Time().String()))
+	app.curlClientConfigs[name] = fillCurlConfig(curlConfig)
+	delete(app.curlClients, name)
+	return app
+}
+
+// GetCurlClientConfig 获取命名的httpclient配置
+func (app *Application) GetCurlClientConfig(name string) *CurlConfig {
+	app.curlClientsLock.Lock()
+	defer app.curlClientsLock.Unlock()
+	return app.curlClientConfigs[name]
+}
+
+// CurlFor 获取命名的httpclient，没有设置配置时panic
+func (app *Application) CurlFor(name string) *Curl {
+	c, err := app.curlClient(name)
+	if err != nil {
+		panic(err)
 	}
-	return &CurlResult{res}, nil
+	return c
 }
 
-// 初始化httpclient对象
+// 获取命名的httpclient，第一次获取时创建
+func (app *Application) curlClient(name string) (*Curl, error) {
+	app.curlClientsLock.Lock()
+	defer app.curlClientsLock.Unlock()
+	if c, ok := app.curlClients[name]; ok {
+		return c, nil
+	}
+	curlConfig, ok := app.curlClientConfigs[name]
+	if !ok {
+		return nil, fmt.Errorf("curl client %s is not configured, use SetCurlClientConfig first", name)
+	}
+	c, err := newCurl(app, curlConfig)
+	if err != nil {
+		return nil, fmt.Errorf("curl client %s: %w", name, err)
+	}
+	if app.curlClients == nil {
+		app.curlClients = make(map[string]*Curl)
+	}
+	app.curlClients[name] = c
+	return c, nil
+}
+
+// CurlFor 获取绑定了当前请求的命名httpclient，没有设置配置时panic
+func (c *Context) CurlFor(name string) *Curl {
+	return c.app.CurlFor(name).bind(c)
+}
+
+// 初始化httpclient对象，包括所有命名的httpclient
 func initCurl(app *Application) {
-	if app.curlConfig == nil {
-		return
+	if app.curlConfig != nil {
+		app.Curl = NewCurl(app)
+		app.Logger.Info("curl server started", zap.Any("config", app.curlConfig.logConfig()))
+	}
+	app.curlClientsLock.Lock()
+	names := make([]string, 0, len(app.curlClientConfigs))
+	for name := range app.curlClientConfigs {
+		names = append(names, name)
 	}
-	app.Curl = &Curl{
-		app: app,
-		client: resty.NewWithClient(&http.Client{
-			Timeout: app.curlConfig.Timeout,
-		}),
+	app.curlClientsLock.Unlock()
+	sort.Strings(names)
+	for _, name := range names {
+		c := app.CurlFor(name)
+		app.Logger.Info("curl client started", zap.String("name", name), zap.Any("config", c.config.logConfig()))
 	}
-	app.Logger.Info("curl server started", zap.Any("config", app.curlConfig))
 }
@@ -0,0 +1,587 @@
+package flow
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/funswe/flow/curltest"
+)
+
+// 记录请求头的RoundTripper，请求的context取消时返回context的错误
+func headerTransport(header *http.Header) http.RoundTripper {
+	return roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if err := r.Context().Err(); err != nil {
+			return nil, err
+		}
+		*header = r.Header.Clone()
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("")), Request: r}, nil
+	})
+}
+
+func TestValidRequestId(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"", false},
+		{"abc-123_DEF.4:5", true},
+		{strings.Repeat("a", 128), true},
+		{strings.Repeat("a", 129), false},
+		{"a\r\nX-Injected: 1", false},
+		{"a b", false},
+		{"中文", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			if got := validRequestId(tt.id); got != tt.want {
+				t.Errorf("validRequestId(%q) = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContextCurlRequestId(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestId string
+		forwarded bool // 是否转发客户端传入的请求ID
+	}{
+		{"no request id", "", false},
+		{"valid request id", "client-id-1", true},
+		{"invalid charset", "a\r\nb", false},
+		{"too long", strings.Repeat("a", 200), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var header http.Header
+			app := newTestApp(t, WithCurlConfig(&CurlConfig{Transport: headerTransport(&header)}))
+			initCurl(app)
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if len(tt.requestId) > 0 {
+				r.Header[HttpHeaderXRequestId] = []string{tt.requestId}
+			}
+			c, _ := newTestContext(t, app, r)
+			if _, err := c.Curl.Get("http://upstream.test", nil, nil); err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			got := header.Get(HttpHeaderXRequestId)
+			want := c.req.id
+			if tt.forwarded {
+				want = tt.requestId
+			}
+			if got != want || got != c.GetRequestId() {
+				t.Errorf("X-Request-Id = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestContextCurlBinding(t *testing.T) {
+	var header http.Header
+	app := newTestApp(t, WithCurlConfig(&CurlConfig{Transport: headerTransport(&header)}))
+	initCurl(app)
+	reqCtx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(reqCtx)
+	c, _ := newTestContext(t, app, r)
+	// 使用请求的logger，不修改全局的Curl对象
+	if c.Curl.logger != c.Logger {
+		t.Error("bound curl does not use the request logger")
+	}
+	if c.Curl == app.Curl || app.Curl.headers != nil || app.Curl.ctx == reqCtx {
+		t.Error("app curl is modified by bind")
+	}
+	if _, err := c.Curl.R().URL("http://upstream.test").Send(); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	// 请求结束后，绑定的请求也会取消
+	cancel()
+	if _, err := c.Curl.R().URL("http://upstream.test").Send(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Send() after cancel error = %v, want context.Canceled", err)
+	}
+	// 显式传入的context不受请求的context影响
+	if _, err := c.Curl.R().URL("http://upstream.test").Do(context.Background()); err != nil {
+		t.Errorf("Do(background) error = %v", err)
+	}
+}
+
+// 返回mock收到的最后一个请求和请求实体
+func lastRequest(t *testing.T, tr *curltest.Transport) (*http.Request, string) {
+	t.Helper()
+	requests := tr.Requests()
+	if len(requests) == 0 {
+		t.Fatal("no request is sent")
+	}
+	r := requests[len(requests)-1]
+	if r.Body == nil {
+		return r, ""
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, string(body)
+}
+
+func TestCurlRequestBuilder(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(c *Curl) *CurlRequest
+		check func(t *testing.T, r *http.Request, body string)
+	}{
+		{"base url, query and headers", func(c *Curl) *CurlRequest {
+			return c.R().URL("/users").Query(map[string]string{"page": "1"}).Header("X-App", "request").Headers(map[string]string{"X-Trace": "t1"})
+		}, func(t *testing.T, r *http.Request, body string) {
+			if r.Method != http.MethodGet || r.URL.String() != "http://api.test/v1/users?page=1" {
+				t.Errorf("request = %s %s", r.Method, r.URL)
+			}
+			// 请求的请求头覆盖统一的请求头
+			if r.Header.Get("X-App") != "request" || r.Header.Get("X-Trace") != "t1" || r.Header.Get("X-Client") != "flow" {
+				t.Errorf("headers = %v", r.Header)
+			}
+		}},
+		{"full url is not resolved", func(c *Curl) *CurlRequest {
+			return c.R().URL("http://other.test/ping")
+		}, func(t *testing.T, r *http.Request, body string) {
+			if r.URL.String() != "http://other.test/ping" {
+				t.Errorf("url = %s", r.URL)
+			}
+		}},
+		{"basic auth", func(c *Curl) *CurlRequest {
+			return c.R().URL("/users").BasicAuth("bob", "secret")
+		}, func(t *testing.T, r *http.Request, body string) {
+			if username, password, ok := r.BasicAuth(); !ok || username != "bob" || password != "secret" {
+				t.Errorf("BasicAuth() = %q, %q, %v", username, password, ok)
+			}
+		}},
+		{"json body", func(c *Curl) *CurlRequest {
+			return c.R().Method("post").URL("/users").JSON(map[string]string{"name": "bob"})
+		}, func(t *testing.T, r *http.Request, body string) {
+			if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get(HttpHeaderContentType), MIMEJson) {
+				t.Errorf("request = %s, Content-Type = %q", r.Method, r.Header.Get(HttpHeaderContentType))
+			}
+			if body != `{"name":"bob"}` {
+				t.Errorf("body = %q", body)
+			}
+		}},
+		{"form body", func(c *Curl) *CurlRequest {
+			return c.R().Method(http.MethodPut).URL("/users").Form(map[string]string{"name": "bob"})
+		}, func(t *testing.T, r *http.Request, body string) {
+			if !strings.HasPrefix(r.Header.Get(HttpHeaderContentType), "application/x-www-form-urlencoded") || body != "name=bob" {
+				t.Errorf("Content-Type = %q, body = %q", r.Header.Get(HttpHeaderContentType), body)
+			}
+		}},
+		{"multipart file", func(c *Curl) *CurlRequest {
+			return c.R().Method(http.MethodPost).URL("/upload").Form(map[string]string{"name": "bob"}).File("file", "a.txt", strings.NewReader("hello"))
+		}, func(t *testing.T, r *http.Request, body string) {
+			if !strings.HasPrefix(r.Header.Get(HttpHeaderContentType), "multipart/form-data") {
+				t.Errorf("Content-Type = %q", r.Header.Get(HttpHeaderContentType))
+			}
+			if !strings.Contains(body, `filename="a.txt"`) || !strings.Contains(body, "hello") || !strings.Contains(body, "bob") {
+				t.Errorf("body = %q", body)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := curltest.NewTransport()
+			tr.On("", "*").Reply(http.StatusOK, "ok")
+			c := newTestCurl(t, &CurlConfig{BaseURL: "http://api.test/v1/", Headers: map[string]string{"X-App": "flow", "X-Client": "flow"}, Transport: tr})
+			res, err := tt.build(c).Do(context.Background())
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			if res.StatusCode() != http.StatusOK || res.String() != "ok" {
+				t.Errorf("result = %d %q", res.StatusCode(), res.String())
+			}
+			r, body := lastRequest(t, tr)
+			tt.check(t, r, body)
+		})
+	}
+}
+
+type curlUser struct {
+	Name string `json:"name"`
+}
+
+type curlErrorBody struct {
+	Code int `json:"code"`
+}
+
+func TestCurlJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		mock      func(m *curltest.Mock)
+		errorInto bool
+		want      curlUser
+		status    int  // 期望的CurlStatusError状态码，0表示不是CurlStatusError
+		wantErr   bool // 是否期望错误
+	}{
+		{"success", func(m *curltest.Mock) { m.ReplyJSON(http.StatusOK, curlUser{Name: "bob"}) }, false, curlUser{Name: "bob"}, 0, false},
+		{"empty body", func(m *curltest.Mock) { m.Reply(http.StatusNoContent, "") }, false, curlUser{}, 0, false},
+		{"invalid body", func(m *curltest.Mock) { m.Reply(http.StatusOK, "{") }, false, curlUser{}, 0, true},
+		{"status error", func(m *curltest.Mock) { m.Reply(http.StatusInternalServerError, "boom") }, false, curlUser{}, http.StatusInternalServerError, true},
+		{"status error with error body", func(m *curltest.Mock) { m.ReplyJSON(http.StatusNotFound, curlErrorBody{Code: 1001}) }, true, curlUser{}, http.StatusNotFound, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := curltest.NewTransport()
+			tt.mock(tr.On(http.MethodGet, "http://api.test/users/1"))
+			c := newTestCurl(t, &CurlConfig{Transport: tr})
+			req := c.R().URL("http://api.test/users/1")
+			errorBody := &curlErrorBody{}
+			if tt.errorInto {
+				req.ErrorInto(errorBody)
+			}
+			got, err := CurlJSON[curlUser](context.Background(), req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CurlJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("CurlJSON() = %+v, want %+v", got, tt.want)
+			}
+			var statusError *CurlStatusError
+			if errors.As(err, &statusError) != (tt.status != 0) {
+				t.Fatalf("CurlJSON() error = %v, want CurlStatusError %v", err, tt.status != 0)
+			}
+			if statusError == nil {
+				return
+			}
+			if statusError.Status != tt.status || statusError.Method != http.MethodGet || statusError.URL != "http://api.test/users/1" {
+				t.Errorf("CurlStatusError = %+v", statusError)
+			}
+			if tt.errorInto && (statusError.Result != errorBody || errorBody.Code != 1001) {
+				t.Errorf("Result = %#v, want the decoded error body", statusError.Result)
+			}
+			if !tt.errorInto && statusError.Result != nil {
+				t.Errorf("Result = %#v, want nil", statusError.Result)
+			}
+		})
+	}
+}
+
+func TestCurlJSONAccept(t *testing.T) {
+	tests := []struct {
+		name          string
+		configHeaders map[string]string
+		headers       map[string]string
+		want          string
+	}{
+		{"default", nil, nil, MIMEJson},
+		{"request header", nil, map[string]string{HttpHeaderAccept: "application/vnd.api+json"}, "application/vnd.api+json"},
+		{"lower case request header", nil, map[string]string{"accept": "application/vnd.api+json"}, "application/vnd.api+json"},
+		{"config header", map[string]string{"ACCEPT": "application/problem+json"}, nil, "application/problem+json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := curltest.NewTransport()
+			tr.On(http.MethodGet, "http://api.test/users/1").ReplyJSON(http.StatusOK, curlUser{Name: "bob"})
+			c := newTestCurl(t, &CurlConfig{Headers: tt.configHeaders, Transport: tr})
+			req := c.R().URL("http://api.test/users/1").Headers(tt.headers)
+			if _, err := CurlJSON[curlUser](context.Background(), req); err != nil {
+				t.Fatalf("CurlJSON() error = %v", err)
+			}
+			r, _ := lastRequest(t, tr)
+			if got := r.Header.Values(HttpHeaderAccept); len(got) != 1 || got[0] != tt.want {
+				t.Errorf("Accept = %v, want %q", got, tt.want)
+			}
+			// 不会修改传入的请求
+			if len(req.headers) != len(tt.headers) || req.url != "http://api.test/users/1" {
+				t.Errorf("request is modified: headers = %v, url = %q", req.headers, req.url)
+			}
+		})
+	}
+}
+
+func TestCurlStatusError(t *testing.T) {
+	tr := curltest.NewTransport()
+	tr.On(http.MethodGet, "http://api.test/big").Reply(http.StatusBadGateway, strings.Repeat("a", 5000)).Header("X-Upstream", "1")
+	tr.On(http.MethodGet, "http://api.test/ok").Reply(http.StatusOK, "ok")
+	c := newTestCurl(t, &CurlConfig{Transport: tr})
+	res, err := c.R().URL("http://api.test/ok").Send()
+	if err != nil || res.StatusError() != nil {
+		t.Fatalf("StatusError() = %v, %v, want nil", res.StatusError(), err)
+	}
+	res, err = c.R().URL("http://api.test/big").Send()
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	var statusError *CurlStatusError
+	if !errors.As(res.StatusError(), &statusError) {
+		t.Fatalf("StatusError() = %v", res.StatusError())
+	}
+	// 错误里最多保存4KB的返回实体，错误信息最多256个字符
+	if len(statusError.Body) != curlErrorBodyLimit || statusError.Header.Get("X-Upstream") != "1" {
+		t.Errorf("Body length = %d, Header = %v", len(statusError.Body), statusError.Header)
+	}
+	want := "curl GET http://api.test/big: status 502: " + strings.Repeat("a", 256)
+	if statusError.Error() != want {
+		t.Errorf("Error() = %q", statusError.Error())
+	}
+	if AsHTTPError(statusError).Status != http.StatusBadGateway {
+		t.Errorf("AsHTTPError().Status = %d, want 502", AsHTTPError(statusError).Status)
+	}
+}
+
+func TestCurlClients(t *testing.T) {
+	tr := curltest.NewTransport()
+	tr.On(http.MethodGet, "http://users.test/users/1").Reply(http.StatusOK, "users")
+	tr.On(http.MethodGet, "http://orders.test/orders/1").Reply(http.StatusOK, "orders")
+	app := newTestApp(t)
+	app.SetCurlClientConfig("users", &CurlConfig{BaseURL: "http://users.test", Headers: map[string]string{"X-Client": "users"}, Transport: tr})
+	app.SetCurlClientConfig("orders", &CurlConfig{BaseURL: "http://orders.test", Transport: tr})
+	initCurl(app)
+	users := app.CurlFor("users")
+	if users != app.CurlFor("users") || users == app.CurlFor("orders") {
+		t.Error("CurlFor() does not cache clients by name")
+	}
+	// 命名的httpclient使用填充了默认值的配置
+	if cfg := app.GetCurlClientConfig("users"); cfg.DialTimeout != 30*time.Second || cfg.MaxIdleConnsPerHost != 10 {
+		t.Errorf("config = %+v", cfg)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(HttpHeaderXRequestId, "client-id-1")
+	c, _ := newTestContext(t, app, r)
+	for _, tt := range []struct {
+		name   string
+		target string
+		header string
+	}{
+		{"users", "/users/1", "users"},
+		{"orders", "/orders/1", ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := c.CurlFor(tt.name).Get(tt.target, nil, nil)
+			if err != nil || res.String() != tt.name {
+				t.Fatalf("Get() = %v, %v", res, err)
+			}
+			got, _ := lastRequest(t, tr)
+			if got.Header.Get("X-Client") != tt.header || got.Header.Get(HttpHeaderXRequestId) != "client-id-1" {
+				t.Errorf("headers = %v", got.Header)
+			}
+		})
+	}
+
+	// 重新设置配置后重新创建
+	app.SetCurlClientConfig("users", &CurlConfig{BaseURL: "http://users.test", Transport: tr})
+	if app.CurlFor("users") == users {
+		t.Error("CurlFor() returns the old client after SetCurlClientConfig")
+	}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"unknown", "curl client unknown is not configured"},
+		{"invalid", "curl client invalid: curl tls: invalid ca pem"},
+	}
+	app.SetCurlClientConfig("invalid", &CurlConfig{TLS: &CurlTLSConfig{CA: "invalid"}})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				err, _ := recover().(error)
+				if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+					t.Errorf("CurlFor() panic = %v, want %q", err, tt.want)
+				}
+			}()
+			app.CurlFor(tt.name)
+		})
+	}
+}
+
+// 生成自签名的证书，返回PEM格式的证书和私钥，证书可以同时作为CA使用，包含localhost和127.0.0.1
+func newTestCertPEM(t *testing.T, usage x509.ExtKeyUsage) (string, string) {
+	t.Helper()
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "flow test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{usage},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, private.Public(), private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}))
+}
+
+func TestCurlTLSConfigLoad(t *testing.T) {
+	caPEM, _ := newTestCertPEM(t, x509.ExtKeyUsageServerAuth)
+	certPEM, keyPEM := newTestCertPEM(t, x509.ExtKeyUsageClientAuth)
+	_, otherKeyPEM := newTestCertPEM(t, x509.ExtKeyUsageClientAuth)
+	dir := t.TempDir()
+	for name, content := range map[string]string{"ca.pem": caPEM, "cert.pem": certPEM, "key.pem": keyPEM} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name    string
+		config  *CurlTLSConfig
+		wantErr string
+		check   func(t *testing.T, c *tls.Config)
+	}{
+		{"default", &CurlTLSConfig{}, "", func(t *testing.T, c *tls.Config) {
+			if c.MinVersion != tls.VersionTLS12 || c.RootCAs != nil || len(c.Certificates) != 0 {
+				t.Errorf("config = %+v", c)
+			}
+		}},
+		{"pem", &CurlTLSConfig{CA: caPEM, Cert: certPEM, Key: keyPEM, ServerName: "api.test", MinVersion: tls.VersionTLS13}, "", func(t *testing.T, c *tls.Config) {
+			if c.RootCAs == nil || len(c.Certificates) != 1 || c.ServerName != "api.test" || c.MinVersion != tls.VersionTLS13 {
+				t.Errorf("config = %+v", c)
+			}
+		}},
+		{"files", &CurlTLSConfig{CAFile: filepath.Join(dir, "ca.pem"), CertFile: filepath.Join(dir, "cert.pem"), KeyFile: filepath.Join(dir, "key.pem")}, "", func(t *testing.T, c *tls.Config) {
+			if c.RootCAs == nil || len(c.Certificates) != 1 {
+				t.Errorf("config = %+v", c)
+			}
+		}},
+		{"custom config is copied", &CurlTLSConfig{InsecureSkipVerify: true, Config: &tls.Config{ServerName: "custom.test"}}, "", func(t *testing.T, c *tls.Config) {
+			if c.ServerName != "custom.test" || !c.InsecureSkipVerify {
+				t.Errorf("config = %+v", c)
+			}
+		}},
+		{"invalid ca", &CurlTLSConfig{CA: "invalid"}, "curl tls: invalid ca pem", nil},
+		{"missing file", &CurlTLSConfig{CAFile: filepath.Join(dir, "missing.pem")}, "missing.pem", nil},
+		{"cert without key", &CurlTLSConfig{Cert: certPEM}, "curl tls:", nil},
+		{"mismatched key", &CurlTLSConfig{Cert: certPEM, Key: otherKeyPEM}, "curl tls:", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			custom := tt.config.Config
+			got, err := tt.config.load()
+			if len(tt.wantErr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("load() error = %v", err)
+			}
+			tt.check(t, got)
+			if custom != nil && (got == custom || custom.InsecureSkipVerify) {
+				t.Error("custom tls config is modified")
+			}
+		})
+	}
+}
+
+func TestCurlMutualTLS(t *testing.T) {
+	certPEM, keyPEM := newTestCertPEM(t, x509.ExtKeyUsageClientAuth)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AppendCertsFromPEM([]byte(certPEM))
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+	serverCA := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+
+	tests := []struct {
+		name    string
+		tls     *CurlTLSConfig
+		wantErr bool
+	}{
+		{"client certificate", &CurlTLSConfig{CA: serverCA, Cert: certPEM, Key: keyPEM}, false},
+		{"without client certificate", &CurlTLSConfig{CA: serverCA}, true},
+		{"unknown server ca", &CurlTLSConfig{Cert: certPEM, Key: keyPEM}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCurl(t, &CurlConfig{TLS: tt.tls, DisableKeepAlives: true})
+			res, err := c.R().URL(srv.URL).Send()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && res.String() != "flow test" {
+				t.Errorf("body = %q", res.String())
+			}
+		})
+	}
+}
+
+func TestCurlTransport(t *testing.T) {
+	mock := curltest.NewTransport()
+	tests := []struct {
+		name    string
+		config  *CurlConfig
+		wantErr bool
+		check   func(t *testing.T, rt http.RoundTripper)
+	}{
+		{"custom transport", &CurlConfig{Transport: mock}, false, func(t *testing.T, rt http.RoundTripper) {
+			if rt != mock {
+				t.Errorf("transport = %T, want the custom transport", rt)
+			}
+		}},
+		{"proxy", &CurlConfig{Proxy: "http://127.0.0.1:8080"}, false, func(t *testing.T, rt http.RoundTripper) {
+			proxy, err := rt.(*http.Transport).Proxy(httptest.NewRequest(http.MethodGet, "https://api.test/", nil))
+			if err != nil || proxy == nil || proxy.String() != "http://127.0.0.1:8080" {
+				t.Errorf("Proxy() = %v, %v", proxy, err)
+			}
+		}},
+		{"pool", &CurlConfig{MaxIdleConnsPerHost: 20, MaxConnsPerHost: 50, DisableKeepAlives: true}, false, func(t *testing.T, rt http.RoundTripper) {
+			transport := rt.(*http.Transport)
+			if transport.MaxIdleConnsPerHost != 20 || transport.MaxConnsPerHost != 50 || !transport.DisableKeepAlives || transport.MaxIdleConns != 100 {
+				t.Errorf("transport = %+v", transport)
+			}
+		}},
+		{"tls", &CurlConfig{TLS: &CurlTLSConfig{ServerName: "api.test"}}, false, func(t *testing.T, rt http.RoundTripper) {
+			if c := rt.(*http.Transport).TLSClientConfig; c == nil || c.ServerName != "api.test" {
+				t.Errorf("TLSClientConfig = %+v", c)
+			}
+		}},
+		{"invalid proxy", &CurlConfig{Proxy: "://invalid"}, true, nil},
+		{"invalid tls", &CurlConfig{TLS: &CurlTLSConfig{CA: "invalid"}}, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt, err := newCurlTransport(fillCurlConfig(tt.config))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newCurlTransport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				tt.check(t, rt)
+			}
+		})
+	}
+	// 没有设置代理时使用环境变量
+	rt, _ := newCurlTransport(fillCurlConfig(&CurlConfig{}))
+	if rt.(*http.Transport).Proxy == nil {
+		t.Error("Proxy = nil, want http.ProxyFromEnvironment")
+	}
+}
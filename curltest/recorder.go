@@ -0,0 +1,244 @@
+package curltest
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Mode 定义录制回放的模式
+type Mode int
+
+const (
+	// ModeReplay 只回放已经录制的请求，没有录制的请求返回错误，不会发送真实的请求
+	ModeReplay Mode = iota
+	// ModeRecord 发送真实的请求并录制，覆盖已经录制的文件
+	ModeRecord
+	// ModeReplayOrRecord 有录制的文件时回放，没有时发送真实的请求并录制
+	ModeReplayOrRecord
+)
+
+// ErrFixtureNotFound 回放模式下没有找到录制的文件
+var ErrFixtureNotFound = errors.New("curltest: fixture not found")
+
+// 定义录制的请求和返回的结果，保存成json文件
+type fixture struct {
+	Request struct {
+		Method       string `json:"method"`
+		URL          string `json:"url"`
+		Body         string `json:"body,omitempty"`
+		BodyEncoding string `json:"bodyEncoding,omitempty"`
+	} `json:"request"`
+	Response struct {
+		Status       int         `json:"status"`
+		Header       http.Header `json:"header,omitempty"`
+		Body         string      `json:"body,omitempty"`
+		BodyEncoding string      `json:"bodyEncoding,omitempty"`
+	} `json:"response"`
+}
+
+// 录制文件里替换敏感信息的内容
+const redactedValue = "******"
+
+// Recorder 定义录制回放的RoundTripper，每个请求按方法，地址和实体保存成一个json文件，
+// 请求头不会保存，返回头和地址里的敏感信息会被替换，避免Authorization，Set-Cookie等敏感信息写入文件
+type Recorder struct {
+	dir           string
+	mode          Mode
+	transport     http.RoundTripper
+	redactHeaders []string
+	redactFields  []string
+}
+
+// NewRecorder 创建录制回放的RoundTripper，dir是保存录制文件的目录
+func NewRecorder(dir string, mode Mode) *Recorder {
+	return &Recorder{
+		dir:           dir,
+		mode:          mode,
+		transport:     http.DefaultTransport,
+		redactHeaders: []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"},
+		redactFields:  []string{"password", "secret", "token", "access_token", "refresh_token"},
+	}
+}
+
+// Transport 设置录制时发送真实请求的RoundTripper，默认值http.DefaultTransport
+func (r *Recorder) Transport(rt http.RoundTripper) *Recorder {
+	r.transport = rt
+	return r
+}
+
+// RedactHeaders 设置录制文件里隐藏的返回头，不区分大小写，默认值Authorization，Proxy-Authorization，Cookie，Set-Cookie
+func (r *Recorder) RedactHeaders(headers ...string) *Recorder {
+	r.redactHeaders = headers
+	return r
+}
+
+// RedactFields 设置录制文件里隐藏的query参数，不区分大小写，默认值password，secret，token，access_token，refresh_token
+func (r *Recorder) RedactFields(fields ...string) *Recorder {
+	r.redactFields = fields
+	return r
+}
+
+// RoundTrip 实现http.RoundTripper接口
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	path := r.fixturePath(req, body)
+	if r.mode != ModeRecord {
+		f, err := loadFixture(path)
+		if err == nil {
+			return f.response(req)
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if r.mode == ModeReplay {
+			return nil, fmt.Errorf("%w: %s %s (%s)", ErrFixtureNotFound, req.Method, req.URL, path)
+		}
+	}
+	res, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resBody, err := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	f := &fixture{}
+	f.Request.Method = req.Method
+	f.Request.URL = r.redactURL(req.URL)
+	f.Request.Body, f.Request.BodyEncoding = encodeBody(body)
+	f.Response.Status = res.StatusCode
+	f.Response.Header = r.redactHeader(res.Header)
+	f.Response.Body, f.Response.BodyEncoding = encodeBody(resBody)
+	if err = saveFixture(path, f); err != nil {
+		return nil, err
+	}
+	return f.response(req)
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// 返回录制文件的路径，文件名由方法，地址路径和请求的摘要组成，摘要使用隐藏了敏感信息的地址，token变化时也能回放
+func (r *Recorder) fixturePath(req *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(req.Method + " " + r.redactURL(req.URL) + "\n"))
+	h.Write(body)
+	sum := hex.EncodeToString(h.Sum(nil))[:16]
+	name := strings.Trim(unsafeFileChars.ReplaceAllString(req.URL.Host+req.URL.Path, "_"), "_")
+	if len(name) > 80 {
+		name = name[:80]
+	}
+	return filepath.Join(r.dir, fmt.Sprintf("%s_%s_%s.json", strings.ToLower(req.Method), name, sum))
+}
+
+// 判断是否在列表里，不区分大小写
+func containsFold(list []string, key string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// 返回隐藏了敏感信息的返回头
+func (r *Recorder) redactHeader(header http.Header) http.Header {
+	redacted := header.Clone()
+	for k := range redacted {
+		if containsFold(r.redactHeaders, k) {
+			redacted[k] = []string{redactedValue}
+		}
+	}
+	return redacted
+}
+
+// 返回隐藏了密码和query里敏感字段的地址
+func (r *Recorder) redactURL(u *url.URL) string {
+	redacted := *u
+	if _, ok := u.User.Password(); ok {
+		redacted.User = url.UserPassword(u.User.Username(), redactedValue)
+	}
+	if len(u.RawQuery) > 0 {
+		query := u.Query()
+		changed := false
+		for k := range query {
+			if containsFold(r.redactFields, k) {
+				query.Set(k, redactedValue)
+				changed = true
+			}
+		}
+		if changed {
+			redacted.RawQuery = query.Encode()
+		}
+	}
+	return strings.ReplaceAll(redacted.String(), url.QueryEscape(redactedValue), redactedValue)
+}
+
+// 读取录制文件
+func loadFixture(path string) (*fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &fixture{}
+	if err = json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("curltest: invalid fixture %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// 保存录制文件，目录不存在时自动创建
+func saveFixture(path string, f *fixture) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// 返回录制的结果
+func (f *fixture) response(req *http.Request) (*http.Response, error) {
+	body, err := decodeBody(f.Response.Body, f.Response.BodyEncoding)
+	if err != nil {
+		return nil, err
+	}
+	header := f.Response.Header.Clone()
+	// 实体已经完整保存，去掉和原始传输相关的头信息
+	header.Del("Content-Length")
+	header.Del("Transfer-Encoding")
+	return newResponse(req, f.Response.Status, header, body), nil
+}
+
+// 编码实体，文本直接保存，二进制使用base64保存
+func encodeBody(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+// 解码实体
+func decodeBody(body, encoding string) ([]byte, error) {
+	if encoding == "base64" {
+		return base64.StdEncoding.DecodeString(body)
+	}
+	return []byte(body), nil
+}
@@ -0,0 +1,267 @@
+// Package curltest 提供测试flow.Curl的RoundTripper，包括按请求匹配的mock和录制回放
+package curltest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Mock 定义一个mock的请求和返回的结果
+type Mock struct {
+	method    string
+	url       string
+	bodyMatch func(body []byte) bool
+	status    int
+	header    http.Header
+	body      []byte
+	err       error
+	times     int // 最多匹配的次数，0表示不限制
+	calls     int // 已经匹配的次数
+}
+
+// WithBody 请求实体和给定的内容完全相同时才匹配
+func (m *Mock) WithBody(body string) *Mock {
+	m.bodyMatch = func(b []byte) bool {
+		return string(b) == body
+	}
+	return m
+}
+
+// WithJSONBody 请求实体和给定的对象json编码后语义相同时才匹配，忽略字段顺序和空白
+func (m *Mock) WithJSONBody(v interface{}) *Mock {
+	expected, err := normalizeJSON(v)
+	m.bodyMatch = func(b []byte) bool {
+		var actual interface{}
+		if err != nil || json.Unmarshal(b, &actual) != nil {
+			return false
+		}
+		return reflect.DeepEqual(expected, actual)
+	}
+	return m
+}
+
+// MatchBody 使用自定义的方法匹配请求实体
+func (m *Mock) MatchBody(match func(body []byte) bool) *Mock {
+	m.bodyMatch = match
+	return m
+}
+
+// Reply 设置返回的状态码和实体
+func (m *Mock) Reply(status int, body string) *Mock {
+	m.status = status
+	m.body = []byte(body)
+	return m
+}
+
+// ReplyJSON 设置返回的状态码和json编码的实体
+func (m *Mock) ReplyJSON(status int, v interface{}) *Mock {
+	body, err := json.Marshal(v)
+	if err != nil {
+		m.err = err
+		return m
+	}
+	m.header.Set("Content-Type", "application/json; charset=utf-8")
+	m.status = status
+	m.body = body
+	return m
+}
+
+// ReplyError 返回网络错误，如超时，连接被拒绝
+func (m *Mock) ReplyError(err error) *Mock {
+	m.err = err
+	return m
+}
+
+// Header 设置返回的头信息
+func (m *Mock) Header(key, value string) *Mock {
+	m.header.Set(key, value)
+	return m
+}
+
+// Times 设置最多匹配的次数，超过后继续匹配后面的mock
+func (m *Mock) Times(n int) *Mock {
+	m.times = n
+	return m
+}
+
+// 判断请求是否匹配，body是读取后的请求实体
+func (m *Mock) match(req *http.Request, body []byte) bool {
+	if m.times > 0 && m.calls >= m.times {
+		return false
+	}
+	if len(m.method) > 0 && m.method != req.Method {
+		return false
+	}
+	if !matchURL(m.url, req.URL) {
+		return false
+	}
+	return m.bodyMatch == nil || m.bodyMatch(body)
+}
+
+// 返回mock的结果
+func (m *Mock) response(req *http.Request) (*http.Response, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	status := m.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return newResponse(req, status, m.header.Clone(), m.body), nil
+}
+
+// Transport 定义mock的RoundTripper，按添加的顺序匹配请求的方法，地址和实体，没有匹配的请求返回错误
+type Transport struct {
+	mu       sync.Mutex
+	mocks    []*Mock
+	requests []*http.Request
+	fallback http.RoundTripper
+}
+
+// NewTransport 创建mock的RoundTripper
+func NewTransport() *Transport {
+	return &Transport{}
+}
+
+// On 添加mock，method为空时匹配所有的方法，url以*结尾时匹配前缀，url没有query时忽略请求的query
+func (t *Transport) On(method, url string) *Mock {
+	m := &Mock{method: strings.ToUpper(method), url: url, header: make(http.Header)}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.mocks = append(t.mocks, m)
+	return m
+}
+
+// Fallback 设置没有匹配的请求使用的RoundTripper，如http.DefaultTransport
+func (t *Transport) Fallback(rt http.RoundTripper) *Transport {
+	t.fallback = rt
+	return t
+}
+
+// Requests 返回收到的所有请求，请求实体可以重复读取
+func (t *Transport) Requests() []*http.Request {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*http.Request(nil), t.requests...)
+}
+
+// Unused 返回没有匹配过任何请求的mock，用于检查期望的请求是否都发送了
+func (t *Transport) Unused() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	unused := make([]string, 0)
+	for _, m := range t.mocks {
+		if m.calls == 0 {
+			unused = append(unused, strings.TrimSpace(m.method+" "+m.url))
+		}
+	}
+	return unused
+}
+
+// RoundTrip 实现http.RoundTripper接口
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	t.requests = append(t.requests, req)
+	var matched *Mock
+	for _, m := range t.mocks {
+		if m.match(req, body) {
+			m.calls++
+			matched = m
+			break
+		}
+	}
+	t.mu.Unlock()
+	if matched != nil {
+		return matched.response(req)
+	}
+	if t.fallback != nil {
+		return t.fallback.RoundTrip(req)
+	}
+	return nil, fmt.Errorf("curltest: no mock for %s %s", req.Method, req.URL)
+}
+
+// 判断请求地址是否匹配
+func matchURL(pattern string, u *url.URL) bool {
+	if len(pattern) == 0 || pattern == "*" {
+		return true
+	}
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(u.String(), strings.TrimSuffix(pattern, "*"))
+	}
+	expected, err := url.Parse(pattern)
+	if err != nil {
+		return false
+	}
+	if expected.Scheme != u.Scheme || expected.Host != u.Host || expected.Path != u.Path {
+		return false
+	}
+	if len(expected.RawQuery) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(expected.Query(), u.Query())
+}
+
+// 读取请求实体，读取后重置请求实体，保证可以重复读取
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return body, nil
+}
+
+// 将对象转换成json解码后的通用结构，用于比较
+func normalizeJSON(v interface{}) (interface{}, error) {
+	var raw []byte
+	switch b := v.(type) {
+	case string:
+		raw = []byte(b)
+	case []byte:
+		raw = b
+	default:
+		var err error
+		if raw, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	var normalized interface{}
+	err := json.Unmarshal(raw, &normalized)
+	return normalized, err
+}
+
+// 创建返回的结果
+func newResponse(req *http.Request, status int, header http.Header, body []byte) *http.Response {
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
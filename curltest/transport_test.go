@@ -0,0 +1,140 @@
+package curltest
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// 发送请求，返回状态码和实体
+func send(t *testing.T, rt http.RoundTripper, method, target, body string) (int, string, error) {
+	t.Helper()
+	var reader io.Reader
+	if len(body) > 0 {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, target, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := (&http.Client{Transport: rt}).Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, string(b), nil
+}
+
+func TestMatchURL(t *testing.T) {
+	tests := []struct {
+		pattern string
+		url     string
+		want    bool
+	}{
+		{"", "http://a.test/x", true},
+		{"*", "http://a.test/x", true},
+		{"http://a.test/x", "http://a.test/x", true},
+		{"http://a.test/x", "http://a.test/x?page=1", true},
+		{"http://a.test/x", "https://a.test/x", false},
+		{"http://a.test/x", "http://b.test/x", false},
+		{"http://a.test/x", "http://a.test/x/y", false},
+		{"http://a.test/x?page=1", "http://a.test/x?page=1", true},
+		{"http://a.test/x?page=1&size=2", "http://a.test/x?size=2&page=1", true},
+		{"http://a.test/x?page=1", "http://a.test/x?page=2", false},
+		{"http://a.test/x?page=1", "http://a.test/x", false},
+		{"http://a.test/users/*", "http://a.test/users/1?a=b", true},
+		{"http://a.test/users/*", "http://a.test/orders/1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.url, func(t *testing.T) {
+			u, _ := url.Parse(tt.url)
+			if got := matchURL(tt.pattern, u); got != tt.want {
+				t.Errorf("matchURL(%q, %q) = %v, want %v", tt.pattern, tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransport(t *testing.T) {
+	tr := NewTransport()
+	tr.On(http.MethodGet, "http://api.test/users/1").ReplyJSON(http.StatusOK, map[string]interface{}{"id": 1})
+	tr.On(http.MethodPost, "http://api.test/users").WithJSONBody(`{"name":"bob","age":3}`).Reply(http.StatusCreated, "created")
+	tr.On(http.MethodPost, "http://api.test/users").WithBody("raw").Reply(http.StatusAccepted, "raw")
+	tr.On(http.MethodPost, "http://api.test/users").MatchBody(func(body []byte) bool {
+		return strings.Contains(string(body), "custom")
+	}).Reply(http.StatusOK, "custom")
+	tr.On(http.MethodGet, "http://api.test/flaky").Reply(http.StatusServiceUnavailable, "").Times(1)
+	tr.On(http.MethodGet, "http://api.test/flaky").Reply(http.StatusOK, "ok")
+	tr.On(http.MethodGet, "http://api.test/down").ReplyError(errors.New("connection refused"))
+	tr.On("", "http://api.test/any/*").Header("X-Mock", "1").Reply(http.StatusNoContent, "")
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		status int
+		want   string
+		err    bool
+	}{
+		{"reply json", http.MethodGet, "http://api.test/users/1", "", http.StatusOK, `{"id":1}`, false},
+		{"method must match", http.MethodDelete, "http://api.test/users/1", "", 0, "", true},
+		{"json body ignores order and spaces", http.MethodPost, "http://api.test/users", `{ "age": 3, "name": "bob" }`, http.StatusCreated, "created", false},
+		{"exact body", http.MethodPost, "http://api.test/users", "raw", http.StatusAccepted, "raw", false},
+		{"custom body match", http.MethodPost, "http://api.test/users", "a custom body", http.StatusOK, "custom", false},
+		{"body not matched", http.MethodPost, "http://api.test/users", "other", 0, "", true},
+		{"times first", http.MethodGet, "http://api.test/flaky", "", http.StatusServiceUnavailable, "", false},
+		{"times exhausted", http.MethodGet, "http://api.test/flaky", "", http.StatusOK, "ok", false},
+		{"reply error", http.MethodGet, "http://api.test/down", "", 0, "", true},
+		{"any method prefix", http.MethodPut, "http://api.test/any/x?y=1", "", http.StatusNoContent, "", false},
+		{"no mock", http.MethodGet, "http://other.test/", "", 0, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body, err := send(t, tr, tt.method, tt.url, tt.body)
+			if (err != nil) != tt.err {
+				t.Fatalf("error = %v, want error %v", err, tt.err)
+			}
+			if status != tt.status || body != tt.want {
+				t.Errorf("got %d %q, want %d %q", status, body, tt.status, tt.want)
+			}
+		})
+	}
+
+	requests := tr.Requests()
+	if len(requests) != len(tests) {
+		t.Fatalf("got %d requests, want %d", len(requests), len(tests))
+	}
+	// 记录的请求实体可以重复读取
+	if b, _ := io.ReadAll(requests[2].Body); string(b) != `{ "age": 3, "name": "bob" }` {
+		t.Errorf("recorded body = %q", b)
+	}
+	if unused := tr.Unused(); len(unused) != 0 {
+		t.Errorf("Unused() = %v, want none", unused)
+	}
+}
+
+func TestTransportUnusedAndFallback(t *testing.T) {
+	fallback := NewTransport()
+	fallback.On(http.MethodGet, "*").Reply(http.StatusOK, "fallback")
+	tr := NewTransport().Fallback(fallback)
+	tr.On(http.MethodGet, "http://api.test/a").Reply(http.StatusOK, "a")
+	tr.On(http.MethodPost, "http://api.test/b")
+
+	if _, body, err := send(t, tr, http.MethodGet, "http://api.test/a", ""); err != nil || body != "a" {
+		t.Errorf("mock = %q, %v", body, err)
+	}
+	if _, body, err := send(t, tr, http.MethodGet, "http://api.test/c", ""); err != nil || body != "fallback" {
+		t.Errorf("fallback = %q, %v", body, err)
+	}
+	if unused := tr.Unused(); len(unused) != 1 || unused[0] != "POST http://api.test/b" {
+		t.Errorf("Unused() = %v", unused)
+	}
+}
@@ -0,0 +1,128 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/funswe/flow/utils/json"
+	"go.uber.org/zap"
+)
+
+// HTTPError 定义带http状态码的错误，用于统一的错误返回
+type HTTPError struct {
+	Status  int         `json:"-"`                 // http状态码
+	Code    int         `json:"code"`              // 业务错误码
+	Message string      `json:"message"`           // 错误信息
+	Details interface{} `json:"details,omitempty"` // 错误详情
+	Err     error       `json:"-"`                 // 原始错误
+}
+
+// NewHTTPError 返回一个HTTPError，code为0时使用status作为业务错误码
+func NewHTTPError(status int, code int, message string) *HTTPError {
+	if code == 0 {
+		code = status
+	}
+	if len(message) == 0 {
+		message = http.StatusText(status)
+	}
+	return &HTTPError{Status: status, Code: code, Message: message}
+}
+
+func (e *HTTPError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("code=%d, message=%s: %v", e.Code, e.Message, e.Err)
+	}
+	return fmt.Sprintf("code=%d, message=%s", e.Code, e.Message)
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// WithDetails 设置错误详情
+func (e *HTTPError) WithDetails(details interface{}) *HTTPError {
+	e.Details = details
+	return e
+}
+
+// WithError 设置原始错误
+func (e *HTTPError) WithError(err error) *HTTPError {
+	e.Err = err
+	return e
+}
+
+// ErrorRenderer 定义错误渲染方法，将错误转换成http返回
+type ErrorRenderer func(ctx *Context, err error)
+
+// AsHTTPError 将错误转换成HTTPError，参数校验错误返回400，上游服务返回的错误返回502，未知错误返回500
+func AsHTTPError(err error) *HTTPError {
+	var httpError *HTTPError
+	if errors.As(err, &httpError) {
+		return httpError
+	}
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		return NewHTTPError(http.StatusRequestEntityTooLarge, 0, "").WithError(err)
+	}
+	var fieldErrors FieldValidateErrors
+	if errors.As(err, &fieldErrors) {
+		return NewHTTPError(http.StatusBadRequest, 0, fieldErrors.Error()).WithDetails(fieldErrors).WithError(err)
+	}
+	var fieldError *FieldValidateError
+	if errors.As(err, &fieldError) {
+		return NewHTTPError(http.StatusBadRequest, 0, fieldError.Error()).WithDetails(FieldValidateErrors{fieldError}).WithError(err)
+	}
+	var curlStatusError *CurlStatusError
+	if errors.As(err, &curlStatusError) {
+		// 上游服务返回的错误
+		return NewHTTPError(http.StatusBadGateway, 0, "").WithError(err)
+	}
+	return NewHTTPError(http.StatusInternalServerError, 0, "").WithError(err)
+}
+
+// 默认的错误渲染方法，返回json格式：{"code":400,"message":"...","details":...}
+func defaultErrorRenderer(ctx *Context, err error) {
+	httpError := AsHTTPError(err)
+	if httpError.Status >= http.StatusInternalServerError {
+		ctx.Logger.Error("request error", zap.Error(err))
+	}
+	// 已经写入返回的不能再修改
+	if ctx.res.written {
+		return
+	}
+	body, mErr := json.Marshal(httpError)
+	if mErr != nil {
+		body = []byte(fmt.Sprintf(`{"code":%d,"message":%q}`, httpError.Code, httpError.Message))
+	}
+	ctx.SetHeader(HttpHeaderContentType, "application/json; charset=utf-8")
+	ctx.SetStatus(httpError.Status)
+	ctx.res.raw(body)
+}
+
+// 将panic的值转换成错误
+func panicToError(rcv interface{}) error {
+	switch v := rcv.(type) {
+	case error:
+		return v
+	case string:
+		return errors.New(v)
+	default:
+		return fmt.Errorf("%v", v)
+	}
+}
+
+// SetErrorRenderer 设置错误渲染方法，ErrorHandler返回的错误和处理请求时的panic都交给它处理
+func (app *Application) SetErrorRenderer(renderer ErrorRenderer) *Application {
+	app.errorRenderer = renderer
+	return app
+}
+
+// 渲染错误，没有设置错误渲染方法时使用默认的json格式
+func (app *Application) renderError(ctx *Context, err error) {
+	if app.errorRenderer != nil {
+		app.errorRenderer(ctx, err)
+		return
+	}
+	defaultErrorRenderer(ctx, err)
+}
@@ -0,0 +1,133 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHTTPError(t *testing.T) {
+	cause := errors.New("record not found")
+	tests := []struct {
+		name    string
+		err     *HTTPError
+		code    int
+		message string
+		text    string
+	}{
+		{"default code and message", NewHTTPError(http.StatusNotFound, 0, ""), 404, "Not Found", "code=404, message=Not Found"},
+		{"custom code", NewHTTPError(http.StatusNotFound, 1001, "user not found"), 1001, "user not found", "code=1001, message=user not found"},
+		{"with error", NewHTTPError(http.StatusNotFound, 1001, "user not found").WithError(cause), 1001, "user not found",
+			"code=1001, message=user not found: record not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.err.Code != tt.code || tt.err.Message != tt.message {
+				t.Errorf("got code=%d message=%q, want code=%d message=%q", tt.err.Code, tt.err.Message, tt.code, tt.message)
+			}
+			if tt.err.Error() != tt.text {
+				t.Errorf("Error() = %q, want %q", tt.err.Error(), tt.text)
+			}
+		})
+	}
+	// 可以通过errors.Is获取原始错误
+	if err := NewHTTPError(http.StatusNotFound, 0, "").WithError(cause); !errors.Is(err, cause) {
+		t.Error("errors.Is(err, cause) = false")
+	}
+}
+
+func TestAsHTTPError(t *testing.T) {
+	httpError := NewHTTPError(http.StatusConflict, 2001, "conflict")
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		same   bool // 是否返回原来的HTTPError
+	}{
+		{"http error", httpError, http.StatusConflict, true},
+		{"wrapped http error", fmt.Errorf("create user: %w", httpError), http.StatusConflict, true},
+		{"max bytes", &http.MaxBytesError{Limit: 10}, http.StatusRequestEntityTooLarge, false},
+		{"field errors", FieldValidateErrors{{Type: "required", Field: "Name", Param: "name"}}, http.StatusBadRequest, false},
+		{"field error", &FieldValidateError{Type: "required", Field: "Name", Param: "name"}, http.StatusBadRequest, false},
+		{"curl status error", &CurlStatusError{Method: http.MethodGet, URL: "http://upstream.test", Status: 500}, http.StatusBadGateway, false},
+		{"unknown error", errors.New("boom"), http.StatusInternalServerError, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := AsHTTPError(tt.err)
+			if got.Status != tt.status {
+				t.Errorf("Status = %d, want %d", got.Status, tt.status)
+			}
+			if (got == httpError) != tt.same {
+				t.Errorf("returned the original HTTPError = %v, want %v", got == httpError, tt.same)
+			}
+			if !tt.same && got.Err == nil {
+				t.Error("original error is not kept")
+			}
+		})
+	}
+	// 字段校验错误放在details里
+	got := AsHTTPError(FieldValidateErrors{{Type: "required", Field: "Name", Param: "name"}})
+	if details, ok := got.Details.(FieldValidateErrors); !ok || len(details) != 1 {
+		t.Errorf("Details = %#v", got.Details)
+	}
+}
+
+func TestWrapError(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  Handler
+		renderer ErrorRenderer
+		status   int
+		body     string
+	}{
+		{"nil error", WrapError(func(ctx *Context) error {
+			ctx.Text("ok")
+			return nil
+		}), nil, http.StatusOK, "ok"},
+		{"http error", WrapError(func(ctx *Context) error {
+			return NewHTTPError(http.StatusNotFound, 1001, "user not found")
+		}), nil, http.StatusNotFound, `{"code":1001,"message":"user not found"}`},
+		{"unknown error hides message", WrapError(func(ctx *Context) error {
+			return errors.New("db password is wrong")
+		}), nil, http.StatusInternalServerError, `{"code":500,"message":"Internal Server Error"}`},
+		{"custom renderer", WrapError(func(ctx *Context) error {
+			return NewHTTPError(http.StatusForbidden, 0, "")
+		}), func(ctx *Context, err error) {
+			ctx.SetStatus(AsHTTPError(err).Status).Text("custom")
+		}, http.StatusForbidden, "custom"},
+		{"panic error", func(ctx *Context) {
+			panic(NewHTTPError(http.StatusTeapot, 0, "teapot"))
+		}, nil, http.StatusTeapot, `{"code":418,"message":"teapot"}`},
+		{"panic string", func(ctx *Context) {
+			panic("something wrong")
+		}, nil, http.StatusInternalServerError, `{"code":500,"message":"Internal Server Error"}`},
+		{"panic with custom renderer", func(ctx *Context) {
+			panic("something wrong")
+		}, func(ctx *Context, err error) {
+			ctx.SetStatus(AsHTTPError(err).Status).Text(err.Error())
+		}, http.StatusInternalServerError, "something wrong"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			app.SetErrorRenderer(tt.renderer)
+			app.GET("/", tt.handler)
+			w := serve(app, http.MethodGet, "/", nil)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+			// 没有设置错误渲染方法时，错误和panic都使用json格式
+			if tt.renderer == nil && tt.status != http.StatusOK {
+				if ct := w.Header().Get(HttpHeaderContentType); !strings.HasPrefix(ct, "application/json") {
+					t.Errorf("Content-Type = %q, want application/json", ct)
+				}
+			}
+		})
+	}
+}
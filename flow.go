@@ -1,9 +1,8 @@
 package flow
 
 import (
-	"go.uber.org/zap"
-	"sync"
-	"time"
+	"context"
+	"io/fs"
 )
 
 // 定义请求的方法
@@ -19,7 +18,10 @@ const (
 
 // 定义http头
 const (
+	HttpHeaderAccept                  = "Accept"
+	HttpHeaderAcceptEncoding          = "Accept-Encoding"
 	HttpHeaderContentType             = "Content-Type"
+	HttpHeaderContentEncoding         = "Content-Encoding"
 	HttpHeaderContentLength           = "Content-Length"
 	HttpHeaderTransferEncoding        = "Transfer-Encoding"
 	HttpHeaderContentDisposition      = "Content-Disposition"
@@ -36,235 +38,205 @@ const (
 	HttpHeaderLastModified            = "Last-Modified"
 	HttpHeaderXContentTypeOptions     = "X-Content-Type-Options"
 	HttpHeaderXPoweredBy              = "X-Powered-By"
+	HttpHeaderVary                    = "Vary"
 	HttpHeaderCorsOrigin              = "Access-Control-Allow-Origin"
 	HttpHeaderCorsMethods             = "Access-Control-Allow-Methods"
 	HttpHeaderCorsHeaders             = "Access-Control-Allow-Headers"
 	HttpHeaderCorsMaxAge              = "Access-Control-Max-Age"
+	HttpHeaderCorsCredentials         = "Access-Control-Allow-Credentials"
+	HttpHeaderCorsExposeHeaders       = "Access-Control-Expose-Headers"
+	HttpHeaderCorsRequestMethod       = "Access-Control-Request-Method"
+	HttpHeaderCorsRequestHeaders      = "Access-Control-Request-Headers"
+	HttpHeaderOrigin                  = "Origin"
+	HttpHeaderAllow                   = "Allow"
+	HttpHeaderAuthorization           = "Authorization"
+	HttpHeaderWWWAuthenticate         = "WWW-Authenticate"
+	HttpHeaderXRequestId              = "X-Request-Id"
 )
 
-var (
-	app = &Application{
-		serverConfig: defServerConfig(),
-		loggerConfig: defLoggerConfig(),
-		corsConfig:   defCorsConfig(),
-		curlConfig:   defCurlConfig(),
-		beforeRuns:   make([]BeforeRun, 0),
-	}
-	defRouterGroup = NewRouterGroup()
-	asyncTaskLock  = sync.RWMutex{}
-	asyncTaskPool  = make(map[string]AsyncTask)
-	timerPool      = make(map[string]*timerJob)
-)
+// 默认的app对象，包级别的方法都作用在这个对象上
+var app = New()
 
 // Use 添加中间件
 func Use(m Middleware) {
-	defRouterGroup.Use(m)
+	app.Use(m)
 }
 
 // SetServerConfig 设置服务配置
 func SetServerConfig(serverConfig *ServerConfig) {
-	if serverConfig == nil {
-		serverConfig = defServerConfig()
-	}
-	app.setServerConfig(serverConfig)
+	app.SetServerConfig(serverConfig)
 }
 
 // SetLoggerConfig 设置日志配置
 func SetLoggerConfig(loggerConfig *LoggerConfig) {
-	if loggerConfig == nil {
-		loggerConfig = defLoggerConfig()
-	}
-	app.setLoggerConfig(loggerConfig)
+	app.SetLoggerConfig(loggerConfig)
 }
 
 // SetOrmConfig 设置数据库配置
 func SetOrmConfig(ormConfig *OrmConfig) {
-	if ormConfig == nil {
-		ormConfig = defOrmConfig()
-	}
-	if ormConfig.Pool == nil {
-		ormConfig.Pool = defOrmPool()
-	}
-	app.setOrmConfig(ormConfig)
+	app.SetOrmConfig(ormConfig)
 }
 
 // SetRedisConfig 设置redis配置
 func SetRedisConfig(redisConfig *RedisConfig) {
-	if redisConfig == nil {
-		redisConfig = defRedisConfig()
-	}
-	app.setRedisConfig(redisConfig)
+	app.SetRedisConfig(redisConfig)
 }
 
 // SetCorsConfig 设置跨域配置
 func SetCorsConfig(corsConfig *CorsConfig) {
-	if corsConfig == nil {
-		corsConfig = defCorsConfig()
-	}
-	if len(corsConfig.AllowOrigin) == 0 {
-		corsConfig.AllowOrigin = defCorsConfig().AllowOrigin
-	}
-	if len(corsConfig.AllowedMethods) == 0 {
-		corsConfig.AllowedMethods = defCorsConfig().AllowedMethods
-	}
-	app.setCorsConfig(corsConfig)
+	app.SetCorsConfig(corsConfig)
 }
 
 // SetCurlConfig 设置httpclient配置
 func SetCurlConfig(curlConfig *CurlConfig) {
-	if curlConfig == nil {
-		curlConfig = defCurlConfig()
-	}
-	app.setCurlConfig(curlConfig)
+	app.SetCurlConfig(curlConfig)
+}
+
+// SetCurlClientConfig 设置命名的httpclient配置
+func SetCurlClientConfig(name string, curlConfig *CurlConfig) {
+	app.SetCurlClientConfig(name, curlConfig)
+}
+
+// CurlFor 获取命名的httpclient
+func CurlFor(name string) *Curl {
+	return app.CurlFor(name)
 }
 
 // SetJwtConfig 设置JWT配置
 func SetJwtConfig(jwtConfig *JwtConfig) {
-	if jwtConfig == nil {
-		jwtConfig = defJwtConfig()
-	}
-	app.setJwtConfig(jwtConfig)
+	app.SetJwtConfig(jwtConfig)
+}
+
+// SetCookieConfig 设置cookie配置
+func SetCookieConfig(cookieConfig *CookieConfig) {
+	app.SetCookieConfig(cookieConfig)
+}
+
+// SetTemplateConfig 设置html模板配置
+func SetTemplateConfig(templateConfig *TemplateConfig) {
+	app.SetTemplateConfig(templateConfig)
 }
 
+// SetMetricsConfig 设置指标配置
+func SetMetricsConfig(metricsConfig *MetricsConfig) {
+	app.SetMetricsConfig(metricsConfig)
+}
+
+// SetPanicHandler 设置路由处理器之外的panic处理方法，路由处理器里的panic交给错误渲染方法处理
+func SetPanicHandler(ph PanicHandler) {
+	app.SetPanicHandler(ph)
+}
+
+// SetNotFoundHandle 设置路由不存在处理方法
+func SetNotFoundHandle(nfh NotFoundHandle) {
+	app.SetNotFoundHandle(nfh)
+}
+
+// SetErrorRenderer 设置错误渲染方法
+func SetErrorRenderer(renderer ErrorRenderer) {
+	app.SetErrorRenderer(renderer)
+}
+
+// RegisterCodec 注册编解码器
+func RegisterCodec(mimeType string, codec Codec) {
+	app.RegisterCodec(mimeType, codec)
+}
+
+// GetApp 获取默认的app对象
 func GetApp() *Application {
 	return app
 }
 
-func GET(path string, handler Handler) {
-	defRouterGroup.GET(path, handler)
+// NewRouterGroup 在默认的app对象上创建路由组
+func NewRouterGroup() *RouterGroup {
+	return app.NewRouterGroup()
+}
+
+// Group 在默认的app对象上创建子路由组
+func Group(prefix string, middleware ...Middleware) *RouterGroup {
+	return app.Group(prefix, middleware...)
+}
+
+func GET(path string, handler Handler, middleware ...Middleware) {
+	app.GET(path, handler, middleware...)
+}
+
+func HEAD(path string, handler Handler, middleware ...Middleware) {
+	app.HEAD(path, handler, middleware...)
+}
+
+func POST(path string, handler Handler, middleware ...Middleware) {
+	app.POST(path, handler, middleware...)
 }
 
-func HEAD(path string, handler Handler) {
-	defRouterGroup.HEAD(path, handler)
+func PUT(path string, handler Handler, middleware ...Middleware) {
+	app.PUT(path, handler, middleware...)
 }
 
-func POST(path string, handler Handler) {
-	defRouterGroup.POST(path, handler)
+func PATCH(path string, handler Handler, middleware ...Middleware) {
+	app.PATCH(path, handler, middleware...)
 }
 
-func PUT(path string, handler Handler) {
-	defRouterGroup.PUT(path, handler)
+func DELETE(path string, handler Handler, middleware ...Middleware) {
+	app.DELETE(path, handler, middleware...)
 }
 
-func PATCH(path string, handler Handler) {
-	defRouterGroup.PATCH(path, handler)
+func ALL(path string, handler Handler, middleware ...Middleware) {
+	app.ALL(path, handler, middleware...)
 }
 
-func DELETE(path string, handler Handler) {
-	defRouterGroup.DELETE(path, handler)
+// Static 将目录注册为静态文件服务
+func Static(prefix, dir string, config ...*StaticConfig) {
+	app.Static(prefix, dir, config...)
 }
 
-func ALL(path string, handler Handler) {
-	defRouterGroup.ALL(path, handler)
+// StaticFS 将文件系统注册为静态文件服务，可以使用embed.FS
+func StaticFS(prefix string, fsys fs.FS, config ...*StaticConfig) {
+	app.StaticFS(prefix, fsys, config...)
 }
 
 // AddBefore 添加运行前需要执行的方法
 func AddBefore(b BeforeRun) {
-	app.addBefore(b)
+	app.AddBefore(b)
 }
 
-// Run 启动服务
+// AddAfterStart 添加服务启动后需要执行的方法
+func AddAfterStart(a AfterStart) {
+	app.AddAfterStart(a)
+}
+
+// AddBeforeShutdown 添加服务关闭前需要执行的方法
+func AddBeforeShutdown(b BeforeShutdown) {
+	app.AddBeforeShutdown(b)
+}
+
+// AddAfterShutdown 添加服务关闭后需要执行的方法
+func AddAfterShutdown(a AfterShutdown) {
+	app.AddAfterShutdown(a)
+}
+
+// Run 启动服务，收到SIGINT或SIGTERM信号后优雅关闭服务
 func Run() error {
-	return app.run()
+	return app.Run()
+}
+
+// Shutdown 优雅关闭服务，等待正在处理的请求和任务完成，ctx用于控制等待的超时时间
+func Shutdown(ctx context.Context) error {
+	return app.Shutdown(ctx)
 }
 
 func ExecuteTask(task Task) {
-	c := make(chan *TaskResult)
-	go func() {
-		if task.GetDelay() > 0 {
-			<-time.After(task.GetDelay())
-		}
-		task.BeforeExecute(app)
-		c <- task.Execute(app)
-	}()
-	go func() {
-		select {
-		case result := <-c:
-			if task.IsTimeout() {
-				return
-			}
-			task.AfterExecute(app)
-			task.Completed(app, result)
-		case <-time.After(task.GetTimeout()):
-			task.Timeout(app)
-		}
-	}()
+	app.ExecuteTask(task)
 }
 
 func ExecuteAsyncTask(task AsyncTask) {
-	asyncTaskLock.Lock()
-	if existTask, ok := asyncTaskPool[task.GetName()]; ok {
-		existTask.Aggregation(app, task)
-		asyncTaskLock.Unlock()
-		return
-	}
-	asyncTaskPool[task.GetName()] = task
-	asyncTaskLock.Unlock()
-	c := make(chan *TaskResult)
-	go func() {
-		<-time.After(task.GetDelay())
-		delete(asyncTaskPool, task.GetName())
-		task.BeforeExecute(app)
-		c <- task.Execute(app)
-	}()
-	go func() {
-		select {
-		case result := <-c:
-			if task.IsTimeout() {
-				return
-			}
-			task.AfterExecute(app)
-			task.Completed(app, result)
-		case <-time.After(task.GetTimeout()):
-			task.Timeout(app)
-		}
-	}()
+	app.ExecuteAsyncTask(task)
 }
 
 func StartTimer(timer Timer) {
-	// 如果是周期的
-	if timer.IsPeriodic() {
-		// 如果是立即执行
-		if timer.IsImmediately() {
-			timer.Run(app)
-		}
-		ticker := time.NewTicker(timer.GetInterval())
-		stopChan := make(chan bool)
-		tJob := &timerJob{
-			stopChan: stopChan,
-			timer:    timer,
-		}
-		timerPool[timer.GetName()] = tJob
-		go func() {
-			defer func() {
-				ticker.Stop()
-				delete(timerPool, tJob.timer.GetName())
-				app.Logger.Info("timer已停止", zap.String("name", timer.GetName()))
-			}()
-			for {
-				select {
-				case <-tJob.stopChan:
-					return
-				case <-ticker.C:
-					tJob.timer.Run(app)
-				}
-			}
-		}()
-	} else {
-		t := time.NewTimer(timer.GetInterval())
-		go func() {
-			<-t.C
-			timer.Run(app)
-		}()
-	}
-	app.Logger.Info("timer已启动，名称：%s", zap.String("name", timer.GetName()))
+	app.StartTimer(timer)
 }
 
 func StopTimer(timerName string) {
-	if len(timerName) == 0 {
-		return
-	}
-	if v, ok := timerPool[timerName]; ok {
-		v.stopChan <- true
-	}
+	app.StopTimer(timerName)
 }
@@ -0,0 +1,39 @@
+package flow
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+// 创建测试用的app对象，日志写到临时目录
+func newTestApp(t *testing.T, opts ...Option) *Application {
+	t.Helper()
+	loggerConfig := defLoggerConfig()
+	loggerConfig.LoggerPath = t.TempDir()
+	app := New(append([]Option{WithLoggerConfig(loggerConfig)}, opts...)...)
+	app.Logger = zap.NewNop()
+	return app
+}
+
+// 创建测试用的请求上下文，params是路由参数
+func newTestContext(t *testing.T, app *Application, r *http.Request, params ...httprouter.Param) (*Context, *httptest.ResponseRecorder) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	return newContext(w, r, params, app), w
+}
+
+// 发送测试请求，header是请求头的key和value
+func serve(app *Application, method, target string, body io.Reader, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, body)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, r)
+	return w
+}
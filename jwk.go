@@ -0,0 +1,208 @@
+package flow
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// JwtKey 定义JWT的非对称密钥，支持RSA，ECDSA和Ed25519
+type JwtKey struct {
+	Kid            string // 密钥ID，写入token头的kid，为空时使用公钥的JWK指纹（RFC 7638）
+	Algorithm      string // 签名算法，如RS256，ES256，EdDSA，为空时根据密钥类型推断
+	PrivateKey     string // PEM格式的私钥，只用于校验的密钥可以为空
+	PrivateKeyFile string // PEM格式的私钥文件，PrivateKey为空时读取
+	PublicKey      string // PEM格式的公钥或者证书，为空时从私钥导出
+	PublicKeyFile  string // PEM格式的公钥或者证书文件，PublicKey为空时读取
+}
+
+// 定义加载后的密钥
+type jwtKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// 加载密钥，推断签名算法并计算kid
+func loadJwtKey(key JwtKey) (*jwtKey, error) {
+	privatePEM, err := readPEM(key.PrivateKey, key.PrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	publicPEM, err := readPEM(key.PublicKey, key.PublicKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	k := &jwtKey{kid: key.Kid}
+	if len(privatePEM) > 0 {
+		if k.private, err = parsePrivateKeyPEM(privatePEM); err != nil {
+			return nil, err
+		}
+		k.public = k.private.Public()
+	}
+	if len(publicPEM) > 0 {
+		if k.public, err = parsePublicKeyPEM(publicPEM); err != nil {
+			return nil, err
+		}
+	}
+	if k.public == nil {
+		return nil, errors.New("jwt key: private key or public key is required")
+	}
+	alg := key.Algorithm
+	if len(alg) == 0 {
+		if alg, err = defaultJwtAlgorithm(k.public); err != nil {
+			return nil, err
+		}
+	}
+	if k.method = jwt.GetSigningMethod(alg); k.method == nil {
+		return nil, fmt.Errorf("jwt key: unsupported algorithm %s", alg)
+	}
+	if len(k.kid) == 0 {
+		if k.kid, err = jwkThumbprint(k.public); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// 读取PEM内容，内容为空时读取文件
+func readPEM(content, file string) ([]byte, error) {
+	if len(content) > 0 {
+		return []byte(content), nil
+	}
+	if len(file) > 0 {
+		return os.ReadFile(file)
+	}
+	return nil, nil
+}
+
+// 解析PEM格式的私钥，支持PKCS8，PKCS1和SEC1格式
+func parsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("jwt key: invalid private key pem")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+		return nil, errors.New("jwt key: unsupported private key type")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("jwt key: unsupported private key format")
+}
+
+// 解析PEM格式的公钥，支持PKIX，PKCS1和证书格式
+func parsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("jwt key: invalid public key pem")
+	}
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+		return cert.PublicKey, nil
+	}
+	return nil, errors.New("jwt key: unsupported public key format")
+}
+
+// 根据公钥类型返回默认的签名算法
+func defaultJwtAlgorithm(public crypto.PublicKey) (string, error) {
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		return "RS256", nil
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return "ES256", nil
+		case elliptic.P384():
+			return "ES384", nil
+		case elliptic.P521():
+			return "ES512", nil
+		}
+	case ed25519.PublicKey:
+		return "EdDSA", nil
+	}
+	return "", fmt.Errorf("jwt key: unsupported public key type %T", public)
+}
+
+// 返回公钥的JWK，用于发布JWKS
+func (k *jwtKey) jwk() map[string]interface{} {
+	jwk := jwkFields(k.public)
+	jwk["kid"] = k.kid
+	jwk["alg"] = k.method.Alg()
+	jwk["use"] = "sig"
+	return jwk
+}
+
+// 返回公钥的JWK必需字段
+func jwkFields(public crypto.PublicKey) map[string]interface{} {
+	enc := base64.RawURLEncoding.EncodeToString
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		return map[string]interface{}{"kty": "RSA", "n": enc(k.N.Bytes()), "e": enc(big.NewInt(int64(k.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		return map[string]interface{}{"kty": "EC", "crv": k.Curve.Params().Name, "x": enc(k.X.FillBytes(make([]byte, size))), "y": enc(k.Y.FillBytes(make([]byte, size)))}
+	case ed25519.PublicKey:
+		return map[string]interface{}{"kty": "OKP", "crv": "Ed25519", "x": enc(k)}
+	}
+	return map[string]interface{}{}
+}
+
+// 计算公钥的JWK指纹，必需字段按字典序排列后计算sha256
+func jwkThumbprint(public crypto.PublicKey) (string, error) {
+	fields := jwkFields(public)
+	var canonical string
+	switch fields["kty"] {
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, fields["e"], fields["n"])
+	case "EC":
+		canonical = fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`, fields["crv"], fields["x"], fields["y"])
+	case "OKP":
+		canonical = fmt.Sprintf(`{"crv":"%s","kty":"OKP","x":"%s"}`, fields["crv"], fields["x"])
+	default:
+		return "", fmt.Errorf("jwt key: unsupported public key type %T", public)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// Jwks 返回所有非对称密钥的公钥集合，可以发布给其他服务校验token
+func (j *Jwt) Jwks() map[string]interface{} {
+	keys := make([]interface{}, 0, len(j.keys))
+	for _, k := range j.keys {
+		keys = append(keys, k.jwk())
+	}
+	return map[string]interface{}{"keys": keys}
+}
+
+// JwksHandler 返回发布JWKS的路由处理器
+func (j *Jwt) JwksHandler() Handler {
+	return func(ctx *Context) {
+		ctx.SetHeader(HttpHeaderCacheControl, "public, max-age=300")
+		ctx.Json(j.Jwks())
+	}
+}
@@ -0,0 +1,312 @@
+package flow
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// 生成PEM格式的私钥和公钥
+func newTestKeyPEM(t *testing.T, kind string) (string, string) {
+	t.Helper()
+	var private crypto.Signer
+	var err error
+	switch kind {
+	case "RSA":
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "EC":
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "Ed25519":
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateDer, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDer, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDer})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDer}))
+}
+
+func TestLoadJwtKey(t *testing.T) {
+	rsaPrivate, rsaPublic := newTestKeyPEM(t, "RSA")
+	ecPrivate, _ := newTestKeyPEM(t, "EC")
+	edPrivate, _ := newTestKeyPEM(t, "Ed25519")
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	pkcs1 := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}))
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	sec1Der, _ := x509.MarshalECPrivateKey(ecKey)
+	sec1 := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1Der}))
+	keyFile := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(keyFile, []byte(ecPrivate), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		key     JwtKey
+		alg     string
+		private bool
+		err     bool
+	}{
+		{"rsa pkcs8", JwtKey{PrivateKey: rsaPrivate}, "RS256", true, false},
+		{"rsa pkcs1", JwtKey{PrivateKey: pkcs1}, "RS256", true, false},
+		{"rsa explicit algorithm", JwtKey{PrivateKey: rsaPrivate, Algorithm: "PS256"}, "PS256", true, false},
+		{"rsa public only", JwtKey{PublicKey: rsaPublic}, "RS256", false, false},
+		{"ec p256", JwtKey{PrivateKey: ecPrivate}, "ES256", true, false},
+		{"ec sec1 p384", JwtKey{PrivateKey: sec1}, "ES384", true, false},
+		{"ec file", JwtKey{PrivateKeyFile: keyFile}, "ES256", true, false},
+		{"ed25519", JwtKey{PrivateKey: edPrivate}, "EdDSA", true, false},
+		{"no key", JwtKey{}, "", false, true},
+		{"invalid pem", JwtKey{PrivateKey: "garbage"}, "", false, true},
+		{"unsupported algorithm", JwtKey{PrivateKey: rsaPrivate, Algorithm: "XX256"}, "", false, true},
+		{"missing file", JwtKey{PrivateKeyFile: filepath.Join(t.TempDir(), "missing.pem")}, "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := loadJwtKey(tt.key)
+			if (err != nil) != tt.err {
+				t.Fatalf("loadJwtKey() error = %v, want error %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if k.method.Alg() != tt.alg {
+				t.Errorf("algorithm = %s, want %s", k.method.Alg(), tt.alg)
+			}
+			if (k.private != nil) != tt.private {
+				t.Errorf("private = %v, want %v", k.private != nil, tt.private)
+			}
+			if len(k.kid) == 0 {
+				t.Error("kid is empty")
+			}
+		})
+	}
+}
+
+func TestJwkThumbprint(t *testing.T) {
+	// RFC 7638 3.1的示例
+	n, _ := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	public := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537}
+	got, err := jwkThumbprint(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; got != want {
+		t.Errorf("jwkThumbprint() = %s, want %s", got, want)
+	}
+}
+
+func TestJwtAsymmetricKeys(t *testing.T) {
+	for _, kind := range []string{"RSA", "EC", "Ed25519"} {
+		t.Run(kind, func(t *testing.T) {
+			private, public := newTestKeyPEM(t, kind)
+			signer := newJwtApp(t, &JwtConfig{Keys: []JwtKey{{PrivateKey: private}}, DisableJwks: true})
+			verifier := newJwtApp(t, &JwtConfig{Keys: []JwtKey{{PublicKey: public}}, DisableJwks: true})
+			token, err := signer.Jwt.Sign(map[string]interface{}{"uid": "1"})
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+			data, err := verifier.Jwt.Valid(token)
+			if err != nil || data["uid"] != "1" {
+				t.Fatalf("Valid() = %v, %v", data, err)
+			}
+			if _, err = verifier.Jwt.Sign(nil); err == nil {
+				t.Error("Sign() with a public key error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestJwtKeyRotation(t *testing.T) {
+	oldPrivate, oldPublic := newTestKeyPEM(t, "EC")
+	newPrivate, _ := newTestKeyPEM(t, "EC")
+	otherPrivate, _ := newTestKeyPEM(t, "EC")
+	old := newJwtApp(t, &JwtConfig{Keys: []JwtKey{{Kid: "old", PrivateKey: oldPrivate}}})
+	oldToken, _ := old.Jwt.Sign(nil)
+	// 新密钥放在第一个用于签名，旧密钥只用于校验
+	app := newJwtApp(t, &JwtConfig{Keys: []JwtKey{{Kid: "new", PrivateKey: newPrivate}, {Kid: "old", PublicKey: oldPublic}}})
+	newToken, _ := app.Jwt.Sign(nil)
+	other := newJwtApp(t, &JwtConfig{Keys: []JwtKey{{Kid: "old", PrivateKey: otherPrivate}}})
+	forgedToken, _ := other.Jwt.Sign(nil)
+	unknown := newJwtApp(t, &JwtConfig{Keys: []JwtKey{{Kid: "unknown", PrivateKey: otherPrivate}}})
+	unknownToken, _ := unknown.Jwt.Sign(nil)
+
+	tests := []struct {
+		name  string
+		token string
+		kid   string
+		valid bool
+	}{
+		{"new key", newToken, "new", true},
+		{"old key", oldToken, "old", true},
+		{"same kid other key", forgedToken, "old", false},
+		{"unknown kid", unknownToken, "unknown", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, _, err := jwt.NewParser().ParseUnverified(tt.token, &Claims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Header["kid"] != tt.kid {
+				t.Errorf("kid = %v, want %s", parsed.Header["kid"], tt.kid)
+			}
+			if _, err = app.Jwt.Valid(tt.token); (err == nil) != tt.valid {
+				t.Errorf("Valid() error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestJwtAlgorithmPinning(t *testing.T) {
+	private, public := newTestKeyPEM(t, "RSA")
+	app := newJwtApp(t, &JwtConfig{Keys: []JwtKey{{Kid: "k1", PrivateKey: private}}})
+	claims := &Claims{RegisteredClaims: jwt.RegisteredClaims{Issuer: "flow", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}}
+	rsaKey, _ := jwt.ParseRSAPrivateKeyFromPEM([]byte(private))
+	tests := []struct {
+		name   string
+		method jwt.SigningMethod
+		key    interface{}
+	}{
+		// 使用公钥作为HS256的秘钥签名，防止算法混淆攻击
+		{"HS256 with public key", jwt.SigningMethodHS256, []byte(public)},
+		{"same key other algorithm", jwt.SigningMethodRS512, rsaKey},
+		{"PS256 with same key", jwt.SigningMethodPS256, rsaKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := jwt.NewWithClaims(tt.method, claims)
+			token.Header["kid"] = "k1"
+			signed, err := token.SignedString(tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = app.Jwt.Valid(signed); err == nil {
+				t.Error("Valid() error = nil, want error")
+			}
+		})
+	}
+	// 同样的声明使用配置的算法签名可以通过校验
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "k1"
+	signed, _ := token.SignedString(rsaKey)
+	if _, err := app.Jwt.Valid(signed); err != nil {
+		t.Errorf("Valid() error = %v, want nil", err)
+	}
+}
+
+func TestJwtDuplicateKid(t *testing.T) {
+	private, _ := newTestKeyPEM(t, "Ed25519")
+	app := newTestApp(t, WithJwtConfig(&JwtConfig{Keys: []JwtKey{{PrivateKey: private}, {PrivateKey: private}}}))
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(r.(error).Error(), "duplicate kid") {
+			t.Errorf("initJwt() panic = %v, want duplicate kid", r)
+		}
+	}()
+	initJwt(app)
+}
+
+func TestJwksHandler(t *testing.T) {
+	rsaPrivate, _ := newTestKeyPEM(t, "RSA")
+	_, ecPublic := newTestKeyPEM(t, "EC")
+	edPrivate, _ := newTestKeyPEM(t, "Ed25519")
+	app := newJwtApp(t, &JwtConfig{Keys: []JwtKey{{Kid: "rsa", PrivateKey: rsaPrivate}, {PublicKey: ecPublic}, {Kid: "ed", PrivateKey: edPrivate}}})
+	w := serve(app, http.MethodGet, "/.well-known/jwks.json", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if w.Header().Get(HttpHeaderCacheControl) == "" {
+		t.Error("Cache-Control is empty")
+	}
+	var jwks struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &jwks); err != nil {
+		t.Fatal(err)
+	}
+	if len(jwks.Keys) != 3 {
+		t.Fatalf("got %d keys, want 3", len(jwks.Keys))
+	}
+	want := []map[string]string{
+		{"kid": "rsa", "kty": "RSA", "alg": "RS256", "use": "sig", "e": "AQAB"},
+		{"kid": app.Jwt.keys[1].kid, "kty": "EC", "alg": "ES256", "crv": "P-256"},
+		{"kid": "ed", "kty": "OKP", "alg": "EdDSA", "crv": "Ed25519"},
+	}
+	for i, fields := range want {
+		for k, v := range fields {
+			if jwks.Keys[i][k] != v {
+				t.Errorf("keys[%d].%s = %q, want %q", i, k, jwks.Keys[i][k], v)
+			}
+		}
+		for _, k := range []string{"d", "p", "q"} {
+			if _, ok := jwks.Keys[i][k]; ok {
+				t.Errorf("keys[%d] contains private field %s", i, k)
+			}
+		}
+	}
+
+	// 没有非对称密钥或者关闭了JWKS时不注册路由
+	for _, cfg := range []*JwtConfig{{SecretKey: "secret"}, {Keys: []JwtKey{{PrivateKey: edPrivate}}, DisableJwks: true}} {
+		app = newJwtApp(t, cfg)
+		if w = serve(app, http.MethodGet, "/.well-known/jwks.json", nil); w.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want 404", w.Code)
+		}
+	}
+}
+
+func TestJwtAuthSkipsJwks(t *testing.T) {
+	edPrivate, _ := newTestKeyPEM(t, "Ed25519")
+	tests := []struct {
+		name   string
+		config *JwtConfig
+		path   string
+		status int
+	}{
+		{"default path", &JwtConfig{Keys: []JwtKey{{PrivateKey: edPrivate}}}, "/.well-known/jwks.json", http.StatusOK},
+		{"custom path", &JwtConfig{Keys: []JwtKey{{PrivateKey: edPrivate}}, JwksPath: "/keys"}, "/keys", http.StatusOK},
+		{"other routes still need token", &JwtConfig{Keys: []JwtKey{{PrivateKey: edPrivate}}}, "/admin", http.StatusUnauthorized},
+		// 关闭了JWKS时同名的路由由用户自己注册，不自动跳过认证
+		{"disabled jwks", &JwtConfig{Keys: []JwtKey{{PrivateKey: edPrivate}}, DisableJwks: true}, "/.well-known/jwks.json", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, WithJwtConfig(tt.config))
+			app.Use(JwtAuth())
+			app.GET("/admin", func(ctx *Context) {
+				ctx.Text("admin")
+			})
+			if tt.config.DisableJwks {
+				app.GET(tt.config.JwksPath, func(ctx *Context) {
+					ctx.Text("custom")
+				})
+			}
+			initJwt(app)
+			if w := serve(app, http.MethodGet, tt.path, nil); w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
@@ -1,28 +1,97 @@
 package flow
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/funswe/flow/utils/json"
 	"github.com/golang-jwt/jwt/v4"
 	"go.uber.org/zap"
-	"time"
+)
+
+const (
+	JwtClaimsKey = "jwt_claims" // JwtAuth中间件保存*Claims的key，通过ctx.GetData获取
+	JwtTokenKey  = "jwt_token"  // JwtAuth中间件保存原始token的key，可以用于ParseClaims
+)
+
+var (
+	// ErrJwtNotInit 没有设置JWT配置
+	ErrJwtNotInit = errors.New("jwt config is not set")
+	// ErrTokenMissing 请求里没有token
+	ErrTokenMissing = errors.New("jwt token is missing")
+	// ErrTokenRevoked token已经被撤销
+	ErrTokenRevoked = errors.New("jwt token has been revoked")
+	// ErrTokenType token类型不对，如使用refresh token访问接口
+	ErrTokenType = errors.New("jwt token type is invalid")
+	// ErrRefreshTokenReused 已经使用过的refresh token再次使用，整个token链会被撤销
+	ErrRefreshTokenReused = errors.New("jwt refresh token has been reused")
+)
+
+// 定义token的类型，写入token头的typ
+const (
+	jwtTypeAccess  = "JWT"
+	jwtTypeRefresh = "refresh+jwt"
 )
 
 // JwtConfig 定义JWT配置
 type JwtConfig struct {
-	Timeout   time.Duration // 请求的超时时间，单位小时
-	SecretKey string        // 秘钥
+	Timeout        time.Duration // token的有效时间，默认值24小时
+	RefreshTimeout time.Duration // refresh token的有效时间，默认值7天
+	SecretKey      string        // HS256的秘钥，没有设置Keys时使用
+	Keys           []JwtKey      // 非对称密钥，设置后使用非对称算法，第一个有私钥的密钥用于签名，所有的密钥都用于校验
+	Issuer         string        // 签发者，签名时写入iss，不为空时校验iss，默认值flow
+	Audience       []string      // 受众，签名时写入aud，不为空时要求token的aud包含其中一个
+	NotBefore      time.Duration // 签发后多久生效，签名时写入nbf，默认值0立即生效
+	Leeway         time.Duration // 校验exp，nbf和iat时允许的时钟偏差，默认值0
+	JwksPath       string        // 发布JWKS的路由，默认值/.well-known/jwks.json，只在设置了Keys时注册，JwtAuth中间件自动跳过该路由
+	DisableJwks    bool          // 是否不注册发布JWKS的路由
 }
 
 // 返回默认的JWT配置
 func defJwtConfig() *JwtConfig {
 	return &JwtConfig{
-		Timeout: 24 * time.Hour, // 默认24小时有效时间
+		Timeout:        24 * time.Hour, // 默认24小时有效时间
+		RefreshTimeout: 7 * 24 * time.Hour,
+		Issuer:         "flow",
+		JwksPath:       "/.well-known/jwks.json",
 	}
 }
 
 // Jwt 定义JWT对象
 type Jwt struct {
-	app *Application
+	app     *Application
+	keys    []*jwtKey          // 加载后的非对称密钥
+	keyMap  map[string]*jwtKey // kid对应的密钥
+	signKey *jwtKey            // 用于签名的密钥
+}
+
+// 创建JWT对象，加载非对称密钥
+func newJwt(app *Application) (*Jwt, error) {
+	j := &Jwt{app: app, keyMap: make(map[string]*jwtKey)}
+	for i := range app.jwtConfig.Keys {
+		k, err := loadJwtKey(app.jwtConfig.Keys[i])
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := j.keyMap[k.kid]; ok {
+			return nil, fmt.Errorf("jwt key: duplicate kid %s", k.kid)
+		}
+		j.keys = append(j.keys, k)
+		j.keyMap[k.kid] = k
+		if j.signKey == nil && k.private != nil {
+			j.signKey = k
+		}
+	}
+	if len(j.keys) > 0 && j.signKey == nil {
+		app.Logger.Warn("jwt keys have no private key, tokens can only be verified")
+	}
+	return j, nil
 }
 
 type Claims struct {
@@ -30,33 +99,275 @@ type Claims struct {
 	Data map[string]interface{}
 }
 
-func (j *Jwt) Sign(data map[string]interface{}) (string, error) {
-	claims := &Claims{
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(app.jwtConfig.Timeout)), // 过期时间，必须设置
-			Issuer:    "flow",                                                    // 可不必设置，也可以填充用户名，
-		},
-		Data: data,
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims) //生成token
-	accessToken, err := token.SignedString([]byte(j.app.jwtConfig.SecretKey))
-	if err != nil {
-		return "", err
+// TypedClaims 定义自定义数据类型的声明，和Claims的json格式一致，Data可以使用自己的结构体
+type TypedClaims[T any] struct {
+	jwt.RegisteredClaims
+	Data T
+}
+
+// 定义refresh token的声明，Data保存原始的json数据，刷新时原样写入新的token
+type refreshClaims struct {
+	jwt.RegisteredClaims
+	Data   json.RawMessage `json:"Data,omitempty"`
+	Family string          `json:"fam,omitempty"` // token链的ID，同一个登录刷新得到的refresh token属于同一个token链
+}
+
+// TokenPair 定义access token和refresh token
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // access token的有效时间，单位秒
+}
+
+// 定义包含注册声明的声明
+type registeredClaimsHolder interface {
+	jwt.Claims
+	registered() *jwt.RegisteredClaims
+}
+
+func (c *Claims) registered() *jwt.RegisteredClaims {
+	return &c.RegisteredClaims
+}
+
+func (c *TypedClaims[T]) registered() *jwt.RegisteredClaims {
+	return &c.RegisteredClaims
+}
+
+func (c *refreshClaims) registered() *jwt.RegisteredClaims {
+	return &c.RegisteredClaims
+}
+
+// 生成随机的token ID
+func newTokenId() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
 	}
-	return accessToken, nil
+	return base64.RawURLEncoding.EncodeToString(b)
 }
 
-func (j *Jwt) Valid(token string) (map[string]interface{}, error) {
-	tokenClaims, err := jwt.ParseWithClaims(token, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+// 返回默认的注册声明
+func (j *Jwt) registeredClaims() jwt.RegisteredClaims {
+	now := time.Now()
+	cfg := j.app.jwtConfig
+	claims := jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(now.Add(cfg.Timeout)), // 过期时间，必须设置
+		IssuedAt:  jwt.NewNumericDate(now),
+		ID:        newTokenId(),
+		Issuer:    cfg.Issuer,
+		Audience:  cfg.Audience,
+	}
+	if cfg.NotBefore > 0 {
+		claims.NotBefore = jwt.NewNumericDate(now.Add(cfg.NotBefore))
+	}
+	return claims
+}
+
+// 签名声明，返回token，设置了非对称密钥时使用签名密钥，并在token头写入kid
+func (j *Jwt) sign(claims jwt.Claims, typ string) (string, error) {
+	if len(j.keys) == 0 {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims) //生成token
+		token.Header["typ"] = typ
+		return token.SignedString([]byte(j.app.jwtConfig.SecretKey))
+	}
+	if j.signKey == nil {
+		return "", errors.New("jwt key: no private key for signing")
+	}
+	token := jwt.NewWithClaims(j.signKey.method, claims)
+	token.Header["typ"] = typ
+	token.Header["kid"] = j.signKey.kid
+	return token.SignedString(j.signKey.private)
+}
+
+// 根据token头的kid和算法返回校验的密钥，算法必须和密钥的算法一致，防止算法混淆攻击
+func (j *Jwt) verifyKey(token *jwt.Token) (interface{}, error) {
+	if len(j.keys) == 0 {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
 		return []byte(j.app.jwtConfig.SecretKey), nil
-	})
+	}
+	k := j.signKey
+	if kid, ok := token.Header["kid"].(string); ok {
+		k = j.keyMap[kid]
+	}
+	if k == nil {
+		return nil, fmt.Errorf("unknown kid %v", token.Header["kid"])
+	}
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return k.public, nil
+}
+
+// 校验token并解析到声明里，注册声明使用配置的签发者、受众和时钟偏差校验，最后检查token是否已经撤销
+func (j *Jwt) parse(token string, claims registeredClaimsHolder, typ string) error {
+	parser := jwt.NewParser(jwt.WithoutClaimsValidation())
+	parsed, err := parser.ParseWithClaims(token, claims, j.verifyKey)
 	if err != nil {
+		return err
+	}
+	// 没有typ的是之前签发的access token
+	if t, _ := parsed.Header["typ"].(string); (t == jwtTypeRefresh) != (typ == jwtTypeRefresh) {
+		return ErrTokenType
+	}
+	cfg := j.app.jwtConfig
+	rc := claims.registered()
+	now := time.Now()
+	if !rc.VerifyExpiresAt(now.Add(-cfg.Leeway), true) {
+		return jwt.ErrTokenExpired
+	}
+	if !rc.VerifyNotBefore(now.Add(cfg.Leeway), false) {
+		return jwt.ErrTokenNotValidYet
+	}
+	if !rc.VerifyIssuedAt(now.Add(cfg.Leeway), false) {
+		return jwt.ErrTokenUsedBeforeIssued
+	}
+	if len(cfg.Issuer) > 0 && !rc.VerifyIssuer(cfg.Issuer, true) {
+		return jwt.ErrTokenInvalidIssuer
+	}
+	if len(cfg.Audience) > 0 {
+		matched := false
+		for _, aud := range cfg.Audience {
+			if rc.VerifyAudience(aud, true) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return jwt.ErrTokenInvalidAudience
+		}
+	}
+	return j.checkRevoked(rc.ID)
+}
+
+func (j *Jwt) Sign(data map[string]interface{}) (string, error) {
+	return j.sign(&Claims{RegisteredClaims: j.registeredClaims(), Data: data}, jwtTypeAccess)
+}
+
+func (j *Jwt) Valid(token string) (map[string]interface{}, error) {
+	claims := &Claims{}
+	if err := j.parse(token, claims, jwtTypeAccess); err != nil {
 		return nil, err
 	}
-	if claims, ok := tokenClaims.Claims.(*Claims); ok && tokenClaims.Valid {
-		return claims.Data, nil
+	return claims.Data, nil
+}
+
+// SignClaims 使用自定义的数据类型签名，如flow.SignClaims(ctx.Jwt, User{Id: 1})
+func SignClaims[T any](j *Jwt, data T) (string, error) {
+	if j == nil {
+		return "", ErrJwtNotInit
+	}
+	return j.sign(&TypedClaims[T]{RegisteredClaims: j.registeredClaims(), Data: data}, jwtTypeAccess)
+}
+
+// ParseClaims 校验token并解析成自定义的数据类型，如flow.ParseClaims[User](ctx.Jwt, token)
+func ParseClaims[T any](j *Jwt, token string) (T, error) {
+	claims := &TypedClaims[T]{}
+	if j == nil {
+		return claims.Data, ErrJwtNotInit
+	}
+	if err := j.parse(token, claims, jwtTypeAccess); err != nil {
+		return claims.Data, err
+	}
+	return claims.Data, nil
+}
+
+// ContextClaims 将JwtAuth中间件校验过的token解析成自定义的数据类型
+func ContextClaims[T any](ctx *Context) (T, error) {
+	token, _ := ctx.GetData(JwtTokenKey)
+	if v, ok := token.(string); ok && len(v) > 0 {
+		return ParseClaims[T](ctx.Jwt, v)
 	}
-	return nil, errors.New("invalid token")
+	var data T
+	return data, ErrTokenMissing
+}
+
+// JwtAuthConfig 定义JWT认证中间件的配置
+type JwtAuthConfig struct {
+	CookieName   string                        // 从cookie获取token的名称，为空时不从cookie获取
+	QueryName    string                        // 从query参数获取token的名称，为空时不从query获取
+	SkipPaths    []string                      // 不需要认证的路径，忽略结尾的/，以*结尾的按前缀匹配，如/public/*，也可以是注册的路由，如/users/:id
+	Skipper      func(ctx *Context) bool       // 自定义的跳过认证的方法，返回true时不认证
+	Unauthorized func(ctx *Context, err error) // 认证失败的处理方法，默认返回401
+}
+
+// JwtAuth 返回JWT认证中间件，依次从Authorization: Bearer请求头、cookie和query参数获取token，
+// 认证通过后将*Claims和token分别保存到JwtClaimsKey和JwtTokenKey
+func JwtAuth(jwtAuthConfig ...*JwtAuthConfig) Middleware {
+	cfg := &JwtAuthConfig{}
+	if len(jwtAuthConfig) > 0 && jwtAuthConfig[0] != nil {
+		cfg = jwtAuthConfig[0]
+	}
+	if cfg.Unauthorized == nil {
+		cfg.Unauthorized = func(ctx *Context, err error) {
+			ctx.SetHeader(HttpHeaderWWWAuthenticate, "Bearer")
+			ctx.Error(NewHTTPError(http.StatusUnauthorized, 0, "").WithError(err))
+		}
+	}
+	return func(ctx *Context, next Next) {
+		if cfg.skip(ctx) {
+			next()
+			return
+		}
+		if ctx.Jwt == nil {
+			cfg.Unauthorized(ctx, ErrJwtNotInit)
+			return
+		}
+		token := cfg.extractToken(ctx)
+		if len(token) == 0 {
+			cfg.Unauthorized(ctx, ErrTokenMissing)
+			return
+		}
+		claims := &Claims{}
+		if err := ctx.Jwt.parse(token, claims, jwtTypeAccess); err != nil {
+			cfg.Unauthorized(ctx, err)
+			return
+		}
+		ctx.SetData(JwtClaimsKey, claims)
+		ctx.SetData(JwtTokenKey, token)
+		next()
+	}
+}
+
+// 判断请求是否跳过认证，预检请求和发布JWKS的路由不认证
+func (cfg *JwtAuthConfig) skip(ctx *Context) bool {
+	if isPreflight(ctx) || (cfg.Skipper != nil && cfg.Skipper(ctx)) {
+		return true
+	}
+	// 校验方需要在没有token时获取公钥，按注册的路由匹配
+	if jc := ctx.app.jwtConfig; jc != nil && len(jc.Keys) > 0 && !jc.DisableJwks && len(ctx.route) > 0 && ctx.route == jc.JwksPath {
+		return true
+	}
+	// 清理路径里的//和..，防止通过/public/../admin绕过认证
+	uri := path.Clean(ctx.GetUri())
+	for _, p := range cfg.SkipPaths {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			// /public/*同时匹配/public
+			if strings.HasPrefix(uri, prefix) || uri == strings.TrimSuffix(prefix, "/") {
+				return true
+			}
+		} else if uri == path.Clean(p) || (len(ctx.route) > 0 && ctx.route == p) {
+			return true
+		}
+	}
+	return false
+}
+
+// 从请求头、cookie和query参数获取token
+func (cfg *JwtAuthConfig) extractToken(ctx *Context) string {
+	if auth := ctx.GetHeader(HttpHeaderAuthorization); len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	if len(cfg.CookieName) > 0 {
+		if token, err := ctx.Cookie(cfg.CookieName); err == nil && len(token) > 0 {
+			return token
+		}
+	}
+	if len(cfg.QueryName) > 0 {
+		return ctx.GetQuery().Get(cfg.QueryName)
+	}
+	return ""
 }
 
 // 初始化JWT对象
@@ -64,6 +375,22 @@ func initJwt(app *Application) {
 	if app.jwtConfig == nil {
 		return
 	}
-	app.Jwt = &Jwt{app: app}
-	app.Logger.Info("jwt server started", zap.Any("config", app.jwtConfig))
+	j, err := newJwt(app)
+	if err != nil {
+		panic(err)
+	}
+	app.Jwt = j
+	algorithm, kids := jwt.SigningMethodHS256.Alg(), make([]string, 0, len(j.keys))
+	for _, k := range j.keys {
+		kids = append(kids, k.kid)
+	}
+	if j.signKey != nil {
+		algorithm = j.signKey.method.Alg()
+	}
+	if len(j.keys) > 0 && !app.jwtConfig.DisableJwks {
+		app.GET(app.jwtConfig.JwksPath, j.JwksHandler())
+	}
+	// 不打印秘钥和私钥
+	app.Logger.Info("jwt server started", zap.String("algorithm", algorithm), zap.Strings("kids", kids),
+		zap.String("issuer", app.jwtConfig.Issuer), zap.Strings("audience", app.jwtConfig.Audience))
 }
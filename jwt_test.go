@@ -0,0 +1,248 @@
+package flow
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// 创建开启了JWT的测试app
+func newJwtApp(t *testing.T, jwtConfig *JwtConfig) *Application {
+	t.Helper()
+	app := newTestApp(t, WithJwtConfig(jwtConfig))
+	initJwt(app)
+	return app
+}
+
+func TestJwtSignAndValid(t *testing.T) {
+	app := newJwtApp(t, &JwtConfig{SecretKey: "secret"})
+	token, err := app.Jwt.Sign(map[string]interface{}{"uid": "1"})
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	data, err := app.Jwt.Valid(token)
+	if err != nil {
+		t.Fatalf("Valid() error = %v", err)
+	}
+	if data["uid"] != "1" {
+		t.Errorf("Valid() = %v, want uid 1", data)
+	}
+
+	type user struct {
+		Id   int64
+		Name string
+	}
+	token, err = SignClaims(app.Jwt, user{Id: 1, Name: "bob"})
+	if err != nil {
+		t.Fatalf("SignClaims() error = %v", err)
+	}
+	u, err := ParseClaims[user](app.Jwt, token)
+	if err != nil || u != (user{Id: 1, Name: "bob"}) {
+		t.Errorf("ParseClaims() = %+v, %v", u, err)
+	}
+	if _, err = ParseClaims[user](nil, token); !errors.Is(err, ErrJwtNotInit) {
+		t.Errorf("ParseClaims(nil) error = %v, want ErrJwtNotInit", err)
+	}
+}
+
+func TestJwtClaimsValidation(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		config JwtConfig // 校验token使用的配置，SecretKey固定为secret
+		claims jwt.RegisteredClaims
+		typ    string
+		err    error
+	}{
+		{"valid", JwtConfig{Issuer: "flow"}, jwt.RegisteredClaims{Issuer: "flow", ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour))}, jwtTypeAccess, nil},
+		{"no typ header", JwtConfig{}, jwt.RegisteredClaims{Issuer: "flow", ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour))}, "", nil},
+		{"missing exp", JwtConfig{}, jwt.RegisteredClaims{}, jwtTypeAccess, jwt.ErrTokenExpired},
+		{"expired", JwtConfig{}, jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(-time.Minute))}, jwtTypeAccess, jwt.ErrTokenExpired},
+		{"expired within leeway", JwtConfig{Leeway: 2 * time.Minute}, jwt.RegisteredClaims{Issuer: "flow", ExpiresAt: jwt.NewNumericDate(now.Add(-time.Minute))}, jwtTypeAccess, nil},
+		{"not valid yet", JwtConfig{}, jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)), NotBefore: jwt.NewNumericDate(now.Add(time.Minute))}, jwtTypeAccess, jwt.ErrTokenNotValidYet},
+		{"issued in future", JwtConfig{}, jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)), IssuedAt: jwt.NewNumericDate(now.Add(time.Minute))}, jwtTypeAccess, jwt.ErrTokenUsedBeforeIssued},
+		{"default issuer", JwtConfig{}, jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour))}, jwtTypeAccess, jwt.ErrTokenInvalidIssuer},
+		{"wrong issuer", JwtConfig{Issuer: "flow"}, jwt.RegisteredClaims{Issuer: "other", ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour))}, jwtTypeAccess, jwt.ErrTokenInvalidIssuer},
+		{"audience matched", JwtConfig{Audience: []string{"a", "b"}}, jwt.RegisteredClaims{Issuer: "flow", Audience: []string{"b"}, ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour))}, jwtTypeAccess, nil},
+		{"audience not matched", JwtConfig{Audience: []string{"a"}}, jwt.RegisteredClaims{Issuer: "flow", Audience: []string{"c"}, ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour))}, jwtTypeAccess, jwt.ErrTokenInvalidAudience},
+		{"refresh token as access token", JwtConfig{}, jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour))}, jwtTypeRefresh, ErrTokenType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.config
+			cfg.SecretKey = "secret"
+			app := newJwtApp(t, &cfg)
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{RegisteredClaims: tt.claims})
+			if len(tt.typ) > 0 {
+				token.Header["typ"] = tt.typ
+			} else {
+				delete(token.Header, "typ")
+			}
+			signed, err := token.SignedString([]byte("secret"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = app.Jwt.Valid(signed); !errors.Is(err, tt.err) {
+				t.Errorf("Valid() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestJwtRejectsOtherKeysAndAlgorithms(t *testing.T) {
+	app := newJwtApp(t, &JwtConfig{SecretKey: "secret"})
+	claims := &Claims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}}
+	otherKey, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("other"))
+	hs512, _ := jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString([]byte("secret"))
+	none, _ := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	for name, token := range map[string]string{"other key": otherKey, "HS512": hs512, "none": none, "garbage": "a.b.c"} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := app.Jwt.Valid(token); err == nil {
+				t.Error("Valid() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestJwtAuth(t *testing.T) {
+	app := newJwtApp(t, &JwtConfig{SecretKey: "secret"})
+	token, _ := app.Jwt.Sign(map[string]interface{}{"uid": "1"})
+	app.Use(JwtAuth(&JwtAuthConfig{
+		CookieName: "token",
+		QueryName:  "access_token",
+		SkipPaths:  []string{"/health/", "/public/*", "/users/:id"},
+		Skipper: func(ctx *Context) bool {
+			return ctx.GetHeader("X-Internal") == "1"
+		},
+	}))
+	handler := func(ctx *Context) {
+		uid := ""
+		if v, ok := ctx.GetData(JwtClaimsKey); ok {
+			uid, _ = v.(*Claims).Data["uid"].(string)
+		}
+		ctx.Text("uid=" + uid)
+	}
+	for _, p := range []string{"/me", "/health", "/public", "/public/a/b", "/users/:id", "/admin"} {
+		app.GET(p, handler)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		header []string
+		status int
+		want   string
+	}{
+		{"bearer header", "/me", []string{HttpHeaderAuthorization, "Bearer " + token}, http.StatusOK, "uid=1"},
+		{"bearer is case insensitive", "/me", []string{HttpHeaderAuthorization, "bearer " + token}, http.StatusOK, "uid=1"},
+		{"cookie", "/me", []string{"Cookie", "token=" + token}, http.StatusOK, "uid=1"},
+		{"query", "/me?access_token=" + token, nil, http.StatusOK, "uid=1"},
+		{"missing token", "/me", nil, http.StatusUnauthorized, ""},
+		{"basic auth is not a token", "/me", []string{HttpHeaderAuthorization, "Basic " + token}, http.StatusUnauthorized, ""},
+		{"invalid token", "/me", []string{HttpHeaderAuthorization, "Bearer a.b.c"}, http.StatusUnauthorized, ""},
+		{"skip path with trailing slash", "/health", nil, http.StatusOK, "uid="},
+		{"skip prefix base path", "/public", nil, http.StatusOK, "uid="},
+		{"skip prefix", "/public/a/b", nil, http.StatusOK, "uid="},
+		{"skip route pattern", "/users/42", nil, http.StatusOK, "uid="},
+		{"skipper", "/admin", []string{"X-Internal", "1"}, http.StatusOK, "uid="},
+		{"preflight", "/me", []string{HttpHeaderOrigin, "https://a.com", HttpHeaderCorsRequestMethod, "GET"}, http.StatusNoContent, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := http.MethodGet
+			if tt.name == "preflight" {
+				method = http.MethodOptions
+			}
+			w := serve(app, method, tt.target, nil, tt.header...)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.status == http.StatusUnauthorized && w.Header().Get(HttpHeaderWWWAuthenticate) != "Bearer" {
+				t.Errorf("WWW-Authenticate = %q, want Bearer", w.Header().Get(HttpHeaderWWWAuthenticate))
+			}
+			if tt.status == http.StatusOK && w.Body.String() != tt.want {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestJwtAuthSkip(t *testing.T) {
+	cfg := &JwtAuthConfig{SkipPaths: []string{"/health/", "/public/*", "/users/:id"}}
+	app := newTestApp(t)
+	tests := []struct {
+		path  string
+		route string
+		want  bool
+	}{
+		{"/health", "/health", true},
+		{"/health/", "", true},
+		{"/public", "/public", true},
+		{"/public/", "", true},
+		{"/public/a", "/public/a", true},
+		{"/publicity", "/publicity", false},
+		{"/public/../admin", "", false},
+		{"//public/a", "", true},
+		{"/users/42", "/users/:id", true},
+		{"/users/42", "", false},
+		{"/users/:id", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.URL.Path = tt.path
+			c, _ := newTestContext(t, app, r)
+			c.route = tt.route
+			if got := cfg.skip(c); got != tt.want {
+				t.Errorf("skip(%q, route %q) = %v, want %v", tt.path, tt.route, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJwtAuthWithoutJwt(t *testing.T) {
+	app := newTestApp(t)
+	var got error
+	app.Use(JwtAuth(&JwtAuthConfig{Unauthorized: func(ctx *Context, err error) {
+		got = err
+		ctx.SetStatus(http.StatusForbidden)
+	}}))
+	app.GET("/me", func(ctx *Context) {
+		ctx.Text("ok")
+	})
+	w := serve(app, http.MethodGet, "/me", nil)
+	if w.Code != http.StatusForbidden || !errors.Is(got, ErrJwtNotInit) {
+		t.Errorf("status = %d, error = %v, want 403 and ErrJwtNotInit", w.Code, got)
+	}
+}
+
+func TestContextClaims(t *testing.T) {
+	type user struct {
+		Id int64
+	}
+	app := newJwtApp(t, &JwtConfig{SecretKey: "secret"})
+	token, _ := SignClaims(app.Jwt, user{Id: 7})
+	app.GET("/me", func(ctx *Context) {
+		u, err := ContextClaims[user](ctx)
+		if err != nil {
+			ctx.Error(err)
+			return
+		}
+		ctx.Text(strconv.FormatInt(u.Id, 10))
+	}, JwtAuth())
+	app.GET("/open", func(ctx *Context) {
+		_, err := ContextClaims[user](ctx)
+		ctx.Text(err.Error())
+	})
+	if w := serve(app, http.MethodGet, "/me", nil, HttpHeaderAuthorization, "Bearer "+token); w.Body.String() != "7" {
+		t.Errorf("ContextClaims() = %s", w.Body.String())
+	}
+	if w := serve(app, http.MethodGet, "/open", nil); w.Body.String() != ErrTokenMissing.Error() {
+		t.Errorf("ContextClaims() without JwtAuth = %s", w.Body.String())
+	}
+}
@@ -0,0 +1,265 @@
+package flow
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// MetricsConfig 定义指标配置，设置后统计请求的次数，耗时和错误，使用Prometheus的文本格式发布
+type MetricsConfig struct {
+	Path        string    // 发布指标的路由，默认值/metrics
+	Buckets     []float64 // 耗时直方图的分桶，单位秒，默认值0.005到10秒
+	EnableRoute bool      // 是否在默认路由组注册发布指标的路由，默认不注册，注册后路由会经过默认路由组的中间件，需要访问控制时使用Metrics.Handler注册到其他路由组
+}
+
+// 返回默认的指标配置
+func defMetricsConfig() *MetricsConfig {
+	return &MetricsConfig{
+		Path:    "/metrics",
+		Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}
+}
+
+// 定义一组相同名称不同标签的指标
+type metricVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64 // 直方图的分桶，为空时是计数器
+	mu      sync.Mutex
+	series  map[string]*metricSeries
+}
+
+// 定义一个标签组合的指标值
+type metricSeries struct {
+	values  []string
+	count   uint64
+	sum     float64
+	buckets []uint64 // 每个分桶的计数，不累加
+}
+
+func newMetricVec(name, help string, buckets []float64, labels ...string) *metricVec {
+	return &metricVec{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*metricSeries)}
+}
+
+// 返回标签组合的指标值，不存在时创建
+func (v *metricVec) get(values []string) *metricSeries {
+	key := strings.Join(values, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &metricSeries{values: values, buckets: make([]uint64, len(v.buckets))}
+		v.series[key] = s
+	}
+	return s
+}
+
+// 计数器加1
+func (v *metricVec) inc(values ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.get(values).count++
+}
+
+// 直方图记录一次观测值
+func (v *metricVec) observe(value float64, values ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s := v.get(values)
+	s.count++
+	s.sum += value
+	for i, bound := range v.buckets {
+		if value <= bound {
+			s.buckets[i]++
+			break
+		}
+	}
+}
+
+// 按Prometheus的文本格式写入指标
+func (v *metricVec) write(buf *bytes.Buffer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(v.series) == 0 {
+		return
+	}
+	kind := "counter"
+	if v.buckets != nil {
+		kind = "histogram"
+	}
+	buf.WriteString("# HELP " + v.name + " " + v.help + "\n")
+	buf.WriteString("# TYPE " + v.name + " " + kind + "\n")
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := v.series[k]
+		if v.buckets == nil {
+			writeMetricLine(buf, v.name, v.labels, s.values, "", "", float64(s.count))
+			continue
+		}
+		var cumulative uint64
+		for i, bound := range v.buckets {
+			cumulative += s.buckets[i]
+			writeMetricLine(buf, v.name+"_bucket", v.labels, s.values, "le", formatMetricValue(bound), float64(cumulative))
+		}
+		writeMetricLine(buf, v.name+"_bucket", v.labels, s.values, "le", "+Inf", float64(s.count))
+		writeMetricLine(buf, v.name+"_sum", v.labels, s.values, "", "", s.sum)
+		writeMetricLine(buf, v.name+"_count", v.labels, s.values, "", "", float64(s.count))
+	}
+}
+
+// 写入一行指标，extraLabel不为空时追加到标签的最后
+func writeMetricLine(buf *bytes.Buffer, name string, labels, values []string, extraLabel, extraValue string, value float64) {
+	buf.WriteString(name)
+	if len(labels) > 0 || len(extraLabel) > 0 {
+		buf.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(label + `="` + escapeLabelValue(values[i]) + `"`)
+		}
+		if len(extraLabel) > 0 {
+			if len(labels) > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(extraLabel + `="` + extraValue + `"`)
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteString(" " + formatMetricValue(value) + "\n")
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
+
+func formatMetricValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// Metrics 定义进程内的指标，包括服务端处理的请求和httpclient发出的请求
+type Metrics struct {
+	serverRequests *metricVec
+	serverDuration *metricVec
+	clientRequests *metricVec
+	clientDuration *metricVec
+	clientErrors   *metricVec
+}
+
+func newMetrics(metricsConfig *MetricsConfig) *Metrics {
+	buckets := metricsConfig.Buckets
+	return &Metrics{
+		serverRequests: newMetricVec("flow_http_server_requests_total", "Total number of HTTP requests handled by the server.", nil, "method", "route", "status"),
+		serverDuration: newMetricVec("flow_http_server_request_duration_seconds", "Duration of HTTP requests handled by the server.", buckets, "method", "route"),
+		clientRequests: newMetricVec("flow_http_client_requests_total", "Total number of outbound HTTP requests that received a response.", nil, "method", "host", "route", "status"),
+		clientDuration: newMetricVec("flow_http_client_request_duration_seconds", "Duration of outbound HTTP requests.", buckets, "method", "host", "route"),
+		clientErrors:   newMetricVec("flow_http_client_errors_total", "Total number of outbound HTTP requests that failed without a response.", nil, "method", "host", "route", "reason"),
+	}
+}
+
+// 记录服务端处理的请求，route是注册的路由路径，避免标签过多，处理请求时panic的也会记录
+func (m *Metrics) observeServer(method, route string, status int, cost time.Duration) {
+	if m == nil {
+		return
+	}
+	m.serverRequests.inc(method, route, strconv.Itoa(status))
+	m.serverDuration.observe(cost.Seconds(), method, route)
+}
+
+// 记录httpclient发出的一次请求，重试的每次请求都会记录，熔断的请求只记录错误
+func (m *Metrics) observeClient(method, host, route string, status int, cost time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	if err != nil {
+		reason := curlErrorReason(err)
+		m.clientErrors.inc(method, host, route, reason)
+		if reason == "circuit_open" {
+			return
+		}
+	} else {
+		m.clientRequests.inc(method, host, route, strconv.Itoa(status))
+	}
+	m.clientDuration.observe(cost.Seconds(), method, host, route)
+}
+
+// 返回请求失败的原因
+func curlErrorReason(err error) string {
+	if errors.Is(err, ErrCircuitOpen) {
+		return "circuit_open"
+	}
+	if errors.Is(err, context.Canceled) {
+		return "canceled"
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return "timeout"
+	}
+	return "network"
+}
+
+// WriteTo 按Prometheus的文本格式写入所有指标
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	buf := &bytes.Buffer{}
+	for _, v := range []*metricVec{m.serverRequests, m.serverDuration, m.clientRequests, m.clientDuration, m.clientErrors} {
+		v.write(buf)
+	}
+	return buf.WriteTo(w)
+}
+
+// Handler 返回发布指标的路由处理器
+func (m *Metrics) Handler() Handler {
+	return func(ctx *Context) {
+		buf := &bytes.Buffer{}
+		_, _ = m.WriteTo(buf)
+		ctx.Blob("text/plain; version=0.0.4; charset=utf-8", buf.Bytes())
+	}
+}
+
+// SetMetricsConfig 设置指标配置
+func (app *Application) SetMetricsConfig(metricsConfig *MetricsConfig) *Application {
+	if metricsConfig == nil {
+		metricsConfig = defMetricsConfig()
+	}
+	if len(metricsConfig.Path) == 0 {
+		metricsConfig.Path = defMetricsConfig().Path
+	}
+	if len(metricsConfig.Buckets) == 0 {
+		metricsConfig.Buckets = defMetricsConfig().Buckets
+	}
+	sort.Float64s(metricsConfig.Buckets)
+	app.metricsConfig = metricsConfig
+	app.Metrics = newMetrics(metricsConfig)
+	return app
+}
+
+// GetMetricsConfig 获取指标配置
+func (app *Application) GetMetricsConfig() *MetricsConfig {
+	return app.metricsConfig
+}
+
+// 开启了EnableRoute时注册发布指标的路由
+func initMetrics(app *Application) {
+	if app.metricsConfig == nil {
+		return
+	}
+	if app.metricsConfig.EnableRoute {
+		app.GET(app.metricsConfig.Path, app.Metrics.Handler())
+	}
+	app.Logger.Info("metrics server started", zap.String("path", app.metricsConfig.Path), zap.Bool("enableRoute", app.metricsConfig.EnableRoute))
+}
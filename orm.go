@@ -537,6 +537,18 @@ func (orm *Orm) DB() *gorm.DB {
 	return orm.db
 }
 
+// Close 关闭数据库连接池
+func (orm *Orm) Close() error {
+	if orm.db == nil {
+		return nil
+	}
+	sqlDB, err := orm.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
 // 定义数据库logger对象
 type dbLogger struct {
 	LogLevel logger.LogLevel
@@ -576,7 +588,7 @@ func (l *dbLogger) Trace(ctx context.Context, begin time.Time, fc func() (string
 }
 
 // 返回默认的数据库操logger对象
-func defOrmLogger() *dbLogger {
+func defOrmLogger(app *Application) *dbLogger {
 	return &dbLogger{
 		LogLevel: logger.Info,
 		logger:   getOrmLogger(app, nil),
@@ -612,7 +624,7 @@ func initDB(app *Application) {
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=true&loc=Local", app.ormConfig.UserName, app.ormConfig.Password,
 		app.ormConfig.Host, app.ormConfig.Port, app.ormConfig.DbName)
 	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
-		Logger: defOrmLogger(),
+		Logger: defOrmLogger(app),
 	})
 	if err != nil {
 		panic(err)
@@ -0,0 +1,158 @@
+package flow
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/funswe/flow/utils/json"
+)
+
+// 日志里替换敏感信息的内容
+const redactedValue = "******"
+
+// 判断请求头是否需要隐藏
+func (curlConfig *CurlConfig) isRedactedHeader(key string) bool {
+	for _, h := range curlConfig.RedactHeaders {
+		if strings.EqualFold(h, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// 判断字段是否需要隐藏
+func (curlConfig *CurlConfig) isRedactedField(key string) bool {
+	for _, f := range curlConfig.RedactFields {
+		if strings.EqualFold(f, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// 返回隐藏敏感信息后的请求头
+func (curlConfig *CurlConfig) redactHeaders(headers map[string]string) map[string]string {
+	redacted := make(map[string]string, len(headers))
+	for k, v := range headers {
+		if curlConfig.isRedactedHeader(k) {
+			v = redactedValue
+		}
+		redacted[k] = v
+	}
+	return redacted
+}
+
+// 返回隐藏敏感信息后的返回头
+func (curlConfig *CurlConfig) redactHeader(header http.Header) map[string]string {
+	redacted := make(map[string]string, len(header))
+	for k := range header {
+		v := strings.Join(header.Values(k), ", ")
+		if curlConfig.isRedactedHeader(k) {
+			v = redactedValue
+		}
+		redacted[k] = v
+	}
+	return redacted
+}
+
+// 返回隐藏敏感字段后的参数，用于query和form参数
+func (curlConfig *CurlConfig) redactValues(values map[string]string) map[string]string {
+	redacted := make(map[string]string, len(values))
+	for k, v := range values {
+		if curlConfig.isRedactedField(k) {
+			v = redactedValue
+		}
+		redacted[k] = v
+	}
+	return redacted
+}
+
+// 返回隐藏了密码和query里敏感字段的地址
+func (curlConfig *CurlConfig) redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	changed := false
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redactedValue)
+		changed = true
+	}
+	if len(u.RawQuery) > 0 {
+		query := u.Query()
+		queryChanged := false
+		for k := range query {
+			if curlConfig.isRedactedField(k) {
+				query.Set(k, redactedValue)
+				queryChanged = true
+			}
+		}
+		if queryChanged {
+			u.RawQuery = query.Encode()
+			changed = true
+		}
+	}
+	if !changed {
+		return rawURL
+	}
+	return strings.ReplaceAll(u.String(), url.QueryEscape(redactedValue), redactedValue)
+}
+
+// 返回打印日志的配置，隐藏默认请求头和代理地址里的敏感信息
+func (curlConfig *CurlConfig) logConfig() *CurlConfig {
+	logConfig := *curlConfig
+	logConfig.Headers = curlConfig.redactHeaders(curlConfig.Headers)
+	logConfig.BaseURL = curlConfig.redactURL(curlConfig.BaseURL)
+	logConfig.Proxy = curlConfig.redactURL(curlConfig.Proxy)
+	return &logConfig
+}
+
+// 递归隐藏json里的敏感字段
+func (curlConfig *CurlConfig) redactJSONValue(v interface{}) interface{} {
+	switch jv := v.(type) {
+	case map[string]interface{}:
+		for k, item := range jv {
+			if curlConfig.isRedactedField(k) {
+				jv[k] = redactedValue
+			} else {
+				jv[k] = curlConfig.redactJSONValue(item)
+			}
+		}
+	case []interface{}:
+		for i, item := range jv {
+			jv[i] = curlConfig.redactJSONValue(item)
+		}
+	}
+	return v
+}
+
+// 返回打印日志的实体，json实体隐藏敏感字段，超过MaxLogBodySize的部分截断
+func (curlConfig *CurlConfig) logBody(body []byte) string {
+	if curlConfig.MaxLogBodySize < 0 || len(body) == 0 {
+		return ""
+	}
+	if len(curlConfig.RedactFields) > 0 {
+		var v interface{}
+		if json.Unmarshal(body, &v) == nil {
+			if redacted, err := json.Marshal(curlConfig.redactJSONValue(v)); err == nil {
+				body = redacted
+			}
+		}
+	}
+	return truncateLogBody(string(body), curlConfig.MaxLogBodySize)
+}
+
+// 截断日志的实体，保证不会截断多字节的字符
+func truncateLogBody(body string, max int) string {
+	if len(body) <= max {
+		return body
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(body[cut]) {
+		cut--
+	}
+	return body[:cut] + "...(" + strconv.Itoa(len(body)) + " bytes)"
+}
@@ -0,0 +1,184 @@
+package flow
+
+import (
+	"errors"
+	"time"
+
+	"github.com/funswe/flow/utils/json"
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v4"
+	"go.uber.org/zap"
+)
+
+// ErrRedisNotInit 没有开启redis，不能使用refresh token和撤销token
+var ErrRedisNotInit = errors.New("redis is not initialized")
+
+// 比较token链当前的refresh token ID，相同时替换成新的ID，返回1表示替换成功，0表示ID不一致，-1表示token链不存在
+var rotateRefreshScript = redis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+if not current then
+	return -1
+end
+if current ~= ARGV[1] then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+return 1
+`)
+
+// 返回撤销的token在redis里的key
+func revokedTokenKey(jti string) string {
+	return "jwt:revoked:" + jti
+}
+
+// 返回token链在redis里的key，值是当前有效的refresh token ID
+func tokenFamilyKey(family string) string {
+	return "jwt:family:" + family
+}
+
+// 检查token是否已经撤销，没有开启redis时不检查
+func (j *Jwt) checkRevoked(jti string) error {
+	rd := j.app.Redis
+	if rd == nil || len(jti) == 0 {
+		return nil
+	}
+	_, err := rd.Get(revokedTokenKey(jti))
+	if err == nil {
+		return ErrTokenRevoked
+	}
+	if rd.IsNil(err) {
+		return nil
+	}
+	return err
+}
+
+// 签名access token和refresh token，refresh token属于指定的token链
+func (j *Jwt) signPair(data json.RawMessage, family string) (*TokenPair, *refreshClaims, error) {
+	access, err := j.sign(&TypedClaims[json.RawMessage]{RegisteredClaims: j.registeredClaims(), Data: data}, jwtTypeAccess)
+	if err != nil {
+		return nil, nil, err
+	}
+	rc := &refreshClaims{RegisteredClaims: j.registeredClaims(), Data: data, Family: family}
+	rc.ExpiresAt = jwt.NewNumericDate(time.Now().Add(j.app.jwtConfig.RefreshTimeout))
+	refresh, err := j.sign(rc, jwtTypeRefresh)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresIn:    int64(j.app.jwtConfig.Timeout.Seconds()),
+	}, rc, nil
+}
+
+// 签名新的token链，data是json编码后的数据
+func (j *Jwt) signNewPair(data json.RawMessage) (*TokenPair, error) {
+	if j.app.Redis == nil {
+		return nil, ErrRedisNotInit
+	}
+	pair, rc, err := j.signPair(data, newTokenId())
+	if err != nil {
+		return nil, err
+	}
+	if err = j.app.Redis.Set(tokenFamilyKey(rc.Family), rc.ID, j.app.jwtConfig.RefreshTimeout); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// SignPair 签名access token和refresh token，access token过期后使用Refresh换取新的token，需要开启redis
+func (j *Jwt) SignPair(data map[string]interface{}) (*TokenPair, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return j.signNewPair(raw)
+}
+
+// SignClaimsPair 使用自定义的数据类型签名access token和refresh token，需要开启redis
+func SignClaimsPair[T any](j *Jwt, data T) (*TokenPair, error) {
+	if j == nil {
+		return nil, ErrJwtNotInit
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return j.signNewPair(raw)
+}
+
+// Refresh 使用refresh token换取新的access token和refresh token，旧的refresh token会被撤销，
+// 已经使用过的refresh token再次使用时撤销整个token链并返回ErrRefreshTokenReused
+func (j *Jwt) Refresh(refreshToken string) (*TokenPair, error) {
+	rd := j.app.Redis
+	if rd == nil {
+		return nil, ErrRedisNotInit
+	}
+	claims := &refreshClaims{}
+	if err := j.parse(refreshToken, claims, jwtTypeRefresh); err != nil {
+		if errors.Is(err, ErrTokenRevoked) {
+			// 已经撤销的refresh token再次使用，可能被盗用
+			_ = rd.Delete(tokenFamilyKey(claims.Family))
+			return nil, ErrRefreshTokenReused
+		}
+		return nil, err
+	}
+	if len(claims.Family) == 0 {
+		return nil, ErrTokenType
+	}
+	pair, rc, err := j.signPair(claims.Data, claims.Family)
+	if err != nil {
+		return nil, err
+	}
+	result, err := rotateRefreshScript.Run(ctx, rd.rdb, []string{rd.fillKey(tokenFamilyKey(claims.Family))},
+		claims.ID, rc.ID, j.app.jwtConfig.RefreshTimeout.Milliseconds()).Int()
+	if err != nil {
+		return nil, err
+	}
+	switch result {
+	case -1:
+		// token链已经被撤销或者过期
+		return nil, ErrTokenRevoked
+	case 0:
+		_ = rd.Delete(tokenFamilyKey(claims.Family))
+		return nil, ErrRefreshTokenReused
+	}
+	// token链已经替换成新的refresh token，撤销失败时旧的token再次使用也会被当作重复使用，只记录日志，
+	// 返回错误会让客户端丢失已经生效的新token
+	if err = j.revoke(claims.ID, claims.ExpiresAt); err != nil {
+		j.app.Logger.Error("revoke refresh token error", zap.String("jti", claims.ID), zap.Error(err))
+	}
+	return pair, nil
+}
+
+// Revoke 撤销token，access token和refresh token都可以撤销，撤销refresh token时同时撤销整个token链，
+// 撤销记录保存在redis里，有效期是token剩余的有效时间
+func (j *Jwt) Revoke(token string) error {
+	if j.app.Redis == nil {
+		return ErrRedisNotInit
+	}
+	claims := &refreshClaims{}
+	parser := jwt.NewParser(jwt.WithoutClaimsValidation())
+	if _, err := parser.ParseWithClaims(token, claims, j.verifyKey); err != nil {
+		return err
+	}
+	if len(claims.Family) > 0 {
+		if err := j.app.Redis.Delete(tokenFamilyKey(claims.Family)); err != nil {
+			return err
+		}
+	}
+	return j.revoke(claims.ID, claims.ExpiresAt)
+}
+
+// 将token ID加入撤销列表，已经过期的token不需要撤销
+func (j *Jwt) revoke(jti string, expiresAt *jwt.NumericDate) error {
+	if len(jti) == 0 || expiresAt == nil {
+		return nil
+	}
+	// 加上允许的时钟偏差，保证撤销记录比token晚过期
+	ttl := time.Until(expiresAt.Time) + j.app.jwtConfig.Leeway
+	if ttl <= 0 {
+		return nil
+	}
+	return j.app.Redis.Set(revokedTokenKey(jti), "1", ttl)
+}
@@ -0,0 +1,250 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v4"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// 创建开启了JWT和redis的测试app，redis使用miniredis
+func newRefreshApp(t *testing.T, jwtConfig *JwtConfig) (*Application, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	port, _ := strconv.Atoi(mr.Port())
+	app := newJwtApp(t, jwtConfig)
+	app.SetRedisConfig(&RedisConfig{Enable: true, Host: mr.Host(), Port: port, Prefix: "flow"})
+	initRedis(app)
+	t.Cleanup(func() {
+		_ = app.Redis.Close()
+	})
+	return app, mr
+}
+
+func TestRefreshWithoutRedis(t *testing.T) {
+	app := newJwtApp(t, &JwtConfig{SecretKey: "secret"})
+	token, _ := app.Jwt.Sign(nil)
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"SignPair", func() error { _, err := app.Jwt.SignPair(nil); return err }},
+		{"SignClaimsPair", func() error { _, err := SignClaimsPair(app.Jwt, 1); return err }},
+		{"Refresh", func() error { _, err := app.Jwt.Refresh(token); return err }},
+		{"Revoke", func() error { return app.Jwt.Revoke(token) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, ErrRedisNotInit) {
+				t.Errorf("error = %v, want ErrRedisNotInit", err)
+			}
+		})
+	}
+	// 没有开启redis时不检查撤销
+	if _, err := app.Jwt.Valid(token); err != nil {
+		t.Errorf("Valid() error = %v, want nil", err)
+	}
+}
+
+func TestRefreshTokenType(t *testing.T) {
+	app, _ := newRefreshApp(t, &JwtConfig{SecretKey: "secret"})
+	pair, err := app.Jwt.SignPair(map[string]interface{}{"uid": "1"})
+	if err != nil {
+		t.Fatalf("SignPair() error = %v", err)
+	}
+	if pair.ExpiresIn != int64(defJwtConfig().Timeout.Seconds()) {
+		t.Errorf("ExpiresIn = %d", pair.ExpiresIn)
+	}
+	if data, err := app.Jwt.Valid(pair.AccessToken); err != nil || data["uid"] != "1" {
+		t.Errorf("Valid(access) = %v, %v", data, err)
+	}
+	if _, err = app.Jwt.Valid(pair.RefreshToken); !errors.Is(err, ErrTokenType) {
+		t.Errorf("Valid(refresh) error = %v, want ErrTokenType", err)
+	}
+	if _, err = app.Jwt.Refresh(pair.AccessToken); !errors.Is(err, ErrTokenType) {
+		t.Errorf("Refresh(access) error = %v, want ErrTokenType", err)
+	}
+	// 不属于token链的refresh token
+	rc := &refreshClaims{RegisteredClaims: app.Jwt.registeredClaims()}
+	orphan, _ := app.Jwt.sign(rc, jwtTypeRefresh)
+	if _, err = app.Jwt.Refresh(orphan); !errors.Is(err, ErrTokenType) {
+		t.Errorf("Refresh(no family) error = %v, want ErrTokenType", err)
+	}
+}
+
+func TestRefreshRotation(t *testing.T) {
+	type user struct {
+		Id int64
+	}
+	tests := []struct {
+		name string
+		// 使用第一个token对刷新后执行，返回最后一次Refresh的错误
+		run func(j *Jwt, first, second *TokenPair) error
+		err error
+	}{
+		{"refresh new token", func(j *Jwt, first, second *TokenPair) error {
+			_, err := j.Refresh(second.RefreshToken)
+			return err
+		}, nil},
+		{"reuse old token", func(j *Jwt, first, second *TokenPair) error {
+			_, err := j.Refresh(first.RefreshToken)
+			return err
+		}, ErrRefreshTokenReused},
+		{"reuse revokes the family", func(j *Jwt, first, second *TokenPair) error {
+			_, _ = j.Refresh(first.RefreshToken)
+			_, err := j.Refresh(second.RefreshToken)
+			return err
+		}, ErrTokenRevoked},
+		{"revoke refresh token", func(j *Jwt, first, second *TokenPair) error {
+			if err := j.Revoke(second.RefreshToken); err != nil {
+				return err
+			}
+			_, err := j.Refresh(second.RefreshToken)
+			return err
+		}, ErrRefreshTokenReused},
+		{"revoke access token keeps the family", func(j *Jwt, first, second *TokenPair) error {
+			if err := j.Revoke(second.AccessToken); err != nil {
+				return err
+			}
+			_, err := j.Refresh(second.RefreshToken)
+			return err
+		}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, _ := newRefreshApp(t, &JwtConfig{SecretKey: "secret"})
+			first, err := SignClaimsPair(app.Jwt, user{Id: 1})
+			if err != nil {
+				t.Fatalf("SignClaimsPair() error = %v", err)
+			}
+			second, err := app.Jwt.Refresh(first.RefreshToken)
+			if err != nil {
+				t.Fatalf("Refresh() error = %v", err)
+			}
+			if first.RefreshToken == second.RefreshToken || first.AccessToken == second.AccessToken {
+				t.Fatal("Refresh() returned the same tokens")
+			}
+			// 刷新后的token保留原来的数据
+			if u, err := ParseClaims[user](app.Jwt, second.AccessToken); err != nil || u.Id != 1 {
+				t.Fatalf("ParseClaims() = %+v, %v", u, err)
+			}
+			if err = tt.run(app.Jwt, first, second); !errors.Is(err, tt.err) {
+				t.Errorf("error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRevokeAccessToken(t *testing.T) {
+	app, mr := newRefreshApp(t, &JwtConfig{SecretKey: "secret", Timeout: time.Hour, Leeway: time.Minute})
+	token, _ := app.Jwt.Sign(nil)
+	if err := app.Jwt.Revoke(token); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	if _, err := app.Jwt.Valid(token); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Valid() error = %v, want ErrTokenRevoked", err)
+	}
+	claims := &Claims{}
+	_, _, _ = jwt.NewParser().ParseUnverified(token, claims)
+	// 撤销记录的有效期是token剩余的有效时间加上时钟偏差
+	ttl := mr.TTL(app.Redis.fillKey(revokedTokenKey(claims.ID)))
+	if ttl <= time.Hour || ttl > time.Hour+time.Minute {
+		t.Errorf("revoked ttl = %v, want about 1h1m", ttl)
+	}
+	other, _ := app.Jwt.Sign(nil)
+	if _, err := app.Jwt.Valid(other); err != nil {
+		t.Errorf("Valid(other) error = %v, want nil", err)
+	}
+	if err := app.Jwt.Revoke("a.b.c"); err == nil {
+		t.Error("Revoke(invalid) error = nil, want error")
+	}
+}
+
+func TestRefreshExpired(t *testing.T) {
+	app, _ := newRefreshApp(t, &JwtConfig{SecretKey: "secret"})
+	rc := &refreshClaims{RegisteredClaims: app.Jwt.registeredClaims(), Family: "f"}
+	rc.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	token, _ := app.Jwt.sign(rc, jwtTypeRefresh)
+	if _, err := app.Jwt.Refresh(token); !errors.Is(err, jwt.ErrTokenExpired) {
+		t.Errorf("Refresh() error = %v, want ErrTokenExpired", err)
+	}
+}
+
+func TestRefreshConcurrent(t *testing.T) {
+	app, _ := newRefreshApp(t, &JwtConfig{SecretKey: "secret"})
+	pair, _ := app.Jwt.SignPair(nil)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := app.Jwt.Refresh(pair.RefreshToken); err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	// 同一个refresh token只能成功刷新一次
+	if succeeded != 1 {
+		t.Errorf("succeeded = %d, want 1", succeeded)
+	}
+}
+
+// 让撤销token的SET命令失败的redis hook
+type failRevokeHook struct{}
+
+func (failRevokeHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	if cmd.Name() == "set" && strings.Contains(fmt.Sprint(cmd.Args()...), "jwt:revoked:") {
+		return ctx, errors.New("revoke failed")
+	}
+	return ctx, nil
+}
+
+func (failRevokeHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+func (failRevokeHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (failRevokeHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+func TestRefreshRevokeError(t *testing.T) {
+	app, _ := newRefreshApp(t, &JwtConfig{SecretKey: "secret"})
+	core, logs := observer.New(zap.ErrorLevel)
+	app.Logger = zap.New(core)
+	first, err := app.Jwt.SignPair(nil)
+	if err != nil {
+		t.Fatalf("SignPair() error = %v", err)
+	}
+	app.Redis.rdb.AddHook(failRevokeHook{})
+	// token链已经替换，撤销旧token失败时仍然返回新的token，并记录日志
+	second, err := app.Jwt.Refresh(first.RefreshToken)
+	if err != nil || second == nil {
+		t.Fatalf("Refresh() = %v, %v, want new tokens", second, err)
+	}
+	if entries := logs.FilterMessage("revoke refresh token error").All(); len(entries) != 1 {
+		t.Errorf("got %d error logs, want 1", len(entries))
+	}
+	// 没有撤销的旧token再次使用时仍然当作重复使用
+	if _, err = app.Jwt.Refresh(first.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Errorf("Refresh(old) error = %v, want ErrRefreshTokenReused", err)
+	}
+}
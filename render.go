@@ -0,0 +1,173 @@
+package flow
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 流式返回时每次写入的缓冲大小
+const streamBufferSize = 32 << 10 // 32 KB
+
+// Text 返回纯文本数据
+func (c *Context) Text(text string) {
+	c.SetHeader(HttpHeaderContentType, "text/plain; charset=utf-8")
+	c.res.raw([]byte(text))
+}
+
+// HTML 返回html数据
+func (c *Context) HTML(html string) {
+	c.SetHeader(HttpHeaderContentType, "text/html; charset=utf-8")
+	c.res.raw([]byte(html))
+}
+
+// Blob 返回指定类型的二进制数据
+func (c *Context) Blob(contentType string, data []byte) {
+	c.SetHeader(HttpHeaderContentType, contentType)
+	c.res.raw(data)
+}
+
+// NoContent 返回204状态码，不返回实体
+func (c *Context) NoContent() {
+	c.SetStatus(http.StatusNoContent)
+	c.res.writeHeader()
+}
+
+// File 返回文件，支持Range请求和If-Modified-Since缓存校验，文件不存在返回404
+func (c *Context) File(filePath string) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		c.fileError(err)
+		return
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		c.fileError(err)
+		return
+	}
+	if stat.IsDir() {
+		c.Error(NewHTTPError(http.StatusNotFound, 0, ""))
+		return
+	}
+	http.ServeContent(c.res.writer(), c.req.req, stat.Name(), stat.ModTime(), f)
+}
+
+// Attachment 以附件的形式返回文件，浏览器会下载文件，filename为空时使用文件名
+func (c *Context) Attachment(filePath string, filename string) {
+	if len(filename) == 0 {
+		filename = filepath.Base(filePath)
+	}
+	c.SetHeader(HttpHeaderContentDisposition, contentDisposition("attachment", filename))
+	c.File(filePath)
+}
+
+// Stream 从reader流式返回数据，使用chunked编码，每次写入后立即发送给客户端
+func (c *Context) Stream(contentType string, reader io.Reader) error {
+	if len(contentType) > 0 {
+		c.SetHeader(HttpHeaderContentType, contentType)
+	}
+	w := c.res.writer()
+	w.WriteHeader(c.res.getStatus())
+	if c.GetMethod() == HttpMethodHead {
+		return nil
+	}
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, streamBufferSize)
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			if _, wErr := w.Write(buf[:n]); wErr != nil {
+				return wErr
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		select {
+		case <-c.req.req.Context().Done():
+			return c.req.req.Context().Err()
+		default:
+		}
+	}
+}
+
+// 返回打开文件的错误，文件不存在返回404，没有权限返回403
+func (c *Context) fileError(err error) {
+	switch {
+	case os.IsNotExist(err):
+		c.Error(NewHTTPError(http.StatusNotFound, 0, "").WithError(err))
+	case os.IsPermission(err):
+		c.Error(NewHTTPError(http.StatusForbidden, 0, "").WithError(err))
+	default:
+		c.Error(err)
+	}
+}
+
+// 返回Content-Disposition头，文件名包含非ASCII或者控制字符时，filename使用替换成下划线的ASCII文件名，
+// filename*使用RFC 5987编码的原始文件名
+func contentDisposition(dispositionType, filename string) string {
+	for _, r := range filename {
+		if r < 0x20 || r > 0x7e {
+			return fmt.Sprintf("%s; filename=\"%s\"; filename*=UTF-8''%s", dispositionType,
+				quoteFilename(asciiFilename(filename)), encodeRFC5987(filename))
+		}
+	}
+	if v := mime.FormatMediaType(dispositionType, map[string]string{"filename": filename}); len(v) > 0 {
+		return v
+	}
+	return fmt.Sprintf("%s; filename=\"%s\"", dispositionType, quoteFilename(filename))
+}
+
+// 转义文件名里的引号和反斜杠
+func quoteFilename(filename string) string {
+	return strings.NewReplacer("\\", "\\\\", `"`, "\\\"").Replace(filename)
+}
+
+// 返回ASCII的文件名，非ASCII和控制字符替换成下划线，用于不支持filename*的客户端
+func asciiFilename(filename string) string {
+	var b strings.Builder
+	for _, r := range filename {
+		if r < 0x20 || r > 0x7e {
+			b.WriteByte('_')
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// 使用RFC 5987编码，attr-char以外的字节都使用百分号编码
+func encodeRFC5987(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if isAttrChar(ch) {
+			b.WriteByte(ch)
+		} else {
+			b.WriteByte('%')
+			b.WriteByte(hex[ch>>4])
+			b.WriteByte(hex[ch&0x0f])
+		}
+	}
+	return b.String()
+}
+
+// 判断是否是RFC 5987的attr-char
+func isAttrChar(ch byte) bool {
+	if ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' {
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", ch) >= 0
+}
@@ -0,0 +1,193 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		want     string
+	}{
+		{"ascii", "report.pdf", `attachment; filename=report.pdf`},
+		{"ascii with space", "my report.pdf", `attachment; filename="my report.pdf"`},
+		{"quote", `a"b.txt`, `attachment; filename="a\"b.txt"`},
+		{"non ascii", "报告.pdf", `attachment; filename="__.pdf"; filename*=UTF-8''%E6%8A%A5%E5%91%8A.pdf`},
+		{"reserved chars are encoded", "报告 (1);a,b'c*%.pdf", `attachment; filename="__ (1);a,b'c*%.pdf"; filename*=UTF-8''%E6%8A%A5%E5%91%8A%20%281%29%3Ba%2Cb%27c%2A%25.pdf`},
+		{"control char", "a\r\nb.txt", `attachment; filename="a__b.txt"; filename*=UTF-8''a%0D%0Ab.txt`},
+		{"attr chars are kept", "é!#$&+-.^_`|~", "attachment; filename=\"_!#$&+-.^_`|~\"; filename*=UTF-8''%C3%A9!#$&+-.^_`|~"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := contentDisposition("attachment", tt.filename)
+			if got != tt.want {
+				t.Errorf("contentDisposition() = %s, want %s", got, tt.want)
+			}
+			// 可以被标准库解析回原始的文件名
+			if _, params, err := mime.ParseMediaType(got); err != nil || params["filename"] != tt.filename {
+				t.Errorf("ParseMediaType() = %q, %v, want %q", params["filename"], err, tt.filename)
+			}
+		})
+	}
+}
+
+// 在临时目录创建测试文件
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFile(t *testing.T) {
+	path := writeTestFile(t, "a.txt", "hello world")
+	modTime := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header []string
+		status int
+		body   string
+	}{
+		{"ok", http.MethodGet, path, nil, http.StatusOK, "hello world"},
+		{"range", http.MethodGet, path, []string{"Range", "bytes=0-4"}, http.StatusPartialContent, "hello"},
+		{"not modified", http.MethodGet, path, []string{"If-Modified-Since", modTime}, http.StatusNotModified, ""},
+		{"head", http.MethodHead, path, nil, http.StatusOK, ""},
+		{"not found", http.MethodGet, filepath.Join(filepath.Dir(path), "missing.txt"), nil, http.StatusNotFound, `{"code":404,"message":"Not Found"}`},
+		{"directory", http.MethodGet, filepath.Dir(path), nil, http.StatusNotFound, `{"code":404,"message":"Not Found"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			app.ALL("/", func(ctx *Context) {
+				ctx.File(tt.path)
+			})
+			w := serve(app, tt.method, "/", nil, tt.header...)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+			if tt.status == http.StatusOK && w.Header().Get(HttpHeaderContentType) != "text/plain; charset=utf-8" {
+				t.Errorf("Content-Type = %q", w.Header().Get(HttpHeaderContentType))
+			}
+		})
+	}
+}
+
+func TestAttachment(t *testing.T) {
+	path := writeTestFile(t, "report.txt", "hello")
+	tests := []struct {
+		name     string
+		filename string
+		want     string
+	}{
+		{"file name", "", "attachment; filename=report.txt"},
+		{"custom name", "报告.txt", `attachment; filename="__.txt"; filename*=UTF-8''%E6%8A%A5%E5%91%8A.txt`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			app.GET("/", func(ctx *Context) {
+				ctx.Attachment(path, tt.filename)
+			})
+			w := serve(app, http.MethodGet, "/", nil)
+			if w.Code != http.StatusOK || w.Body.String() != "hello" {
+				t.Errorf("response = %d %q", w.Code, w.Body.String())
+			}
+			if got := w.Header().Get(HttpHeaderContentDisposition); got != tt.want {
+				t.Errorf("Content-Disposition = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// 每次读取返回一个分块的reader，读完后返回err
+type chunkReader struct {
+	chunks []string
+	err    error
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.chunks[0])
+	r.chunks = r.chunks[1:]
+	return n, nil
+}
+
+// 记录每次Flush前写入内容的ResponseRecorder
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushed []string
+}
+
+func (f *flushRecorder) Flush() {
+	f.flushed = append(f.flushed, f.Body.String())
+	f.ResponseRecorder.Flush()
+}
+
+func TestStream(t *testing.T) {
+	readErr := errors.New("read error")
+	tests := []struct {
+		name        string
+		method      string
+		reader      io.Reader
+		contentType string
+		body        string
+		flushed     int
+		err         error
+	}{
+		{"chunks are flushed", http.MethodGet, &chunkReader{chunks: []string{"a", "b", "c"}, err: io.EOF}, "text/event-stream", "abc", 3, nil},
+		{"large body", http.MethodGet, strings.NewReader(strings.Repeat("a", streamBufferSize+10)), "", strings.Repeat("a", streamBufferSize+10), 2, nil},
+		{"head", http.MethodHead, &chunkReader{chunks: []string{"a"}, err: io.EOF}, "text/plain", "", 0, nil},
+		{"read error", http.MethodGet, &chunkReader{chunks: []string{"a"}, err: readErr}, "text/plain", "a", 1, readErr},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			w := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+			c := newContext(w, httptest.NewRequest(tt.method, "/", nil), nil, app)
+			c.SetStatus(http.StatusAccepted)
+			if err := c.Stream(tt.contentType, tt.reader); !errors.Is(err, tt.err) {
+				t.Errorf("Stream() error = %v, want %v", err, tt.err)
+			}
+			if w.Code != http.StatusAccepted || w.Body.String() != tt.body {
+				t.Errorf("response = %d %q, want %q", w.Code, w.Body.String(), tt.body)
+			}
+			if len(tt.contentType) > 0 && w.Header().Get(HttpHeaderContentType) != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", w.Header().Get(HttpHeaderContentType), tt.contentType)
+			}
+			if len(w.flushed) != tt.flushed {
+				t.Errorf("flushed %d times, want %d", len(w.flushed), tt.flushed)
+			}
+		})
+	}
+	// 客户端断开后停止读取
+	reqCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	reader := &chunkReader{chunks: []string{"a", "b"}, err: io.EOF}
+	c, w := newTestContext(t, newTestApp(t), httptest.NewRequest(http.MethodGet, "/", nil).WithContext(reqCtx))
+	if err := c.Stream("text/plain", reader); !errors.Is(err, context.Canceled) {
+		t.Errorf("Stream() error = %v, want context.Canceled", err)
+	}
+	if w.Body.String() != "a" || len(reader.chunks) != 1 {
+		t.Errorf("body = %q, left %d chunks", w.Body.String(), len(reader.chunks))
+	}
+}
@@ -39,7 +39,7 @@ func (r *request) getUri() string {
 // 获取服务的HOST信息
 func (r *request) getHost() string {
 	var host string
-	if app.serverConfig.Proxy {
+	if r.app.serverConfig.Proxy {
 		host = r.getHeader(HttpHeaderXForwardedHost)
 	}
 	if len(host) == 0 {
@@ -58,7 +58,7 @@ func (r *request) getProtocol() string {
 	if r.req.TLS != nil {
 		return "https"
 	}
-	if !app.serverConfig.Proxy {
+	if !r.app.serverConfig.Proxy {
 		return "http"
 	}
 	return r.getHeader(HttpHeaderXForwardedProto)
@@ -3,6 +3,7 @@ package flow
 import (
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/funswe/flow/utils/json"
 )
@@ -28,9 +29,13 @@ func (j *jsonWriter) Data() ([]byte, error) {
 
 // 定义封装的response结构
 type response struct {
-	res http.ResponseWriter
-	req *request
-	app *Application
+	res     http.ResponseWriter
+	req     *request
+	app     *Application
+	status  int  // 返回的http状态码，写入返回体时才会写入
+	written bool // 是否已经写入返回头
+
+	beforeWrites []func() // 写入返回头之前执行的方法，如保存session
 }
 
 func newResponse(res http.ResponseWriter, req *request, app *Application) *response {
@@ -53,12 +58,57 @@ func (r *response) setHeader(key, value string) *response {
 	return r
 }
 
-// 设置http状态码
+// 添加Vary返回头，已经存在的值不会重复添加
+func (r *response) addVary(value string) *response {
+	for _, v := range r.res.Header().Values(HttpHeaderVary) {
+		for _, item := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), value) {
+				return r
+			}
+		}
+	}
+	r.res.Header().Add(HttpHeaderVary, value)
+	return r
+}
+
+// 设置http状态码，在写入返回体之前都可以修改
 func (r *response) setStatus(code int) *response {
-	r.res.WriteHeader(code)
+	r.status = code
 	return r
 }
 
+// 获取http状态码，未设置时返回200
+func (r *response) getStatus() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// 添加写入返回头之前执行的方法，可以在方法里修改返回头
+func (r *response) beforeWrite(f func()) {
+	r.beforeWrites = append(r.beforeWrites, f)
+}
+
+// 执行写入返回头之前的方法，只会执行一次
+func (r *response) runBeforeWrites() {
+	fs := r.beforeWrites
+	r.beforeWrites = nil
+	for _, f := range fs {
+		f()
+	}
+}
+
+// 写入返回头，只会写入一次
+func (r *response) writeHeader() {
+	if r.written {
+		return
+	}
+	r.runBeforeWrites()
+	r.written = true
+	r.res.WriteHeader(r.getStatus())
+}
+
 // 设置返回内容的长度
 func (r *response) setLength(length int) *response {
 	r.setHeader(HttpHeaderContentLength, strconv.Itoa(length))
@@ -67,13 +117,70 @@ func (r *response) setLength(length int) *response {
 
 // 设置重定向地址
 func (r *response) redirect(url string, code int) {
+	r.runBeforeWrites()
+	r.written = true
+	r.status = code
 	http.Redirect(r.res, r.req.req, url, code)
 }
 
+// 返回记录状态码的ResponseWriter，用于http.ServeContent等直接写入的方法
+func (r *response) writer() http.ResponseWriter {
+	return &statusWriter{ResponseWriter: r.res, r: r}
+}
+
+// 判断状态码是否允许返回实体
+func bodyAllowedForStatus(status int) bool {
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == http.StatusNoContent, status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
 func (r *response) raw(data []byte) {
+	if bodyAllowedForStatus(r.getStatus()) && len(r.getHeader(HttpHeaderContentLength)) == 0 {
+		r.setLength(len(data))
+	}
+	r.writeHeader()
 	if r.req.getMethod() != HttpMethodHead {
 		_, _ = r.res.Write(data)
 	} else {
 		_, _ = r.res.Write([]byte{})
 	}
 }
+
+// statusWriter 记录写入的状态码
+type statusWriter struct {
+	http.ResponseWriter
+	r *response
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.r.written {
+		return
+	}
+	w.r.runBeforeWrites()
+	w.r.written = true
+	w.r.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(data []byte) (int, error) {
+	if !w.r.written {
+		w.WriteHeader(w.r.getStatus())
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap 用于http.ResponseController获取原始的ResponseWriter
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
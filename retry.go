@@ -0,0 +1,88 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// CurlRetryConfig 定义请求失败重试的配置，网络错误和RetryStatus里的状态码会重试
+type CurlRetryConfig struct {
+	MaxAttempts        int           // 最多请求的次数，包括第一次请求，默认值3
+	MinBackoff         time.Duration // 第一次重试前等待的时间，之后每次翻倍，默认值100毫秒
+	MaxBackoff         time.Duration // 重试前等待的最长时间，默认值2秒
+	RetryStatus        []int         // 需要重试的状态码，默认值429，502，503，504
+	RetryNonIdempotent bool          // 是否重试POST，PATCH等非幂等的请求，默认只重试GET，HEAD，OPTIONS，PUT，DELETE
+}
+
+// 填充重试配置的默认值
+func fillCurlRetryConfig(retryConfig *CurlRetryConfig) *CurlRetryConfig {
+	if retryConfig == nil {
+		return nil
+	}
+	if retryConfig.MaxAttempts <= 0 {
+		retryConfig.MaxAttempts = 3
+	}
+	if retryConfig.MinBackoff <= 0 {
+		retryConfig.MinBackoff = 100 * time.Millisecond
+	}
+	if retryConfig.MaxBackoff < retryConfig.MinBackoff {
+		retryConfig.MaxBackoff = 2 * time.Second
+		if retryConfig.MaxBackoff < retryConfig.MinBackoff {
+			retryConfig.MaxBackoff = retryConfig.MinBackoff
+		}
+	}
+	if retryConfig.RetryStatus == nil {
+		retryConfig.RetryStatus = []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	}
+	return retryConfig
+}
+
+// 判断请求方法是否幂等
+func isIdempotentMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// 返回第attempt次重试前等待的时间，指数退避并加上随机抖动，结果在[backoff/2, backoff)之间
+func (rc *CurlRetryConfig) backoff(attempt int) time.Duration {
+	backoff := rc.MinBackoff << uint(attempt-1)
+	if backoff > rc.MaxBackoff || backoff <= 0 {
+		backoff = rc.MaxBackoff
+	}
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(backoff-half)+1))
+}
+
+// 判断请求结果是否需要重试，调用方取消的请求不重试
+func (rc *CurlRetryConfig) shouldRetry(ctx context.Context, status int, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return !errors.Is(err, ErrCircuitOpen)
+	}
+	for _, s := range rc.RetryStatus {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// 等待重试，ctx取消时返回错误
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,190 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 使用方法实现的RoundTripper
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// 按顺序返回给定状态码的RoundTripper，状态码为0时返回网络错误，calls记录请求的次数
+func statusTransport(calls *int32, statuses ...int) http.RoundTripper {
+	return roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		n := int(atomic.AddInt32(calls, 1))
+		status := statuses[len(statuses)-1]
+		if n <= len(statuses) {
+			status = statuses[n-1]
+		}
+		if status == 0 {
+			return nil, errors.New("connection refused")
+		}
+		return &http.Response{StatusCode: status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("")), Request: r}, nil
+	})
+}
+
+// 创建使用给定配置的测试Curl对象
+func newTestCurl(t *testing.T, curlConfig *CurlConfig) *Curl {
+	t.Helper()
+	return NewCurl(newTestApp(t, WithCurlConfig(curlConfig)))
+}
+
+func TestFillCurlRetryConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *CurlRetryConfig
+		want   CurlRetryConfig
+	}{
+		{"defaults", &CurlRetryConfig{}, CurlRetryConfig{MaxAttempts: 3, MinBackoff: 100 * time.Millisecond, MaxBackoff: 2 * time.Second}},
+		{"keep values", &CurlRetryConfig{MaxAttempts: 5, MinBackoff: time.Second, MaxBackoff: 10 * time.Second},
+			CurlRetryConfig{MaxAttempts: 5, MinBackoff: time.Second, MaxBackoff: 10 * time.Second}},
+		{"max backoff at least min backoff", &CurlRetryConfig{MinBackoff: 5 * time.Second, MaxBackoff: time.Second},
+			CurlRetryConfig{MaxAttempts: 3, MinBackoff: 5 * time.Second, MaxBackoff: 5 * time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fillCurlRetryConfig(tt.config)
+			if got.MaxAttempts != tt.want.MaxAttempts || got.MinBackoff != tt.want.MinBackoff || got.MaxBackoff != tt.want.MaxBackoff {
+				t.Errorf("fillCurlRetryConfig() = %+v, want %+v", got, tt.want)
+			}
+			if len(got.RetryStatus) == 0 {
+				t.Error("RetryStatus is empty")
+			}
+		})
+	}
+	if fillCurlRetryConfig(nil) != nil {
+		t.Error("fillCurlRetryConfig(nil) != nil")
+	}
+	// 设置了空的状态码列表时只重试网络错误
+	if got := fillCurlRetryConfig(&CurlRetryConfig{RetryStatus: []int{}}); len(got.RetryStatus) != 0 {
+		t.Errorf("RetryStatus = %v, want empty", got.RetryStatus)
+	}
+}
+
+func TestCurlRetryBackoff(t *testing.T) {
+	rc := fillCurlRetryConfig(&CurlRetryConfig{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second})
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{100, time.Second}, // 移位溢出时使用最长时间
+	}
+	for _, tt := range tests {
+		for i := 0; i < 50; i++ {
+			if got := rc.backoff(tt.attempt); got < tt.max/2 || got > tt.max {
+				t.Fatalf("backoff(%d) = %v, want in [%v, %v]", tt.attempt, got, tt.max/2, tt.max)
+			}
+		}
+	}
+}
+
+func TestCurlRetryShouldRetry(t *testing.T) {
+	rc := fillCurlRetryConfig(&CurlRetryConfig{})
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		status int
+		err    error
+		want   bool
+	}{
+		{"success", context.Background(), http.StatusOK, nil, false},
+		{"client error", context.Background(), http.StatusBadRequest, nil, false},
+		{"internal error", context.Background(), http.StatusInternalServerError, nil, false},
+		{"service unavailable", context.Background(), http.StatusServiceUnavailable, nil, true},
+		{"too many requests", context.Background(), http.StatusTooManyRequests, nil, true},
+		{"network error", context.Background(), 0, errors.New("connection reset"), true},
+		{"circuit open", context.Background(), 0, ErrCircuitOpen, false},
+		{"canceled", canceled, 0, context.Canceled, false},
+		{"canceled with retry status", canceled, http.StatusServiceUnavailable, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rc.shouldRetry(tt.ctx, tt.status, tt.err); got != tt.want {
+				t.Errorf("shouldRetry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCurlRetry(t *testing.T) {
+	retryConfig := func() *CurlRetryConfig {
+		return &CurlRetryConfig{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	}
+	tests := []struct {
+		name     string
+		retry    *CurlRetryConfig
+		statuses []int
+		request  func(c *Curl) *CurlRequest
+		calls    int32
+		status   int
+		err      bool
+	}{
+		{"no retry config", nil, []int{503, 200}, func(c *Curl) *CurlRequest { return c.R() }, 1, 503, false},
+		{"retry until success", retryConfig(), []int{503, 0, 200}, func(c *Curl) *CurlRequest { return c.R() }, 3, 200, false},
+		{"stop at max attempts", retryConfig(), []int{503}, func(c *Curl) *CurlRequest { return c.R() }, 3, 503, false},
+		{"network errors", retryConfig(), []int{0}, func(c *Curl) *CurlRequest { return c.R() }, 3, 0, true},
+		{"status not retried", retryConfig(), []int{500, 200}, func(c *Curl) *CurlRequest { return c.R() }, 1, 500, false},
+		{"post not retried", retryConfig(), []int{503, 200}, func(c *Curl) *CurlRequest { return c.R().Method(http.MethodPost).JSON(map[string]string{"a": "b"}) }, 1, 503, false},
+		{"put retried", retryConfig(), []int{503, 200}, func(c *Curl) *CurlRequest { return c.R().Method(http.MethodPut).JSON(map[string]string{"a": "b"}) }, 2, 200, false},
+		{"post with request retry", retryConfig(), []int{503, 200}, func(c *Curl) *CurlRequest { return c.R().Method(http.MethodPost).Retry(3) }, 2, 200, false},
+		{"request retry without config", nil, []int{503, 503, 200}, func(c *Curl) *CurlRequest { return c.R().Retry(3) }, 3, 200, false},
+		{"request disables retry", retryConfig(), []int{503, 200}, func(c *Curl) *CurlRequest { return c.R().Retry(1) }, 1, 503, false},
+		{"stream body sent once", retryConfig(), []int{503, 200}, func(c *Curl) *CurlRequest {
+			return c.R().Method(http.MethodPut).Body(strings.NewReader("data"))
+		}, 1, 503, false},
+		{"retry non idempotent", &CurlRetryConfig{MaxAttempts: 2, MinBackoff: time.Millisecond, RetryNonIdempotent: true}, []int{503, 200},
+			func(c *Curl) *CurlRequest { return c.R().Method(http.MethodPost) }, 2, 200, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			c := newTestCurl(t, &CurlConfig{Retry: tt.retry, Transport: statusTransport(&calls, tt.statuses...)})
+			res, err := tt.request(c).URL("http://upstream.test/users").Do(context.Background())
+			if (err != nil) != tt.err {
+				t.Fatalf("Do() error = %v, want error %v", err, tt.err)
+			}
+			if calls != tt.calls {
+				t.Errorf("calls = %d, want %d", calls, tt.calls)
+			}
+			if err == nil && res.StatusCode() != tt.status {
+				t.Errorf("status = %d, want %d", res.StatusCode(), tt.status)
+			}
+		})
+	}
+}
+
+func TestCurlRetryCanceled(t *testing.T) {
+	var calls int32
+	c := newTestCurl(t, &CurlConfig{
+		Retry:     &CurlRetryConfig{MaxAttempts: 5, MinBackoff: time.Hour, MaxBackoff: time.Hour},
+		Transport: statusTransport(&calls, 503),
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	res, err := c.R().URL("http://upstream.test/").Do(ctx)
+	// 等待重试时取消，返回最后一次的结果
+	if err != nil || res.StatusCode() != http.StatusServiceUnavailable {
+		t.Fatalf("Do() = %v, %v", res, err)
+	}
+	if calls != 1 || time.Since(start) > time.Second {
+		t.Errorf("calls = %d, cost = %v", calls, time.Since(start))
+	}
+}
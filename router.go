@@ -3,24 +3,21 @@ package flow
 import (
 	"github.com/julienschmidt/httprouter"
 	"go.uber.org/zap"
+	"io/fs"
 	"net/http"
+	"path"
 	"runtime/debug"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
-var (
-	router         = httprouter.New()        // 路由对象
-	panicHandler   = defaultErrorHandle()    // 统一错误处理方法
-	notFoundHandle = defaultNotFoundHandle() // 路由不存在处理方法
-)
-
-func init() {
-	router.PanicHandler = panicHandler
-	router.NotFound = notFoundHandle
-}
-
 type RouterGroup struct {
+	app        *Application // 路由组所属的app对象
+	parent     *RouterGroup // 父路由组，子路由组继承父路由组的中间件
+	prefix     string       // 路由前缀，包含父路由组的前缀
 	middleware []Middleware
+	cors       *CorsConfig // 路由组的跨域配置，为空时使用父路由组或者app的跨域配置
 }
 
 type Next func()
@@ -39,26 +36,110 @@ type Middleware func(ctx *Context, next Next)
 // Handler 定义路由处理器
 type Handler func(ctx *Context)
 
-func dispatch(ctx *Context, index int, handler Handler, rg *RouterGroup) Next {
-	if index >= len(rg.middleware) {
+// ErrorHandler 定义返回错误的路由处理器，返回的错误交给app的错误渲染方法处理
+type ErrorHandler func(ctx *Context) error
+
+// WrapError 将ErrorHandler转换成Handler
+func WrapError(h ErrorHandler) Handler {
+	return func(ctx *Context) {
+		if err := h(ctx); err != nil {
+			ctx.Error(err)
+		}
+	}
+}
+
+func dispatch(ctx *Context, index int, handler Handler, middleware []Middleware) Next {
+	if index >= len(middleware) {
 		return func() {
+			// 请求头里声明的实体长度超过限制的，不再执行处理器
+			if ctx.bodyTooLarge() {
+				ctx.Error(ctx.bodyTooLargeError(nil))
+				return
+			}
 			handler(ctx)
 		}
 	}
 	return func() {
-		rg.middleware[index](ctx, dispatch(ctx, index+1, handler, rg))
+		middleware[index](ctx, dispatch(ctx, index+1, handler, middleware))
 	}
 }
 
-func handle(handler Handler, rg *RouterGroup) func(http.ResponseWriter, *http.Request, httprouter.Params) {
+// 返回路由的处理方法，中间件的顺序是父路由组、当前路由组、路由自己的中间件
+func handle(route string, handler Handler, rg *RouterGroup, routeMiddleware []Middleware) func(http.ResponseWriter, *http.Request, httprouter.Params) {
+	chain := &routeChain{rg: rg, middleware: routeMiddleware}
 	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
-		ctx := newContext(w, r, params, app)
-		dispatch(ctx, 0, handler, rg)()
+		start := time.Now()
+		ctx := newContext(w, r, params, rg.app)
+		ctx.group = rg
+		ctx.route = route
+		defer func() {
+			if rcv := recover(); rcv != nil {
+				// 参数方法读取请求实体失败，返回对应的错误
+				if p, ok := rcv.(paramsPanic); ok {
+					ctx.Error(p.err)
+				} else {
+					// 交给错误渲染方法处理，没有设置时使用默认的json格式返回500
+					ctx.Logger.Error("error", zap.Any("panic", rcv), zap.ByteString("Stack", debug.Stack()))
+					ctx.Error(panicToError(rcv))
+				}
+			}
+			// 设置了状态码但是没有写入返回体的，写入返回头
+			if ctx.res.status != 0 {
+				ctx.res.writeHeader()
+			}
+			// 在恢复panic之后记录指标，panic的请求也会统计
+			rg.app.Metrics.observeServer(ctx.GetMethod(), route, ctx.res.getStatus(), time.Since(start))
+		}()
+		dispatch(ctx, 0, handler, chain.get())()
+	}
+}
+
+// 定义路由的中间件链，第一次请求时计算并缓存，路由组添加中间件后重新计算
+type routeChain struct {
+	rg         *RouterGroup
+	middleware []Middleware // 路由自己的中间件
+	cached     atomic.Pointer[cachedChain]
+}
+
+type cachedChain struct {
+	version    uint64
+	middleware []Middleware
+}
+
+// 返回路由完整的中间件链，先读取版本再计算，计算期间添加的中间件会在下一次请求时重新计算
+func (rc *routeChain) get() []Middleware {
+	version := rc.rg.app.chainVersion.Load()
+	if c := rc.cached.Load(); c != nil && c.version == version {
+		return c.middleware
+	}
+	middleware := append(rc.rg.chain(), rc.middleware...)
+	rc.cached.Store(&cachedChain{version: version, middleware: middleware})
+	return middleware
+}
+
+// 返回路由组完整的中间件链，包括所有父路由组的中间件
+func (rg *RouterGroup) chain() []Middleware {
+	if rg.parent == nil {
+		return append([]Middleware{}, rg.middleware...)
 	}
+	return append(rg.parent.chain(), rg.middleware...)
 }
 
-func NewRouterGroup() *RouterGroup {
-	rg := &RouterGroup{}
+// 拼接路由前缀和路径，保留路径结尾的/，没有以/开头的补上/，例如Group("api")等同于Group("/api")
+func joinPaths(prefix, relativePath string) string {
+	if len(relativePath) == 0 && len(prefix) > 0 {
+		return prefix
+	}
+	finalPath := path.Join("/", prefix, relativePath)
+	if strings.HasSuffix(relativePath, "/") && !strings.HasSuffix(finalPath, "/") {
+		return finalPath + "/"
+	}
+	return finalPath
+}
+
+// NewRouterGroup 创建路由组，路由注册到当前app对象的路由上
+func (app *Application) NewRouterGroup() *RouterGroup {
+	rg := &RouterGroup{app: app}
 	// 添加默认的中间件
 	rg.middleware = append([]Middleware{func(ctx *Context, next Next) {
 		// 添加请求日志打印
@@ -69,73 +150,87 @@ func NewRouterGroup() *RouterGroup {
 		next()
 		ctx.Logger.Info("request completed",
 			zap.String("cost", time.Since(start).Round(time.Millisecond).String()),
-			zap.Int("statusCode", ctx.statusCode))
+			zap.Int("statusCode", ctx.res.getStatus()))
 	}, func(ctx *Context, next Next) {
 		ctx.SetHeader(HttpHeaderXPoweredBy, "flow")
-		// 添加跨域支持
-		ctx.SetHeader(HttpHeaderCorsOrigin, app.corsConfig.AllowOrigin)
-		ctx.SetHeader(HttpHeaderCorsMethods, app.corsConfig.AllowedMethods)
-		ctx.SetHeader(HttpHeaderCorsHeaders, app.corsConfig.AllowedHeaders)
-		ctx.SetHeader(HttpHeaderCorsMaxAge, "172800")
-		if ctx.GetMethod() == HttpMethodOptions {
-			ctx.res.raw([]byte("true"))
-			return
-		}
 		next()
-	}}, rg.middleware...)
+	}, corsMiddleware}, rg.middleware...)
 	return rg
 }
 
-// Use 添加中间件
+// Use 添加中间件，对已经注册的路由也生效
 func (rg *RouterGroup) Use(m Middleware) *RouterGroup {
 	rg.middleware = append(rg.middleware, m)
+	rg.app.chainVersion.Add(1)
 	return rg
 }
 
-func (rg *RouterGroup) GET(path string, handler Handler) *RouterGroup {
-	router.Handle(HttpMethodGet, path, handle(handler, rg))
-	router.Handle(HttpMethodOptions, path, handle(handler, rg))
+// Group 创建子路由组，子路由组继承当前路由组的前缀和中间件
+func (rg *RouterGroup) Group(prefix string, middleware ...Middleware) *RouterGroup {
+	return &RouterGroup{
+		app:        rg.app,
+		parent:     rg,
+		prefix:     joinPaths(rg.prefix, prefix),
+		middleware: middleware,
+	}
+}
+
+// 注册路由，路径会加上路由组的前缀，每个路径第一次注册时同时注册OPTIONS路由
+func (rg *RouterGroup) handle(method, relativePath string, handler Handler, middleware []Middleware) {
+	fullPath := joinPaths(rg.prefix, relativePath)
+	rg.app.router.Handle(method, fullPath, handle(fullPath, handler, rg, middleware))
+	methods, registered := rg.app.routes[fullPath]
+	rg.app.routes[fullPath] = append(methods, method)
+	if registered || method == HttpMethodOptions {
+		return
+	}
+	// 预检请求由跨域中间件处理，其他的OPTIONS请求返回路径允许的请求方法
+	rg.app.router.Handle(HttpMethodOptions, fullPath, handle(fullPath, func(ctx *Context) {
+		ctx.SetHeader(HttpHeaderAllow, strings.Join(rg.app.routes[fullPath], ", "))
+		ctx.SetStatus(http.StatusNoContent)
+	}, rg, nil))
+	rg.app.routes[fullPath] = append(rg.app.routes[fullPath], HttpMethodOptions)
+}
+
+func (rg *RouterGroup) GET(path string, handler Handler, middleware ...Middleware) *RouterGroup {
+	rg.handle(HttpMethodGet, path, handler, middleware)
 	return rg
 }
 
-func (rg *RouterGroup) HEAD(path string, handler Handler) *RouterGroup {
-	router.Handle(HttpMethodHead, path, handle(handler, rg))
-	router.Handle(HttpMethodOptions, path, handle(handler, rg))
+func (rg *RouterGroup) HEAD(path string, handler Handler, middleware ...Middleware) *RouterGroup {
+	rg.handle(HttpMethodHead, path, handler, middleware)
 	return rg
 }
 
-func (rg *RouterGroup) POST(path string, handler Handler) *RouterGroup {
-	router.Handle(HttpMethodPost, path, handle(handler, rg))
-	router.Handle(HttpMethodOptions, path, handle(handler, rg))
+func (rg *RouterGroup) POST(path string, handler Handler, middleware ...Middleware) *RouterGroup {
+	rg.handle(HttpMethodPost, path, handler, middleware)
 	return rg
 }
 
-func (rg *RouterGroup) PUT(path string, handler Handler) *RouterGroup {
-	router.Handle(HttpMethodPut, path, handle(handler, rg))
-	router.Handle(HttpMethodOptions, path, handle(handler, rg))
+func (rg *RouterGroup) PUT(path string, handler Handler, middleware ...Middleware) *RouterGroup {
+	rg.handle(HttpMethodPut, path, handler, middleware)
 	return rg
 }
 
-func (rg *RouterGroup) PATCH(path string, handler Handler) *RouterGroup {
-	router.Handle(HttpMethodPatch, path, handle(handler, rg))
-	router.Handle(HttpMethodOptions, path, handle(handler, rg))
+func (rg *RouterGroup) PATCH(path string, handler Handler, middleware ...Middleware) *RouterGroup {
+	rg.handle(HttpMethodPatch, path, handler, middleware)
 	return rg
 }
 
-func (rg *RouterGroup) DELETE(path string, handler Handler) *RouterGroup {
-	router.Handle(HttpMethodDelete, path, handle(handler, rg))
-	router.Handle(HttpMethodOptions, path, handle(handler, rg))
+func (rg *RouterGroup) DELETE(path string, handler Handler, middleware ...Middleware) *RouterGroup {
+	rg.handle(HttpMethodDelete, path, handler, middleware)
 	return rg
 }
 
-func (rg *RouterGroup) ALL(path string, handler Handler) *RouterGroup {
-	router.Handle(HttpMethodGet, path, handle(handler, rg))
-	router.Handle(HttpMethodHead, path, handle(handler, rg))
-	router.Handle(HttpMethodPost, path, handle(handler, rg))
-	router.Handle(HttpMethodPut, path, handle(handler, rg))
-	router.Handle(HttpMethodPatch, path, handle(handler, rg))
-	router.Handle(HttpMethodDelete, path, handle(handler, rg))
-	router.Handle(HttpMethodOptions, path, handle(handler, rg))
+// ALL 注册所有请求方法的路由，OPTIONS请求也会执行处理器，预检请求仍然由跨域中间件处理
+func (rg *RouterGroup) ALL(path string, handler Handler, middleware ...Middleware) *RouterGroup {
+	rg.handle(HttpMethodOptions, path, handler, middleware)
+	rg.handle(HttpMethodGet, path, handler, middleware)
+	rg.handle(HttpMethodHead, path, handler, middleware)
+	rg.handle(HttpMethodPost, path, handler, middleware)
+	rg.handle(HttpMethodPut, path, handler, middleware)
+	rg.handle(HttpMethodPatch, path, handler, middleware)
+	rg.handle(HttpMethodDelete, path, handler, middleware)
 	return rg
 }
 
@@ -162,19 +257,83 @@ func defaultNotFoundHandle() NotFoundHandle {
 	}
 }
 
-func SetPanicHandler(ph PanicHandler) {
+// SetPanicHandler 设置路由处理器之外的panic处理方法，路由处理器里的panic交给错误渲染方法处理
+func (app *Application) SetPanicHandler(ph PanicHandler) *Application {
 	if ph == nil {
 		ph = defaultErrorHandle()
 	}
-	router.PanicHandler = func(w http.ResponseWriter, r *http.Request, err interface{}) {
-		app.Logger.Error("error", zap.ByteString("Stack", debug.Stack()))
+	app.router.PanicHandler = func(w http.ResponseWriter, r *http.Request, err interface{}) {
+		if app.Logger != nil {
+			app.Logger.Error("error", zap.ByteString("Stack", debug.Stack()))
+		}
 		ph(w, r, err)
 	}
+	return app
 }
 
-func SetNotFoundHandle(nfh NotFoundHandle) {
+// SetNotFoundHandle 设置路由不存在处理方法
+func (app *Application) SetNotFoundHandle(nfh NotFoundHandle) *Application {
 	if nfh == nil {
 		nfh = defaultNotFoundHandle()
 	}
-	router.NotFound = nfh
+	app.router.NotFound = nfh
+	return app
+}
+
+// Group 在默认的路由组上创建子路由组
+func (app *Application) Group(prefix string, middleware ...Middleware) *RouterGroup {
+	return app.defRouterGroup.Group(prefix, middleware...)
+}
+
+// Use 在默认的路由组上添加中间件
+func (app *Application) Use(m Middleware) *Application {
+	app.defRouterGroup.Use(m)
+	return app
+}
+
+func (app *Application) GET(path string, handler Handler, middleware ...Middleware) *Application {
+	app.defRouterGroup.GET(path, handler, middleware...)
+	return app
+}
+
+func (app *Application) HEAD(path string, handler Handler, middleware ...Middleware) *Application {
+	app.defRouterGroup.HEAD(path, handler, middleware...)
+	return app
+}
+
+func (app *Application) POST(path string, handler Handler, middleware ...Middleware) *Application {
+	app.defRouterGroup.POST(path, handler, middleware...)
+	return app
+}
+
+func (app *Application) PUT(path string, handler Handler, middleware ...Middleware) *Application {
+	app.defRouterGroup.PUT(path, handler, middleware...)
+	return app
+}
+
+func (app *Application) PATCH(path string, handler Handler, middleware ...Middleware) *Application {
+	app.defRouterGroup.PATCH(path, handler, middleware...)
+	return app
+}
+
+func (app *Application) DELETE(path string, handler Handler, middleware ...Middleware) *Application {
+	app.defRouterGroup.DELETE(path, handler, middleware...)
+	return app
+}
+
+func (app *Application) ALL(path string, handler Handler, middleware ...Middleware) *Application {
+	app.defRouterGroup.ALL(path, handler, middleware...)
+	return app
+}
+
+// Static 在默认的路由组上注册静态文件服务
+func (app *Application) Static(prefix, dir string, config ...*StaticConfig) *Application {
+	app.defRouterGroup.Static(prefix, dir, config...)
+	return app
+}
+
+// StaticFS 在默认的路由组上注册静态文件服务，可以使用embed.FS
+func (app *Application) StaticFS(prefix string, fsys fs.FS, config ...*StaticConfig) *Application {
+	app.defRouterGroup.StaticFS(prefix, fsys, config...)
+	return app
 }
@@ -0,0 +1,116 @@
+package flow
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestJoinPaths(t *testing.T) {
+	tests := []struct {
+		prefix       string
+		relativePath string
+		want         string
+	}{
+		{"", "/users", "/users"},
+		{"/api", "/users", "/api/users"},
+		{"api", "users", "/api/users"},
+		{"/api/", "/users/", "/api/users/"},
+		{"/api", "", "/api"},
+		{"", "", "/"},
+		{"/api/v1", "/users/:id", "/api/v1/users/:id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix+"+"+tt.relativePath, func(t *testing.T) {
+			if got := joinPaths(tt.prefix, tt.relativePath); got != tt.want {
+				t.Errorf("joinPaths(%q, %q) = %q, want %q", tt.prefix, tt.relativePath, got, tt.want)
+			}
+		})
+	}
+}
+
+// 返回记录执行顺序的中间件
+func traceMiddleware(name string) Middleware {
+	return func(ctx *Context, next Next) {
+		trace, _ := ctx.GetData("trace")
+		names, _ := trace.([]string)
+		ctx.SetData("trace", append(names, name))
+		next()
+	}
+}
+
+// 返回路由路径，X-Trace返回中间件的执行顺序
+func traceHandler(ctx *Context) {
+	trace, _ := ctx.GetData("trace")
+	names, _ := trace.([]string)
+	ctx.SetHeader("X-Trace", strings.Join(names, ","))
+	ctx.Text(ctx.route)
+}
+
+func TestRouterGroupPrefix(t *testing.T) {
+	app := newTestApp(t)
+	handler := traceHandler
+	api := app.Group("api", traceMiddleware("api"))
+	v1 := api.Group("v1", traceMiddleware("v1"))
+	v1.GET("users/:id", handler, traceMiddleware("route"))
+	v1.Group("/admin/").GET("/stats", handler)
+	app.Group("").GET("/root", handler)
+	tests := []struct {
+		name   string
+		target string
+		status int
+		route  string
+		trace  string
+	}{
+		{"nested prefix without leading slash", "/api/v1/users/1", http.StatusOK, "/api/v1/users/:id", "api,v1,route"},
+		{"nested prefix with trailing slash", "/api/v1/admin/stats", http.StatusOK, "/api/v1/admin/stats", "api,v1"},
+		{"empty prefix", "/root", http.StatusOK, "/root", ""},
+		{"prefix is not a route", "/api/v1", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(app, http.MethodGet, tt.target, nil)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if w.Body.String() != tt.route {
+				t.Errorf("route = %q, want %q", w.Body.String(), tt.route)
+			}
+			if got := w.Header().Get("X-Trace"); got != tt.trace {
+				t.Errorf("middleware = %q, want %q", got, tt.trace)
+			}
+		})
+	}
+}
+
+func TestRouteChainCache(t *testing.T) {
+	app := newTestApp(t)
+	api := app.Group("/api", traceMiddleware("api"))
+	api.GET("/users", traceHandler, traceMiddleware("route"))
+	trace := func() string {
+		return serve(app, http.MethodGet, "/api/users", nil).Header().Get("X-Trace")
+	}
+	if got := trace(); got != "api,route" {
+		t.Errorf("middleware = %q, want api,route", got)
+	}
+	// 注册路由之后添加的中间件也会生效，父路由组的中间件在前
+	api.Use(traceMiddleware("late"))
+	app.Use(traceMiddleware("app"))
+	if got := trace(); got != "app,api,late,route" {
+		t.Errorf("middleware after Use = %q, want app,api,late,route", got)
+	}
+
+	// 没有添加中间件时复用缓存的中间件链
+	rc := &routeChain{rg: api, middleware: []Middleware{traceMiddleware("route")}}
+	first := rc.get()
+	if second := rc.get(); &first[0] != &second[0] {
+		t.Error("chain is rebuilt without new middleware")
+	}
+	api.Use(traceMiddleware("more"))
+	if third := rc.get(); len(third) != len(first)+1 {
+		t.Errorf("chain length = %d, want %d", len(third), len(first)+1)
+	}
+}
@@ -0,0 +1,168 @@
+package flow
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// 定义正在处理的请求计数，h2c的连接被接管后http.Server.Shutdown不会等待，关闭服务时通过它等待请求处理完成
+type activeRequests struct {
+	mu   sync.Mutex
+	n    int
+	idle chan struct{} // 没有正在处理的请求时关闭
+}
+
+func (ar *activeRequests) add() {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	if ar.n == 0 {
+		ar.idle = make(chan struct{})
+	}
+	ar.n++
+}
+
+func (ar *activeRequests) done() {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	ar.n--
+	if ar.n == 0 {
+		close(ar.idle)
+	}
+}
+
+// 等待正在处理的请求完成，ctx超时时返回错误
+func (ar *activeRequests) wait(ctx context.Context) error {
+	ar.mu.Lock()
+	if ar.n == 0 {
+		ar.mu.Unlock()
+		return nil
+	}
+	idle := ar.idle
+	ar.mu.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 创建http服务对象，没有使用https并且开启了H2C时支持明文的HTTP/2
+func (app *Application) newServer(tlsConfig *tls.Config) (*http.Server, error) {
+	serverConfig := app.serverConfig
+	server := &http.Server{
+		Handler:           app.router,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: serverConfig.ReadHeaderTimeout,
+		ReadTimeout:       serverConfig.ReadTimeout,
+		WriteTimeout:      serverConfig.WriteTimeout,
+		IdleTimeout:       serverConfig.IdleTimeout,
+		MaxHeaderBytes:    serverConfig.MaxHeaderBytes,
+	}
+	if tlsConfig == nil && serverConfig.H2C {
+		h2s := &http2.Server{IdleTimeout: serverConfig.IdleTimeout}
+		// 注册到http服务，Shutdown时给h2c的连接发送GOAWAY，不再接收新的请求
+		if err := http2.ConfigureServer(server, h2s); err != nil {
+			return nil, err
+		}
+		server.Handler = h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ProtoMajor == 2 {
+				app.h2cRequests.add()
+				defer app.h2cRequests.done()
+			}
+			app.router.ServeHTTP(w, r)
+		}), h2s)
+	}
+	return server, nil
+}
+
+// 返回服务的TLS配置，没有设置证书并且没有开启DevTLS时返回nil，使用http
+func (app *Application) serverTLSConfig() (*tls.Config, error) {
+	serverConfig := app.serverConfig
+	var tlsConfig *tls.Config
+	if serverConfig.TLSConfig != nil {
+		tlsConfig = serverConfig.TLSConfig.Clone()
+	}
+	if len(serverConfig.CertFile) > 0 || len(serverConfig.KeyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(serverConfig.CertFile, serverConfig.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		tlsConfig.Certificates = append(tlsConfig.Certificates, cert)
+	}
+	hasCert := tlsConfig != nil && (len(tlsConfig.Certificates) > 0 || tlsConfig.GetCertificate != nil || tlsConfig.GetConfigForClient != nil)
+	if !hasCert && serverConfig.DevTLS {
+		cert, err := selfSignedCertificate(serverConfig.Host)
+		if err != nil {
+			return nil, err
+		}
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		tlsConfig.Certificates = append(tlsConfig.Certificates, cert)
+		app.Logger.Warn("server is using a self-signed certificate, do not use DevTLS in production")
+		hasCert = true
+	}
+	if !hasCert {
+		return nil, nil
+	}
+	if tlsConfig.MinVersion == 0 {
+		tlsConfig.MinVersion = tls.VersionTLS12
+	}
+	return tlsConfig, nil
+}
+
+// 生成自签名证书，包括localhost，127.0.0.1，::1和服务启动地址，有效期30天
+func selfSignedCertificate(host string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"flow dev"}, CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(30 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if !ip.IsLoopback() && !ip.IsUnspecified() {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		}
+	} else if len(host) > 0 && host != "localhost" {
+		template.DNSNames = append(template.DNSNames, host)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
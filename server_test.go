@@ -0,0 +1,348 @@
+package flow
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// 返回使用明文HTTP/2（h2c）的客户端
+func h2cClient() *http.Client {
+	return &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+}
+
+// 返回服务的地址
+func serverAddr(app *Application) string {
+	return fmt.Sprintf("%s:%d", app.serverConfig.Host, app.serverConfig.Port)
+}
+
+// 发送GET请求，返回协议版本和实体
+func get(client *http.Client, target string) (string, string, error) {
+	res, err := client.Get(target)
+	if err != nil {
+		return "", "", err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	return res.Proto, string(body), err
+}
+
+func TestServerTLSConfig(t *testing.T) {
+	certPEM, keyPEM := newTestCertPEM(t, x509.ExtKeyUsageServerAuth)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	_ = os.WriteFile(certFile, []byte(certPEM), 0600)
+	_ = os.WriteFile(keyFile, []byte(keyPEM), 0600)
+	cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	custom := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS13}
+	tests := []struct {
+		name       string
+		config     *ServerConfig
+		wantNil    bool
+		wantErr    bool
+		certs      int
+		minVersion uint16
+	}{
+		{"http", &ServerConfig{}, true, false, 0, 0},
+		{"cert file", &ServerConfig{CertFile: certFile, KeyFile: keyFile}, false, false, 1, tls.VersionTLS12},
+		{"missing key file", &ServerConfig{CertFile: certFile}, false, true, 0, 0},
+		{"custom config", &ServerConfig{TLSConfig: custom}, false, false, 1, tls.VersionTLS13},
+		{"custom config without certificate", &ServerConfig{TLSConfig: &tls.Config{}}, true, false, 0, 0},
+		{"dev tls", &ServerConfig{DevTLS: true}, false, false, 1, tls.VersionTLS12},
+		{"dev tls uses the configured certificate", &ServerConfig{DevTLS: true, CertFile: certFile, KeyFile: keyFile}, false, false, 1, tls.VersionTLS12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, WithServerConfig(tt.config))
+			got, err := app.serverTLSConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("serverTLSConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (got == nil) != tt.wantNil {
+				t.Fatalf("serverTLSConfig() = %v, want nil %v", got, tt.wantNil)
+			}
+			if got == nil {
+				return
+			}
+			if len(got.Certificates) != tt.certs || got.MinVersion != tt.minVersion {
+				t.Errorf("certificates = %d, MinVersion = %x", len(got.Certificates), got.MinVersion)
+			}
+			// 不修改传入的TLS配置
+			if got == custom || len(custom.Certificates) != 1 {
+				t.Error("custom tls config is modified")
+			}
+		})
+	}
+}
+
+func TestSelfSignedCertificate(t *testing.T) {
+	tests := []struct {
+		host string
+		dns  []string
+		ips  int
+	}{
+		{"", []string{"localhost"}, 2},
+		{"127.0.0.1", []string{"localhost"}, 2},
+		{"0.0.0.0", []string{"localhost"}, 2},
+		{"192.168.1.10", []string{"localhost"}, 3},
+		{"dev.test", []string{"localhost", "dev.test"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			cert, err := selfSignedCertificate(tt.host)
+			if err != nil {
+				t.Fatalf("selfSignedCertificate() error = %v", err)
+			}
+			if strings.Join(cert.Leaf.DNSNames, ",") != strings.Join(tt.dns, ",") || len(cert.Leaf.IPAddresses) != tt.ips {
+				t.Errorf("DNSNames = %v, IPAddresses = %v", cert.Leaf.DNSNames, cert.Leaf.IPAddresses)
+			}
+		})
+	}
+}
+
+func TestRunTLS(t *testing.T) {
+	certPEM, keyPEM := newTestCertPEM(t, x509.ExtKeyUsageServerAuth)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	_ = os.WriteFile(certFile, []byte(certPEM), 0600)
+	_ = os.WriteFile(keyFile, []byte(keyPEM), 0600)
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM([]byte(certPEM))
+	tests := []struct {
+		name   string
+		config *ServerConfig
+		tls    *tls.Config
+	}{
+		{"cert file", &ServerConfig{CertFile: certFile, KeyFile: keyFile}, &tls.Config{RootCAs: roots}},
+		{"dev tls", &ServerConfig{DevTLS: true}, &tls.Config{InsecureSkipVerify: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, WithServerConfig(tt.config))
+			app.GET("/", func(ctx *Context) {
+				ctx.Text("ok")
+			})
+			startTestApp(t, app)
+			// https默认开启HTTP/2
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: tt.tls, ForceAttemptHTTP2: true}}
+			proto, body, err := get(client, "https://"+serverAddr(app)+"/")
+			if err != nil || proto != "HTTP/2.0" || body != "ok" {
+				t.Errorf("get() = %q, %q, %v", proto, body, err)
+			}
+		})
+	}
+}
+
+func TestRunH2C(t *testing.T) {
+	tests := []struct {
+		name    string
+		h2c     bool
+		wantErr bool
+	}{
+		{"enabled", true, false},
+		{"disabled", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, WithServerConfig(&ServerConfig{H2C: tt.h2c}))
+			app.GET("/", func(ctx *Context) {
+				ctx.Text("ok")
+			})
+			startTestApp(t, app)
+			proto, body, err := get(h2cClient(), "http://"+serverAddr(app)+"/")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (proto != "HTTP/2.0" || body != "ok") {
+				t.Errorf("get() = %q, %q", proto, body)
+			}
+			// 开启h2c后仍然支持HTTP/1.1
+			if proto, body, err = get(http.DefaultClient, "http://"+serverAddr(app)+"/"); err != nil || proto != "HTTP/1.1" || body != "ok" {
+				t.Errorf("get(http/1.1) = %q, %q, %v", proto, body, err)
+			}
+		})
+	}
+}
+
+func TestNewServerTimeouts(t *testing.T) {
+	app := newTestApp(t, WithServerConfig(&ServerConfig{ReadTimeout: time.Second, WriteTimeout: 2 * time.Second}))
+	server, err := app.newServer(nil)
+	if err != nil {
+		t.Fatalf("newServer() error = %v", err)
+	}
+	// 没有设置的超时时间使用默认值
+	if server.ReadHeaderTimeout != defReadHeaderTimeout() || server.IdleTimeout != defIdleTimeout() || server.MaxHeaderBytes != defMaxHeaderBytes() {
+		t.Errorf("server = %+v", server)
+	}
+	if server.ReadTimeout != time.Second || server.WriteTimeout != 2*time.Second {
+		t.Errorf("ReadTimeout = %v, WriteTimeout = %v", server.ReadTimeout, server.WriteTimeout)
+	}
+}
+
+func TestServerLimits(t *testing.T) {
+	app := newTestApp(t, WithServerConfig(&ServerConfig{ReadHeaderTimeout: 100 * time.Millisecond, MaxHeaderBytes: 1024}))
+	app.GET("/", func(ctx *Context) {
+		ctx.Text("ok")
+	})
+	startTestApp(t, app)
+
+	t.Run("read header timeout", func(t *testing.T) {
+		conn, err := net.Dial("tcp", serverAddr(app))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		// 只发送一部分请求头，超时后服务端关闭连接
+		_, _ = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: a\r\n")
+		_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		start := time.Now()
+		if _, err = io.ReadAll(conn); err != nil {
+			t.Fatalf("connection is not closed: %v", err)
+		}
+		if cost := time.Since(start); cost > 2*time.Second {
+			t.Errorf("connection closed after %v", cost)
+		}
+	})
+
+	t.Run("max header bytes", func(t *testing.T) {
+		conn, err := net.Dial("tcp", serverAddr(app))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		_, _ = fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: a\r\nX-Large: %s\r\n\r\n", strings.Repeat("a", 8<<10))
+		res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+			t.Errorf("status = %d, want 431", res.StatusCode)
+		}
+	})
+}
+
+// 启动有一个阻塞路由的服务，entered在请求开始处理时收到通知，关闭release后请求返回
+func startDrainApp(t *testing.T, h2c bool) (app *Application, entered chan struct{}, release chan struct{}) {
+	t.Helper()
+	entered, release = make(chan struct{}, 1), make(chan struct{})
+	app = newTestApp(t, WithServerConfig(&ServerConfig{H2C: h2c}))
+	app.GET("/slow", func(ctx *Context) {
+		entered <- struct{}{}
+		<-release
+		ctx.Text("done")
+	})
+	startTestApp(t, app)
+	// 在关闭服务之前释放阻塞的请求
+	t.Cleanup(func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	})
+	return app, entered, release
+}
+
+func TestShutdownDrainsRequests(t *testing.T) {
+	for _, h2c := range []bool{false, true} {
+		t.Run(fmt.Sprintf("h2c=%v", h2c), func(t *testing.T) {
+			app, entered, release := startDrainApp(t, h2c)
+			client, proto := http.DefaultClient, "HTTP/1.1"
+			if h2c {
+				client, proto = h2cClient(), "HTTP/2.0"
+			}
+			type result struct {
+				proto, body string
+				err         error
+			}
+			resCh := make(chan result, 1)
+			go func() {
+				p, body, err := get(client, "http://"+serverAddr(app)+"/slow")
+				resCh <- result{p, body, err}
+			}()
+			<-entered
+			shutdownErr := make(chan error, 1)
+			go func() {
+				shutdownErr <- app.Shutdown(context.Background())
+			}()
+			// 正在处理的请求完成之前不会关闭
+			select {
+			case err := <-shutdownErr:
+				t.Fatalf("Shutdown() returned before the request finished: %v", err)
+			case <-time.After(100 * time.Millisecond):
+			}
+			close(release)
+			res := <-resCh
+			if res.err != nil || res.proto != proto || res.body != "done" {
+				t.Errorf("in-flight request = %q, %q, %v", res.proto, res.body, res.err)
+			}
+			select {
+			case err := <-shutdownErr:
+				if err != nil {
+					t.Errorf("Shutdown() error = %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Shutdown() did not return")
+			}
+			// 关闭后不再接收新的请求
+			if _, _, err := get(client, "http://"+serverAddr(app)+"/slow"); err == nil {
+				t.Error("request after Shutdown succeeded")
+			}
+		})
+	}
+}
+
+func TestShutdownDrainTimeout(t *testing.T) {
+	tests := []struct {
+		h2c  bool
+		want string
+	}{
+		{false, "context deadline exceeded"},
+		{true, "wait h2c requests: context deadline exceeded"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("h2c=%v", tt.h2c), func(t *testing.T) {
+			app, entered, _ := startDrainApp(t, tt.h2c)
+			client := http.DefaultClient
+			if tt.h2c {
+				client = h2cClient()
+			}
+			go func() {
+				_, _, _ = get(client, "http://"+serverAddr(app)+"/slow")
+			}()
+			<-entered
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			err := app.Shutdown(ctx)
+			if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Shutdown() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
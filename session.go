@@ -0,0 +1,330 @@
+package flow
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"sync"
+	"time"
+
+	"github.com/funswe/flow/utils/json"
+	"go.uber.org/zap"
+)
+
+// SessionStore 定义session的存储接口，data是json编码后的session数据
+type SessionStore interface {
+	Get(id string) ([]byte, error)                       // 获取session数据，session不存在或者已经过期时返回nil, nil
+	Set(id string, data []byte, ttl time.Duration) error // 保存session数据，ttl后过期
+	Delete(id string) error                              // 删除session数据
+}
+
+// SessionConfig 定义session配置
+type SessionConfig struct {
+	Store          SessionStore   // session存储，默认开启redis时使用redis存储，否则使用内存存储
+	CookieName     string         // 保存session id的cookie名称，默认值flow_session
+	MaxAge         time.Duration  // session的有效期，默认值24小时
+	DisableSliding bool           // 是否关闭滑动过期，默认每次请求都会重新计算有效期，关闭后从创建时开始计算
+	Cookie         *CookieOptions // 保存session id的cookie选项，为空时使用cookie配置里的默认值，MaxAge和session的有效期保持一致
+}
+
+// 返回默认的session配置
+func defSessionConfig() *SessionConfig {
+	return &SessionConfig{
+		CookieName: "flow_session",
+		MaxAge:     24 * time.Hour,
+	}
+}
+
+// 保存到存储里的session记录
+type sessionRecord struct {
+	Data    map[string]interface{} `json:"data"`
+	Expires int64                  `json:"expires"` // 过期时间的unix秒数
+}
+
+// Session 定义请求的session对象，在写入返回头之前保存到存储里
+type Session struct {
+	mu        sync.RWMutex
+	ctx       *Context
+	config    *SessionConfig
+	id        string
+	oldId     string // 重新生成id前的id，保存时删除
+	data      map[string]interface{}
+	expires   time.Time
+	changed   bool
+	destroyed bool
+	saved     bool
+}
+
+// SessionMiddleware 返回session中间件，session id保存在cookie里，通过ctx.Session()获取session对象，
+// 中间件使用配置的副本，不会修改传入的配置，同一个配置可以用于多个中间件
+func SessionMiddleware(sessionConfig ...*SessionConfig) Middleware {
+	cfg := defSessionConfig()
+	if len(sessionConfig) > 0 && sessionConfig[0] != nil {
+		c := *sessionConfig[0]
+		cfg = &c
+	}
+	if len(cfg.CookieName) == 0 {
+		cfg.CookieName = defSessionConfig().CookieName
+	}
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = defSessionConfig().MaxAge
+	}
+	var storeOnce sync.Once
+	return func(ctx *Context, next Next) {
+		// redis在服务启动时才初始化，第一次请求时再确定默认的存储
+		storeOnce.Do(func() {
+			if cfg.Store != nil {
+				return
+			}
+			if ctx.app.Redis != nil {
+				cfg.Store = NewRedisSessionStore(ctx.app.Redis, "")
+			} else {
+				cfg.Store = NewMemorySessionStore()
+			}
+		})
+		s := &Session{ctx: ctx, config: cfg}
+		s.load()
+		ctx.session = s
+		ctx.res.beforeWrite(s.save)
+		next()
+		s.save()
+	}
+}
+
+// Session 获取请求的session对象，没有使用session中间件时panic
+func (c *Context) Session() *Session {
+	if c.session == nil {
+		panic("session middleware is not used")
+	}
+	return c.session
+}
+
+// 根据cookie里的session id加载session数据
+func (s *Session) load() {
+	s.data = make(map[string]interface{})
+	id, err := s.ctx.Cookie(s.config.CookieName)
+	if err != nil || len(id) == 0 || len(id) > 128 {
+		return
+	}
+	raw, err := s.config.Store.Get(id)
+	if err != nil {
+		s.ctx.Logger.Error("load session error", zap.Error(err))
+		return
+	}
+	if raw == nil {
+		return
+	}
+	record := sessionRecord{}
+	if err = json.Unmarshal(raw, &record); err != nil || time.Now().Unix() >= record.Expires {
+		return
+	}
+	s.id = id
+	s.expires = time.Unix(record.Expires, 0)
+	if record.Data != nil {
+		s.data = record.Data
+	}
+}
+
+// ID 获取session id，新的session在保存时才生成id
+func (s *Session) ID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.id
+}
+
+// Get 获取session里的值，数值类型会解析成float64
+func (s *Session) Get(key string) (value interface{}, exists bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, exists = s.data[key]
+	return
+}
+
+// Set 设置session里的值，值需要可以json编码
+func (s *Session) Set(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = value
+	s.changed = true
+}
+
+// Delete 删除session里的值
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data[key]; ok {
+		delete(s.data, key)
+		s.changed = true
+	}
+}
+
+// Regenerate 重新生成session id并保留数据，登录成功后调用，防止session固定攻击
+func (s *Session) Regenerate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.id) > 0 && len(s.oldId) == 0 {
+		s.oldId = s.id
+	}
+	s.id = ""
+	s.expires = time.Time{}
+	s.changed = true
+}
+
+// Destroy 删除session数据和cookie，退出登录时调用
+func (s *Session) Destroy() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = make(map[string]interface{})
+	s.destroyed = true
+}
+
+// 保存session，只会执行一次，返回头写入后修改session不再生效
+func (s *Session) save() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.saved {
+		return
+	}
+	s.saved = true
+	store := s.config.Store
+	if len(s.oldId) > 0 {
+		if err := store.Delete(s.oldId); err != nil {
+			s.ctx.Logger.Error("delete session error", zap.Error(err))
+		}
+	}
+	if s.destroyed {
+		if len(s.id) > 0 {
+			if err := store.Delete(s.id); err != nil {
+				s.ctx.Logger.Error("delete session error", zap.Error(err))
+			}
+		}
+		s.ctx.ClearCookie(s.config.CookieName, s.config.Cookie)
+		return
+	}
+	// 没有数据的新session不保存
+	if len(s.id) == 0 && len(s.data) == 0 {
+		return
+	}
+	if !s.changed && s.config.DisableSliding {
+		return
+	}
+	now := time.Now()
+	if len(s.id) == 0 {
+		s.id = newSessionId()
+	}
+	if s.expires.IsZero() || !s.config.DisableSliding {
+		s.expires = now.Add(s.config.MaxAge)
+	}
+	raw, err := json.Marshal(sessionRecord{Data: s.data, Expires: s.expires.Unix()})
+	if err != nil {
+		s.ctx.Logger.Error("encode session error", zap.Error(err))
+		return
+	}
+	if err = store.Set(s.id, raw, s.expires.Sub(now)); err != nil {
+		s.ctx.Logger.Error("save session error", zap.Error(err))
+		return
+	}
+	options := CookieOptions{}
+	if s.config.Cookie != nil {
+		options = *s.config.Cookie
+	}
+	options.MaxAge = int(s.expires.Sub(now).Seconds())
+	options.Expires = s.expires
+	s.ctx.SetCookie(s.config.CookieName, s.id, &options)
+}
+
+// 生成随机的session id
+func newSessionId() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// MemorySessionStore 定义内存的session存储，用于测试和单实例服务
+type MemorySessionStore struct {
+	mu        sync.Mutex
+	sessions  map[string]memorySession
+	lastSweep time.Time
+}
+
+type memorySession struct {
+	data    []byte
+	expires time.Time
+}
+
+// NewMemorySessionStore 返回内存的session存储
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]memorySession), lastSweep: time.Now()}
+}
+
+func (ms *MemorySessionStore) Get(id string) ([]byte, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	session, ok := ms.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+	if time.Now().After(session.expires) {
+		delete(ms.sessions, id)
+		return nil, nil
+	}
+	return session.data, nil
+}
+
+func (ms *MemorySessionStore) Set(id string, data []byte, ttl time.Duration) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	now := time.Now()
+	// 每分钟最多清理一次过期的session
+	if now.Sub(ms.lastSweep) > time.Minute {
+		ms.lastSweep = now
+		for k, v := range ms.sessions {
+			if now.After(v.expires) {
+				delete(ms.sessions, k)
+			}
+		}
+	}
+	ms.sessions[id] = memorySession{data: data, expires: now.Add(ttl)}
+	return nil
+}
+
+func (ms *MemorySessionStore) Delete(id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.sessions, id)
+	return nil
+}
+
+// RedisSessionStore 定义redis的session存储，key会加上RedisConfig.Prefix
+type RedisSessionStore struct {
+	rd        *RedisClient
+	keyPrefix string
+}
+
+// NewRedisSessionStore 返回redis的session存储，keyPrefix为空时默认值session:
+func NewRedisSessionStore(rd *RedisClient, keyPrefix string) *RedisSessionStore {
+	if len(keyPrefix) == 0 {
+		keyPrefix = "session:"
+	}
+	return &RedisSessionStore{rd: rd, keyPrefix: keyPrefix}
+}
+
+func (rs *RedisSessionStore) Get(id string) ([]byte, error) {
+	result, err := rs.rd.Get(rs.keyPrefix + id)
+	if err != nil {
+		if rs.rd.IsNil(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return []byte(result.Raw()), nil
+}
+
+func (rs *RedisSessionStore) Set(id string, data []byte, ttl time.Duration) error {
+	return rs.rd.Set(rs.keyPrefix+id, string(data), ttl)
+}
+
+func (rs *RedisSessionStore) Delete(id string) error {
+	return rs.rd.Delete(rs.keyPrefix + id)
+}
@@ -0,0 +1,229 @@
+package flow
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// 记录保存次数的session存储
+type countingSessionStore struct {
+	*MemorySessionStore
+	mu   sync.Mutex
+	sets int
+	ttl  time.Duration
+}
+
+func (cs *countingSessionStore) Set(id string, data []byte, ttl time.Duration) error {
+	cs.mu.Lock()
+	cs.sets++
+	cs.ttl = ttl
+	cs.mu.Unlock()
+	return cs.MemorySessionStore.Set(id, data, ttl)
+}
+
+// 创建使用session中间件的测试app
+func newSessionApp(t *testing.T, cfg *SessionConfig, opts ...Option) *Application {
+	t.Helper()
+	app := newTestApp(t, opts...)
+	app.Use(SessionMiddleware(cfg))
+	app.GET("/set", func(ctx *Context) {
+		ctx.Session().Set("user", ctx.GetStringParam("user"))
+		ctx.Text("ok")
+	})
+	app.GET("/get", func(ctx *Context) {
+		user, _ := ctx.Session().Get("user")
+		if user == nil {
+			user = ""
+		}
+		ctx.Text(user.(string))
+	})
+	app.GET("/login", func(ctx *Context) {
+		ctx.Session().Regenerate()
+		ctx.Session().Set("login", true)
+		ctx.Text("ok")
+	})
+	app.GET("/logout", func(ctx *Context) {
+		ctx.Session().Destroy()
+		ctx.Text("ok")
+	})
+	return app
+}
+
+// 返回响应里的session cookie
+func sessionCookie(w interface{ Result() *http.Response }, name string) *http.Cookie {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestSessionLoadAndSave(t *testing.T) {
+	mr := miniredis.RunT(t)
+	tests := []struct {
+		name  string
+		store func(t *testing.T) SessionStore
+	}{
+		{"memory", func(t *testing.T) SessionStore { return NewMemorySessionStore() }},
+		{"redis", func(t *testing.T) SessionStore {
+			port, _ := strconv.Atoi(mr.Port())
+			app := newTestApp(t, WithRedisConfig(&RedisConfig{Enable: true, Host: mr.Host(), Port: port, Prefix: "flow"}))
+			initRedis(app)
+			t.Cleanup(func() {
+				_ = app.Redis.Close()
+			})
+			return NewRedisSessionStore(app.Redis, "")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newSessionApp(t, &SessionConfig{Store: tt.store(t)})
+			// 没有数据的新session不保存
+			if w := serve(app, http.MethodGet, "/get", nil); sessionCookie(w, "flow_session") != nil {
+				t.Error("empty session set a cookie")
+			}
+			w := serve(app, http.MethodGet, "/set?user=bob", nil)
+			cookie := sessionCookie(w, "flow_session")
+			if cookie == nil {
+				t.Fatal("session cookie is not set")
+			}
+			if w = serve(app, http.MethodGet, "/get", nil, "Cookie", cookie.String()); w.Body.String() != "bob" {
+				t.Errorf("get = %q, want bob", w.Body.String())
+			}
+			// 不存在的session id当作新的session
+			if w = serve(app, http.MethodGet, "/get", nil, "Cookie", "flow_session=unknown"); w.Body.String() != "" {
+				t.Errorf("get unknown = %q, want empty", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestSessionRegenerateAndDestroy(t *testing.T) {
+	store := NewMemorySessionStore()
+	app := newSessionApp(t, &SessionConfig{Store: store, CookieName: "sid"})
+	old := sessionCookie(serve(app, http.MethodGet, "/set?user=bob", nil), "sid")
+
+	// 登录后id变化，数据保留，旧的id失效
+	w := serve(app, http.MethodGet, "/login", nil, "Cookie", old.String())
+	login := sessionCookie(w, "sid")
+	if login == nil || login.Value == old.Value {
+		t.Fatalf("Regenerate() cookie = %v, old = %v", login, old)
+	}
+	if raw, _ := store.Get(old.Value); raw != nil {
+		t.Error("old session still exists after Regenerate")
+	}
+	if w = serve(app, http.MethodGet, "/get", nil, "Cookie", login.String()); w.Body.String() != "bob" {
+		t.Errorf("get after login = %q, want bob", w.Body.String())
+	}
+	if w = serve(app, http.MethodGet, "/get", nil, "Cookie", old.String()); w.Body.String() != "" {
+		t.Errorf("get with old id = %q, want empty", w.Body.String())
+	}
+
+	// 退出后删除数据和cookie
+	w = serve(app, http.MethodGet, "/logout", nil, "Cookie", login.String())
+	if cleared := sessionCookie(w, "sid"); cleared == nil || cleared.MaxAge >= 0 {
+		t.Errorf("Destroy() cookie = %v, want cleared", cleared)
+	}
+	if raw, _ := store.Get(login.Value); raw != nil {
+		t.Error("session still exists after Destroy")
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	tests := []struct {
+		name    string
+		sliding bool
+		sets    int // 写入session后再读取一次，期望的保存次数
+	}{
+		{"sliding saves on every request", true, 2},
+		{"fixed saves only on change", false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &countingSessionStore{MemorySessionStore: NewMemorySessionStore()}
+			app := newSessionApp(t, &SessionConfig{Store: store, MaxAge: time.Hour, DisableSliding: !tt.sliding})
+			cookie := sessionCookie(serve(app, http.MethodGet, "/set?user=bob", nil), "flow_session")
+			if cookie.MaxAge != 3600 {
+				t.Errorf("cookie MaxAge = %d, want 3600", cookie.MaxAge)
+			}
+			if store.ttl != time.Hour {
+				t.Errorf("store ttl = %v, want 1h", store.ttl)
+			}
+			w := serve(app, http.MethodGet, "/get", nil, "Cookie", cookie.String())
+			if store.sets != tt.sets {
+				t.Errorf("store sets = %d, want %d", store.sets, tt.sets)
+			}
+			// 滑动过期时重新设置cookie的有效期
+			if got := sessionCookie(w, "flow_session") != nil; got != tt.sliding {
+				t.Errorf("cookie refreshed = %v, want %v", got, tt.sliding)
+			}
+		})
+	}
+}
+
+func TestSessionCookieOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Option
+		cookie   *CookieOptions
+		httpOnly bool
+	}{
+		{"default cookie config", nil, nil, true},
+		{"cookie config with only keys", []Option{WithCookieConfig(&CookieConfig{Keys: []string{"secret"}})}, nil, true},
+		{"session cookie option", nil, &CookieOptions{HttpOnly: Bool(false)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newSessionApp(t, &SessionConfig{Cookie: tt.cookie}, tt.opts...)
+			cookie := sessionCookie(serve(app, http.MethodGet, "/set?user=bob", nil), "flow_session")
+			if cookie == nil {
+				t.Fatal("session cookie is not set")
+			}
+			if cookie.HttpOnly != tt.httpOnly {
+				t.Errorf("HttpOnly = %v, want %v", cookie.HttpOnly, tt.httpOnly)
+			}
+		})
+	}
+}
+
+func TestSessionMiddlewareKeepsConfig(t *testing.T) {
+	cfg := &SessionConfig{}
+	app := newSessionApp(t, cfg)
+	serve(app, http.MethodGet, "/set?user=bob", nil)
+	// 默认值和默认的存储只设置在中间件的副本上
+	if cfg.Store != nil || len(cfg.CookieName) > 0 || cfg.MaxAge != 0 {
+		t.Errorf("config was modified: %+v", cfg)
+	}
+}
+
+func TestMemorySessionStore(t *testing.T) {
+	store := NewMemorySessionStore()
+	_ = store.Set("expired", []byte("a"), -time.Second)
+	_ = store.Set("valid", []byte("b"), time.Hour)
+	if raw, _ := store.Get("expired"); raw != nil {
+		t.Errorf("Get(expired) = %q, want nil", raw)
+	}
+	if raw, _ := store.Get("valid"); string(raw) != "b" {
+		t.Errorf("Get(valid) = %q, want b", raw)
+	}
+	// 超过清理间隔后保存时清理所有过期的session
+	_ = store.Set("expired2", []byte("c"), -time.Second)
+	store.lastSweep = time.Now().Add(-2 * time.Minute)
+	_ = store.Set("other", []byte("d"), time.Hour)
+	if _, ok := store.sessions["expired2"]; ok {
+		t.Error("expired session is not swept")
+	}
+	if len(store.sessions) != 2 {
+		t.Errorf("got %d sessions, want 2", len(store.sessions))
+	}
+	_ = store.Delete("valid")
+	if raw, _ := store.Get("valid"); raw != nil {
+		t.Errorf("Get(deleted) = %q, want nil", raw)
+	}
+}
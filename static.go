@@ -0,0 +1,229 @@
+package flow
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StaticConfig 定义静态文件服务配置
+type StaticConfig struct {
+	Index                []string      // 目录的默认文件，默认值index.html
+	Browse               bool          // 没有默认文件时是否列出目录内容，默认值false
+	MaxAge               time.Duration // Cache-Control的max-age，默认值0，返回no-cache，每次都需要校验Etag或者Last-Modified
+	DisablePrecompressed bool          // 是否禁用预压缩文件，默认客户端支持时返回同名的.br和.gz文件
+}
+
+// 返回默认的静态文件服务配置
+func defStaticConfig() *StaticConfig {
+	return &StaticConfig{
+		Index: []string{"index.html"},
+	}
+}
+
+// 预压缩文件的后缀，按优先级排序
+var precompressedEncodings = []struct {
+	encoding string
+	ext      string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// Static 将目录注册为静态文件服务，如rg.Static("/assets", "./public")
+func (rg *RouterGroup) Static(prefix, dir string, config ...*StaticConfig) *RouterGroup {
+	return rg.StaticFS(prefix, os.DirFS(dir), config...)
+}
+
+// StaticFS 将文件系统注册为静态文件服务，可以使用embed.FS
+func (rg *RouterGroup) StaticFS(prefix string, fsys fs.FS, config ...*StaticConfig) *RouterGroup {
+	cfg := defStaticConfig()
+	if len(config) > 0 && config[0] != nil {
+		cfg = config[0]
+	}
+	if len(cfg.Index) == 0 {
+		cfg.Index = defStaticConfig().Index
+	}
+	sh := &staticHandler{fsys: fsys, config: cfg}
+	relativePath := joinPaths(prefix, "/*filepath")
+	rg.handle(HttpMethodGet, relativePath, sh.serve, nil)
+	rg.handle(HttpMethodHead, relativePath, sh.serve, nil)
+	return rg
+}
+
+// 定义静态文件处理器
+type staticHandler struct {
+	fsys   fs.FS
+	config *StaticConfig
+	etags  sync.Map // 没有修改时间的文件（如embed.FS）根据内容计算的Etag
+}
+
+func (sh *staticHandler) serve(ctx *Context) {
+	name := path.Clean("/" + ctx.uriParams.ByName("filepath"))
+	rel := strings.TrimPrefix(name, "/")
+	if len(rel) == 0 {
+		rel = "."
+	}
+	if !fs.ValidPath(rel) {
+		ctx.Error(NewHTTPError(http.StatusNotFound, 0, ""))
+		return
+	}
+	stat, err := fs.Stat(sh.fsys, rel)
+	if err != nil {
+		ctx.fileError(err)
+		return
+	}
+	if !stat.IsDir() {
+		sh.serveFile(ctx, rel, stat)
+		return
+	}
+	// 目录的链接必须以/结尾，否则页面里的相对路径会出错
+	if uri := ctx.GetUri(); !strings.HasSuffix(uri, "/") {
+		target := uri + "/"
+		if q := ctx.GetQuerystring(); len(q) > 0 {
+			target += "?" + q
+		}
+		ctx.Redirect(target, http.StatusMovedPermanently)
+		return
+	}
+	for _, index := range sh.config.Index {
+		indexPath := path.Join(rel, index)
+		if indexStat, err := fs.Stat(sh.fsys, indexPath); err == nil && !indexStat.IsDir() {
+			sh.serveFile(ctx, indexPath, indexStat)
+			return
+		}
+	}
+	if !sh.config.Browse {
+		ctx.Error(NewHTTPError(http.StatusNotFound, 0, ""))
+		return
+	}
+	sh.serveDir(ctx, rel)
+}
+
+// 返回文件，客户端支持时优先返回预压缩文件
+func (sh *staticHandler) serveFile(ctx *Context, rel string, stat fs.FileInfo) {
+	if sh.config.MaxAge > 0 {
+		ctx.SetHeader(HttpHeaderCacheControl, fmt.Sprintf("public, max-age=%d", int64(sh.config.MaxAge.Seconds())))
+	} else {
+		ctx.SetHeader(HttpHeaderCacheControl, "no-cache")
+	}
+	servePath, encoding := rel, ""
+	if !sh.config.DisablePrecompressed {
+		ctx.res.addVary(HttpHeaderAcceptEncoding)
+		acceptEncoding := ctx.GetHeader(HttpHeaderAcceptEncoding)
+		for _, pc := range precompressedEncodings {
+			if !acceptsEncoding(acceptEncoding, pc.encoding) {
+				continue
+			}
+			if pcStat, err := fs.Stat(sh.fsys, rel+pc.ext); err == nil && !pcStat.IsDir() {
+				servePath, encoding, stat = rel+pc.ext, pc.encoding, pcStat
+				break
+			}
+		}
+	}
+	f, err := sh.fsys.Open(servePath)
+	if err != nil {
+		ctx.fileError(err)
+		return
+	}
+	defer f.Close()
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			ctx.Error(err)
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+	etag, err := sh.etag(servePath, stat, content)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.SetHeader(HttpHeaderEtag, etag)
+	if len(encoding) > 0 {
+		ctx.SetHeader(HttpHeaderContentEncoding, encoding)
+		// 使用原文件的后缀设置Content-Type
+		if ct := mime.TypeByExtension(path.Ext(rel)); len(ct) > 0 {
+			ctx.SetHeader(HttpHeaderContentType, ct)
+		}
+	}
+	// ServeContent会处理If-None-Match，If-Modified-Since和Range请求，并设置Last-Modified
+	http.ServeContent(ctx.res.writer(), ctx.req.req, path.Base(rel), stat.ModTime(), content)
+}
+
+// 计算文件的Etag，有修改时间的使用长度和修改时间，否则根据内容计算并缓存
+func (sh *staticHandler) etag(servePath string, stat fs.FileInfo, content io.ReadSeeker) (string, error) {
+	if !stat.ModTime().IsZero() {
+		return fmt.Sprintf(`W/"%x-%x"`, stat.Size(), stat.ModTime().UnixNano()), nil
+	}
+	if v, ok := sh.etags.Load(servePath); ok {
+		return v.(string), nil
+	}
+	h := fnv.New64a()
+	if _, err := io.Copy(h, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := fmt.Sprintf(`"%x-%x"`, stat.Size(), h.Sum64())
+	sh.etags.Store(servePath, etag)
+	return etag, nil
+}
+
+// 列出目录内容
+func (sh *staticHandler) serveDir(ctx *Context, rel string) {
+	entries, err := fs.ReadDir(sh.fsys, rel)
+	if err != nil {
+		ctx.fileError(err)
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	buf := new(bytes.Buffer)
+	buf.WriteString("<!doctype html>\n<meta name=\"viewport\" content=\"width=device-width\">\n<pre>\n")
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		}
+		u := url.URL{Path: name}
+		fmt.Fprintf(buf, "<a href=\"%s\">%s</a>\n", u.String(), html.EscapeString(name))
+	}
+	buf.WriteString("</pre>\n")
+	ctx.HTML(buf.String())
+}
+
+// 判断Accept-Encoding是否接受指定的编码，q=0表示不接受
+func acceptsEncoding(acceptEncoding, encoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.TrimSpace(name)
+		if name != encoding && name != "*" {
+			continue
+		}
+		if _, q, ok := strings.Cut(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
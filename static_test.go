@@ -0,0 +1,179 @@
+package flow
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// 测试用的静态文件，没有修改时间，和embed.FS一样
+func testStaticFS() fstest.MapFS {
+	return fstest.MapFS{
+		"app.js":             {Data: []byte("console.log(1)")},
+		"app.js.br":          {Data: []byte("br-data")},
+		"app.js.gz":          {Data: []byte("gz-data")},
+		"style.css":          {Data: []byte("body{}")},
+		"docs/index.html":    {Data: []byte("docs")},
+		"files/a.txt":        {Data: []byte("a")},
+		"files/<b>.txt":      {Data: []byte("b")},
+		"files/sub/c.txt":    {Data: []byte("c")},
+		"files/skip.txt.gz/": {Mode: os.ModeDir},
+	}
+}
+
+func TestStaticPrecompressed(t *testing.T) {
+	tests := []struct {
+		name           string
+		config         *StaticConfig
+		target         string
+		acceptEncoding string
+		body           string
+		encoding       string
+	}{
+		{"br preferred", nil, "/assets/app.js", "gzip, br", "br-data", "br"},
+		{"gzip", nil, "/assets/app.js", "gzip", "gz-data", "gzip"},
+		{"br rejected by q=0", nil, "/assets/app.js", "br;q=0, gzip", "gz-data", "gzip"},
+		{"wildcard", nil, "/assets/app.js", "*", "br-data", "br"},
+		{"no accept encoding", nil, "/assets/app.js", "", "console.log(1)", ""},
+		{"no precompressed file", nil, "/assets/style.css", "gzip, br", "body{}", ""},
+		{"disabled", &StaticConfig{DisablePrecompressed: true}, "/assets/app.js", "gzip, br", "console.log(1)", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			app.StaticFS("/assets", testStaticFS(), tt.config)
+			w := serve(app, http.MethodGet, tt.target, nil, HttpHeaderAcceptEncoding, tt.acceptEncoding)
+			if w.Code != http.StatusOK || w.Body.String() != tt.body {
+				t.Errorf("response = %d %q, want %q", w.Code, w.Body.String(), tt.body)
+			}
+			if got := w.Header().Get(HttpHeaderContentEncoding); got != tt.encoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.encoding)
+			}
+			// 预压缩文件使用原文件的Content-Type
+			if ct, want := w.Header().Get(HttpHeaderContentType), mime.TypeByExtension(path.Ext(tt.target)); ct != want {
+				t.Errorf("Content-Type = %q, want %q", ct, want)
+			}
+			if vary := w.Header().Get(HttpHeaderVary); (vary == HttpHeaderAcceptEncoding) == (tt.config != nil) {
+				t.Errorf("Vary = %q", vary)
+			}
+		})
+	}
+}
+
+func TestStaticCache(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name         string
+		register     func(app *Application)
+		weak         bool
+		cacheControl string
+	}{
+		{"dir uses modification time", func(app *Application) {
+			app.Static("/assets", dir)
+		}, true, "no-cache"},
+		{"fs without modification time uses content hash", func(app *Application) {
+			app.StaticFS("/assets", fstest.MapFS{"a.txt": {Data: []byte("hello")}}, &StaticConfig{MaxAge: time.Hour})
+		}, false, "public, max-age=3600"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			tt.register(app)
+			w := serve(app, http.MethodGet, "/assets/a.txt", nil)
+			etag := w.Header().Get(HttpHeaderEtag)
+			if w.Code != http.StatusOK || w.Body.String() != "hello" || len(etag) == 0 {
+				t.Fatalf("response = %d %q, Etag = %q", w.Code, w.Body.String(), etag)
+			}
+			if strings.HasPrefix(etag, "W/") != tt.weak {
+				t.Errorf("Etag = %q, want weak %v", etag, tt.weak)
+			}
+			if got := w.Header().Get(HttpHeaderCacheControl); got != tt.cacheControl {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.cacheControl)
+			}
+			// 相同的文件返回相同的Etag，带上Etag校验时返回304
+			if again := serve(app, http.MethodGet, "/assets/a.txt", nil).Header().Get(HttpHeaderEtag); again != etag {
+				t.Errorf("Etag changed from %q to %q", etag, again)
+			}
+			w = serve(app, http.MethodGet, "/assets/a.txt", nil, "If-None-Match", etag)
+			if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+				t.Errorf("If-None-Match response = %d %q, want 304", w.Code, w.Body.String())
+			}
+			w = serve(app, http.MethodGet, "/assets/a.txt", nil, "If-None-Match", `"other"`)
+			if w.Code != http.StatusOK {
+				t.Errorf("If-None-Match other response = %d, want 200", w.Code)
+			}
+		})
+	}
+}
+
+func TestStaticDirectory(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   *StaticConfig
+		method   string
+		target   string
+		status   int
+		body     string
+		location string
+	}{
+		{"redirect to trailing slash", nil, http.MethodGet, "/assets/docs?a=1", http.StatusMovedPermanently, "", "/assets/docs/?a=1"},
+		{"index", nil, http.MethodGet, "/assets/docs/", http.StatusOK, "docs", ""},
+		{"head index", nil, http.MethodHead, "/assets/docs/", http.StatusOK, "", ""},
+		{"custom index", &StaticConfig{Index: []string{"a.txt"}}, http.MethodGet, "/assets/files/", http.StatusOK, "a", ""},
+		{"no index", nil, http.MethodGet, "/assets/files/", http.StatusNotFound, `{"code":404,"message":"Not Found"}`, ""},
+		{"browse", &StaticConfig{Browse: true}, http.MethodGet, "/assets/files/", http.StatusOK,
+			"<!doctype html>\n<meta name=\"viewport\" content=\"width=device-width\">\n<pre>\n" +
+				"<a href=\"%3Cb%3E.txt\">&lt;b&gt;.txt</a>\n<a href=\"a.txt\">a.txt</a>\n" +
+				"<a href=\"skip.txt.gz/\">skip.txt.gz/</a>\n<a href=\"sub/\">sub/</a>\n</pre>", ""},
+		{"missing file", nil, http.MethodGet, "/assets/missing.txt", http.StatusNotFound, `{"code":404,"message":"Not Found"}`, ""},
+		{"path traversal is cleaned", nil, http.MethodGet, "/assets/files/../../app.js", http.StatusOK, "console.log(1)", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			app.StaticFS("/assets", testStaticFS(), tt.config)
+			w := serve(app, tt.method, tt.target, nil)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if body := strings.TrimSpace(w.Body.String()); tt.status != http.StatusMovedPermanently && body != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+			if got := w.Header().Get("Location"); got != tt.location {
+				t.Errorf("Location = %q, want %q", got, tt.location)
+			}
+		})
+	}
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		encoding       string
+		want           bool
+	}{
+		{"gzip, deflate, br", "br", true},
+		{"gzip", "br", false},
+		{"br;q=0", "br", false},
+		{"br; q=0.5", "br", true},
+		{"*", "gzip", true},
+		{"*;q=0", "gzip", false},
+		{"", "gzip", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.acceptEncoding+" "+tt.encoding, func(t *testing.T) {
+			if got := acceptsEncoding(tt.acceptEncoding, tt.encoding); got != tt.want {
+				t.Errorf("acceptsEncoding(%q, %q) = %v, want %v", tt.acceptEncoding, tt.encoding, got, tt.want)
+			}
+		})
+	}
+}
@@ -30,3 +30,64 @@ type AsyncTask interface {
 	GetDelay() time.Duration
 	IsTimeout() bool
 }
+
+// ExecuteTask 执行任务
+func (app *Application) ExecuteTask(task Task) {
+	c := make(chan *TaskResult, 1)
+	app.tasks.Add(1)
+	go func() {
+		if task.GetDelay() > 0 {
+			<-time.After(task.GetDelay())
+		}
+		task.BeforeExecute(app)
+		c <- task.Execute(app)
+	}()
+	go func() {
+		defer app.tasks.Done()
+		select {
+		case result := <-c:
+			if task.IsTimeout() {
+				return
+			}
+			task.AfterExecute(app)
+			task.Completed(app, result)
+		case <-time.After(task.GetTimeout()):
+			task.Timeout(app)
+		}
+	}()
+}
+
+// ExecuteAsyncTask 执行异步任务，延迟时间内同名的任务会被聚合到第一个任务里
+func (app *Application) ExecuteAsyncTask(task AsyncTask) {
+	app.asyncTaskLock.Lock()
+	if existTask, ok := app.asyncTaskPool[task.GetName()]; ok {
+		existTask.Aggregation(app, task)
+		app.asyncTaskLock.Unlock()
+		return
+	}
+	app.asyncTaskPool[task.GetName()] = task
+	app.asyncTaskLock.Unlock()
+	c := make(chan *TaskResult, 1)
+	app.tasks.Add(1)
+	go func() {
+		<-time.After(task.GetDelay())
+		app.asyncTaskLock.Lock()
+		delete(app.asyncTaskPool, task.GetName())
+		app.asyncTaskLock.Unlock()
+		task.BeforeExecute(app)
+		c <- task.Execute(app)
+	}()
+	go func() {
+		defer app.tasks.Done()
+		select {
+		case result := <-c:
+			if task.IsTimeout() {
+				return
+			}
+			task.AfterExecute(app)
+			task.Completed(app, result)
+		case <-time.After(task.GetTimeout()):
+			task.Timeout(app)
+		}
+	}()
+}
@@ -0,0 +1,241 @@
+package flow
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// TemplateConfig 定义html模板配置
+// 模板名称是模板文件相对模板目录的路径去掉后缀，如users/list，
+// layouts和partials目录下的模板是公共模板，所有页面模板都可以引用，如{{ template "partials/header" . }}，
+// 使用布局时页面模板定义content模板，布局模板通过{{ template "content" . }}引用
+type TemplateConfig struct {
+	Dir    string           // 模板目录
+	FS     fs.FS            // 模板文件系统，如embed.FS，设置后忽略Dir
+	Ext    string           // 模板文件后缀，默认值.html
+	Layout string           // 默认的布局模板名称，如layouts/main，为空时不使用布局
+	Funcs  template.FuncMap // 自定义模板函数
+	Reload bool             // 每次渲染时重新加载模板，开发调试时使用
+}
+
+// 返回默认的模板配置
+func defTemplateConfig() *TemplateConfig {
+	return &TemplateConfig{
+		Dir: "templates",
+		Ext: ".html",
+	}
+}
+
+// 公共模板的目录
+var sharedTemplateDirs = []string{"layouts/", "partials/"}
+
+// 定义模板引擎，保存所有页面模板
+type templateEngine struct {
+	mu     sync.RWMutex
+	config *TemplateConfig
+	pages  map[string]*template.Template
+	loaded bool
+}
+
+// 返回模板文件系统
+func (te *templateEngine) fileSystem() fs.FS {
+	if te.config.FS != nil {
+		return te.config.FS
+	}
+	return os.DirFS(te.config.Dir)
+}
+
+// 加载所有的模板，每个页面模板和公共模板组成独立的模板集合，不同页面可以定义同名的content模板
+func (te *templateEngine) load() (map[string]*template.Template, error) {
+	fsys := te.fileSystem()
+	shared := make(map[string]string)
+	pages := make(map[string]string)
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(p, te.config.Ext) {
+			return nil
+		}
+		content, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(p, te.config.Ext)
+		for _, dir := range sharedTemplateDirs {
+			if strings.HasPrefix(p, dir) {
+				shared[name] = string(content)
+				return nil
+			}
+		}
+		pages[name] = string(content)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	base := template.New("").Funcs(te.config.Funcs)
+	for name, content := range shared {
+		if _, err = base.New(name).Parse(content); err != nil {
+			return nil, err
+		}
+	}
+	result := make(map[string]*template.Template, len(pages)+len(shared))
+	for name, content := range pages {
+		t, err := base.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if _, err = t.New(name).Parse(content); err != nil {
+			return nil, err
+		}
+		result[name] = t
+	}
+	// 公共模板也可以单独渲染，如邮件的片段
+	for name := range shared {
+		result[name] = base
+	}
+	return result, nil
+}
+
+// 获取页面模板，开启Reload时每次都重新加载
+func (te *templateEngine) lookup(name string) (*template.Template, error) {
+	if te.config.Reload {
+		pages, err := te.load()
+		if err != nil {
+			return nil, err
+		}
+		return te.find(pages, name)
+	}
+	te.mu.RLock()
+	if te.loaded {
+		defer te.mu.RUnlock()
+		return te.find(te.pages, name)
+	}
+	te.mu.RUnlock()
+	if err := te.preload(); err != nil {
+		return nil, err
+	}
+	te.mu.RLock()
+	defer te.mu.RUnlock()
+	return te.find(te.pages, name)
+}
+
+// 加载并缓存所有的模板，只会加载一次
+func (te *templateEngine) preload() error {
+	te.mu.Lock()
+	defer te.mu.Unlock()
+	if te.loaded {
+		return nil
+	}
+	pages, err := te.load()
+	if err != nil {
+		return err
+	}
+	te.pages = pages
+	te.loaded = true
+	return nil
+}
+
+// 从模板集合里查找模板
+func (te *templateEngine) find(pages map[string]*template.Template, name string) (*template.Template, error) {
+	name = strings.TrimSuffix(path.Clean(name), te.config.Ext)
+	t, ok := pages[name]
+	if !ok {
+		return nil, fmt.Errorf("template `%s` not found", name)
+	}
+	return t, nil
+}
+
+// 渲染模板，layout为空时直接渲染页面模板
+func (te *templateEngine) render(w io.Writer, name string, layout string, data interface{}) error {
+	t, err := te.lookup(name)
+	if err != nil {
+		return err
+	}
+	entry := strings.TrimSuffix(path.Clean(name), te.config.Ext)
+	if len(layout) > 0 && !isSharedTemplate(entry) {
+		entry = layout
+	}
+	return t.ExecuteTemplate(w, entry, data)
+}
+
+// 判断是不是公共模板
+func isSharedTemplate(name string) bool {
+	for _, dir := range sharedTemplateDirs {
+		if strings.HasPrefix(name, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetTemplateConfig 设置html模板配置
+func (app *Application) SetTemplateConfig(templateConfig *TemplateConfig) *Application {
+	if templateConfig == nil {
+		templateConfig = defTemplateConfig()
+	}
+	if len(templateConfig.Ext) == 0 {
+		templateConfig.Ext = defTemplateConfig().Ext
+	}
+	if len(templateConfig.Dir) == 0 {
+		templateConfig.Dir = defTemplateConfig().Dir
+	}
+	app.templateConfig = templateConfig
+	app.templates = &templateEngine{config: templateConfig}
+	return app
+}
+
+// GetTemplateConfig 获取html模板配置
+func (app *Application) GetTemplateConfig() *TemplateConfig {
+	return app.templateConfig
+}
+
+// RenderTemplate 渲染模板到writer，可以用于渲染邮件等非http请求的场景，layout为空时不使用布局
+func (app *Application) RenderTemplate(w io.Writer, name string, layout string, data interface{}) error {
+	if app.templates == nil {
+		return fmt.Errorf("template config is not set")
+	}
+	return app.templates.render(w, name, layout, data)
+}
+
+// Render 使用默认的布局渲染html模板并返回，模板错误交给panic处理方法处理
+func (c *Context) Render(name string, data interface{}) {
+	layout := ""
+	if c.app.templateConfig != nil {
+		layout = c.app.templateConfig.Layout
+	}
+	c.RenderWithLayout(name, layout, data)
+}
+
+// RenderWithLayout 使用指定的布局渲染html模板并返回，layout为空时不使用布局
+func (c *Context) RenderWithLayout(name string, layout string, data interface{}) {
+	buf := new(bytes.Buffer)
+	if err := c.app.RenderTemplate(buf, name, layout, data); err != nil {
+		panic(err)
+	}
+	c.SetHeader(HttpHeaderContentType, "text/html; charset=utf-8")
+	c.res.raw(buf.Bytes())
+}
+
+// 初始化模板，启动时加载一次模板，尽早发现模板错误，加载失败时返回错误，服务不会启动
+func initTemplate(app *Application) error {
+	if app.templates == nil || app.templateConfig.Reload {
+		return nil
+	}
+	if err := app.templates.preload(); err != nil {
+		return fmt.Errorf("load templates: %w", err)
+	}
+	app.Logger.Info("template engine started", zap.String("dir", app.templateConfig.Dir),
+		zap.String("layout", app.templateConfig.Layout), zap.Bool("embed", app.templateConfig.FS != nil))
+	return nil
+}
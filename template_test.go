@@ -0,0 +1,166 @@
+package flow
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// 测试用的模板文件
+func testTemplateFS() fstest.MapFS {
+	return fstest.MapFS{
+		"layouts/main.html":   {Data: []byte(`<html>{{ template "content" . }}</html>`)},
+		"partials/title.html": {Data: []byte(`<h1>{{ .Title }}</h1>`)},
+		"users/list.html":     {Data: []byte(`{{ define "content" }}{{ template "partials/title" . }}<p>{{ upper .Name }}</p>{{ end }}`)},
+		"home.html":           {Data: []byte(`{{ define "content" }}home {{ .Name }}{{ end }}`)},
+		"plain.html":          {Data: []byte(`plain {{ .Name }}`)},
+		"readme.txt":          {Data: []byte(`{{ not a template`)},
+	}
+}
+
+func TestRender(t *testing.T) {
+	data := map[string]string{"Title": "Users", "Name": "<bob>"}
+	tests := []struct {
+		name   string
+		render func(ctx *Context)
+		status int
+		body   string
+	}{
+		{"page with layout and partial", func(ctx *Context) {
+			ctx.Render("users/list", data)
+		}, http.StatusOK, "<html><h1>Users</h1><p>&lt;BOB&gt;</p></html>"},
+		{"pages define the same content", func(ctx *Context) {
+			ctx.Render("home.html", data)
+		}, http.StatusOK, "<html>home &lt;bob&gt;</html>"},
+		{"without layout", func(ctx *Context) {
+			ctx.RenderWithLayout("plain", "", data)
+		}, http.StatusOK, "plain &lt;bob&gt;"},
+		{"shared template ignores layout", func(ctx *Context) {
+			ctx.Render("partials/title", data)
+		}, http.StatusOK, "<h1>Users</h1>"},
+		{"not found", func(ctx *Context) {
+			ctx.Render("missing", data)
+		}, http.StatusInternalServerError, `{"code":500,"message":"Internal Server Error"}`},
+		{"unknown layout", func(ctx *Context) {
+			ctx.RenderWithLayout("home", "layouts/missing", data)
+		}, http.StatusInternalServerError, `{"code":500,"message":"Internal Server Error"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, WithTemplateConfig(&TemplateConfig{
+				FS:     testTemplateFS(),
+				Layout: "layouts/main",
+				Funcs:  template.FuncMap{"upper": strings.ToUpper},
+			}))
+			app.GET("/", tt.render)
+			w := serve(app, http.MethodGet, "/", nil)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+			if tt.status == http.StatusOK && w.Header().Get(HttpHeaderContentType) != "text/html; charset=utf-8" {
+				t.Errorf("Content-Type = %q", w.Header().Get(HttpHeaderContentType))
+			}
+		})
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	app := newTestApp(t)
+	if err := app.RenderTemplate(&bytes.Buffer{}, "home", "", nil); err == nil {
+		t.Error("RenderTemplate() without config error = nil")
+	}
+	app.SetTemplateConfig(&TemplateConfig{FS: testTemplateFS(), Funcs: template.FuncMap{"upper": strings.ToUpper}})
+	if config := app.GetTemplateConfig(); config.Ext != ".html" || config.Dir != "templates" {
+		t.Errorf("config = %+v", config)
+	}
+	buf := &bytes.Buffer{}
+	if err := app.RenderTemplate(buf, "home", "layouts/main", map[string]string{"Name": "bob"}); err != nil || buf.String() != "<html>home bob</html>" {
+		t.Errorf("RenderTemplate() = %q, %v", buf.String(), err)
+	}
+}
+
+func TestTemplateReload(t *testing.T) {
+	tests := []struct {
+		name   string
+		reload bool
+		want   string
+	}{
+		{"cached", false, "v1"},
+		{"reload", true, "v2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			page := filepath.Join(dir, "page.html")
+			if err := os.WriteFile(page, []byte("v1"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			app := newTestApp(t, WithTemplateConfig(&TemplateConfig{Dir: dir, Reload: tt.reload}))
+			app.GET("/", func(ctx *Context) {
+				ctx.Render("page", nil)
+			})
+			if w := serve(app, http.MethodGet, "/", nil); w.Body.String() != "v1" {
+				t.Fatalf("body = %q, want v1", w.Body.String())
+			}
+			if err := os.WriteFile(page, []byte("v2"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if w := serve(app, http.MethodGet, "/", nil); w.Body.String() != tt.want {
+				t.Errorf("body after change = %q, want %q", w.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestInitTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *TemplateConfig
+		wantErr bool
+	}{
+		{"not configured", nil, false},
+		{"valid", &TemplateConfig{FS: fstest.MapFS{"home.html": {Data: []byte("home")}}}, false},
+		{"syntax error", &TemplateConfig{FS: fstest.MapFS{"home.html": {Data: []byte("{{ .Name ")}}}, true},
+		{"missing dir", &TemplateConfig{Dir: filepath.Join(t.TempDir(), "missing")}, true},
+		// 开启Reload时渲染时才加载
+		{"reload skips loading", &TemplateConfig{FS: fstest.MapFS{"home.html": {Data: []byte("{{ .Name ")}}, Reload: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			if tt.config != nil {
+				app.SetTemplateConfig(tt.config)
+			}
+			err := initTemplate(app)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("initTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.HasPrefix(err.Error(), "load templates:") {
+				t.Errorf("error = %v", err)
+			}
+		})
+	}
+}
+
+func TestRunTemplateError(t *testing.T) {
+	app := newTestApp(t, WithTemplateConfig(&TemplateConfig{FS: fstest.MapFS{"home.html": {Data: []byte("{{ .Name ")}}}))
+	started := false
+	app.AddAfterStart(func(app *Application) {
+		started = true
+	})
+	// 模板错误时Run返回错误，不会panic也不会启动服务
+	if err := app.Run(); err == nil || !strings.HasPrefix(err.Error(), "load templates:") {
+		t.Errorf("Run() error = %v, want template error", err)
+	}
+	if started {
+		t.Error("server started with invalid templates")
+	}
+}
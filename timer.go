@@ -1,12 +1,24 @@
 package flow
 
-import "time"
+import (
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
 
 type timerJob struct {
 	stopChan chan bool
+	stopOnce sync.Once
 	timer    Timer
 }
 
+// 停止定时器，可重复调用
+func (t *timerJob) stop() {
+	t.stopOnce.Do(func() {
+		close(t.stopChan)
+	})
+}
+
 type Timer interface {
 	// GetName 定时器的名称
 	GetName() string
@@ -19,3 +31,104 @@ type Timer interface {
 	// IsImmediately 是否立即执行
 	IsImmediately() bool
 }
+
+// StartTimer 启动定时器，已经存在同名的定时器时先停止旧的定时器
+func (app *Application) StartTimer(timer Timer) {
+	tJob := &timerJob{
+		stopChan: make(chan bool),
+		timer:    timer,
+	}
+	app.addTimerJob(tJob)
+	// 如果是周期的
+	if timer.IsPeriodic() {
+		// 如果是立即执行
+		if timer.IsImmediately() {
+			app.runTimer(tJob)
+		}
+		ticker := time.NewTicker(timer.GetInterval())
+		go func() {
+			defer func() {
+				ticker.Stop()
+				app.removeTimerJob(tJob)
+				app.Logger.Info("timer已停止", zap.String("name", timer.GetName()))
+			}()
+			for {
+				select {
+				case <-tJob.stopChan:
+					return
+				case <-ticker.C:
+					app.runTimer(tJob)
+				}
+			}
+		}()
+	} else {
+		t := time.NewTimer(timer.GetInterval())
+		go func() {
+			defer func() {
+				t.Stop()
+				app.removeTimerJob(tJob)
+			}()
+			select {
+			case <-tJob.stopChan:
+			case <-t.C:
+				app.runTimer(tJob)
+			}
+		}()
+	}
+	app.Logger.Info("timer已启动，名称：%s", zap.String("name", timer.GetName()))
+}
+
+// 执行定时器，已经停止的不再执行，正在执行的记录到timerRuns，关闭服务时等待执行完成
+func (app *Application) runTimer(tJob *timerJob) {
+	app.timerLock.Lock()
+	select {
+	case <-tJob.stopChan:
+		app.timerLock.Unlock()
+		return
+	default:
+	}
+	app.timerRuns.Add(1)
+	app.timerLock.Unlock()
+	defer app.timerRuns.Done()
+	tJob.timer.Run(app)
+}
+
+// StopTimer 停止定时器
+func (app *Application) StopTimer(timerName string) {
+	if len(timerName) == 0 {
+		return
+	}
+	app.timerLock.Lock()
+	defer app.timerLock.Unlock()
+	if v, ok := app.timerPool[timerName]; ok {
+		v.stop()
+	}
+}
+
+// 添加定时器到定时器池，停止被替换的同名定时器，避免旧的定时器无法停止
+func (app *Application) addTimerJob(tJob *timerJob) {
+	app.timerLock.Lock()
+	defer app.timerLock.Unlock()
+	if v, ok := app.timerPool[tJob.timer.GetName()]; ok {
+		v.stop()
+	}
+	app.timerPool[tJob.timer.GetName()] = tJob
+}
+
+// 从定时器池删除定时器，同名定时器已被替换的不删除
+func (app *Application) removeTimerJob(tJob *timerJob) {
+	app.timerLock.Lock()
+	defer app.timerLock.Unlock()
+	if v, ok := app.timerPool[tJob.timer.GetName()]; ok && v == tJob {
+		delete(app.timerPool, tJob.timer.GetName())
+	}
+}
+
+// 停止所有的定时器，持有锁停止，返回后不会再有新的定时器开始执行
+func (app *Application) stopAllTimers() {
+	app.timerLock.Lock()
+	defer app.timerLock.Unlock()
+	for _, v := range app.timerPool {
+		v.stop()
+	}
+}
@@ -0,0 +1,130 @@
+package flow
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// CurlTLSConfig 定义httpclient的TLS配置，设置客户端证书时使用双向认证（mTLS）
+type CurlTLSConfig struct {
+	CA                 string      // PEM格式的CA证书，用于校验服务端证书，为空时使用系统的CA
+	CAFile             string      // PEM格式的CA证书文件，CA为空时读取
+	Cert               string      // PEM格式的客户端证书
+	CertFile           string      // PEM格式的客户端证书文件，Cert为空时读取
+	Key                string      `json:"-"` // PEM格式的客户端私钥
+	KeyFile            string      // PEM格式的客户端私钥文件，Key为空时读取
+	ServerName         string      // 校验服务端证书使用的域名，为空时使用请求地址的域名
+	InsecureSkipVerify bool        // 是否不校验服务端证书，只能用于测试
+	MinVersion         uint16      // 最低的TLS版本，默认值tls.VersionTLS12
+	Config             *tls.Config `json:"-"` // 自定义的TLS配置，上面的字段会覆盖到它的副本上
+}
+
+// 返回TLS配置
+func (tlsConfig *CurlTLSConfig) load() (*tls.Config, error) {
+	config := &tls.Config{}
+	if tlsConfig.Config != nil {
+		config = tlsConfig.Config.Clone()
+	}
+	caPEM, err := readPEM(tlsConfig.CA, tlsConfig.CAFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(caPEM) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, errors.New("curl tls: invalid ca pem")
+		}
+		config.RootCAs = pool
+	}
+	certPEM, err := readPEM(tlsConfig.Cert, tlsConfig.CertFile)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := readPEM(tlsConfig.Key, tlsConfig.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(certPEM) > 0 || len(keyPEM) > 0 {
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("curl tls: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if len(tlsConfig.ServerName) > 0 {
+		config.ServerName = tlsConfig.ServerName
+	}
+	if tlsConfig.InsecureSkipVerify {
+		config.InsecureSkipVerify = true
+	}
+	if tlsConfig.MinVersion > 0 {
+		config.MinVersion = tlsConfig.MinVersion
+	}
+	if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+	return config, nil
+}
+
+// 根据httpclient配置创建RoundTripper，设置了Transport时直接使用
+func newCurlTransport(curlConfig *CurlConfig) (http.RoundTripper, error) {
+	if curlConfig.Transport != nil {
+		return curlConfig.Transport, nil
+	}
+	proxy := http.ProxyFromEnvironment
+	if len(curlConfig.Proxy) > 0 {
+		proxyURL, err := url.Parse(curlConfig.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("curl proxy: %w", err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+	var tlsConfig *tls.Config
+	if curlConfig.TLS != nil {
+		var err error
+		if tlsConfig, err = curlConfig.TLS.load(); err != nil {
+			return nil, err
+		}
+	}
+	dialer := &net.Dialer{Timeout: curlConfig.DialTimeout, KeepAlive: curlConfig.KeepAlive}
+	return &http.Transport{
+		Proxy:               proxy,
+		DialContext:         dialer.DialContext,
+		ForceAttemptHTTP2:   true,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: curlConfig.TLSHandshakeTimeout,
+		DisableKeepAlives:   curlConfig.DisableKeepAlives,
+		MaxIdleConns:        curlConfig.MaxIdleConns,
+		MaxIdleConnsPerHost: curlConfig.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     curlConfig.MaxConnsPerHost,
+		IdleConnTimeout:     curlConfig.IdleConnTimeout,
+	}, nil
+}
+
+// 填充连接池的默认值，和http.DefaultTransport一致，每个域名的空闲连接数默认值改为10
+func fillCurlTransportConfig(curlConfig *CurlConfig) {
+	if curlConfig.DialTimeout <= 0 {
+		curlConfig.DialTimeout = 30 * time.Second
+	}
+	if curlConfig.KeepAlive == 0 {
+		curlConfig.KeepAlive = 30 * time.Second
+	}
+	if curlConfig.TLSHandshakeTimeout <= 0 {
+		curlConfig.TLSHandshakeTimeout = 10 * time.Second
+	}
+	if curlConfig.MaxIdleConns <= 0 {
+		curlConfig.MaxIdleConns = 100
+	}
+	if curlConfig.MaxIdleConnsPerHost <= 0 {
+		curlConfig.MaxIdleConnsPerHost = 10
+	}
+	if curlConfig.IdleConnTimeout <= 0 {
+		curlConfig.IdleConnTimeout = 90 * time.Second
+	}
+}
@@ -1,9 +1,16 @@
 package json
 
-import "github.com/json-iterator/go"
+import (
+	stdjson "encoding/json"
+
+	"github.com/json-iterator/go"
+)
 
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
 
+// RawMessage 原始的json数据，使用标准库的类型，第三方库使用标准库编码时也不会被当作[]byte
+type RawMessage = stdjson.RawMessage
+
 func Unmarshal(data []byte, v interface{}) error {
 	return json.Unmarshal(data, v)
 }
@@ -0,0 +1,437 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/funswe/flow/utils/json"
+)
+
+// ValidateFunc 定义自定义校验规则，value是字段的值，param是规则的参数，如min:3里的3
+type ValidateFunc func(value reflect.Value, param string) bool
+
+var (
+	validationLock sync.RWMutex
+	validations    = make(map[string]ValidateFunc) // 自定义校验规则
+	regexCache     sync.Map                        // 正则规则的缓存
+	emailRegex     = regexp.MustCompile(`^[a-zA-Z0-9.!#$%&'*+/=?^_{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+	timeType       = reflect.TypeOf(time.Time{})
+)
+
+// RegisterValidation 注册自定义校验规则，规则名和内置规则相同时覆盖内置规则
+func RegisterValidation(name string, fn ValidateFunc) {
+	validationLock.Lock()
+	defer validationLock.Unlock()
+	validations[name] = fn
+}
+
+// 获取自定义校验规则
+func getValidation(name string) (ValidateFunc, bool) {
+	validationLock.RLock()
+	defer validationLock.RUnlock()
+	fn, ok := validations[name]
+	return fn, ok
+}
+
+// FieldValidateError 定义字段校验错误
+type FieldValidateError struct {
+	Type  string       `json:"type"`            // 校验规则名称，如required，min，参数类型转换失败时为type
+	Value interface{}  `json:"value,omitempty"` // 字段的值
+	Field string       `json:"field"`           // 结构体的字段名
+	Param string       `json:"param"`           // 请求的参数名，嵌套的字段如address.city，items[0].name
+	Arg   string       `json:"arg,omitempty"`   // 校验规则的参数，如min:3里的3
+	Kind  reflect.Kind `json:"-"`               // 字段值的类型，用于返回对应类型的错误信息
+}
+
+func (e *FieldValidateError) Error() string {
+	switch e.Type {
+	case "required":
+		return fmt.Sprintf("param `%s` is required", e.Param)
+	case "min":
+		return e.sizeError("at least")
+	case "max":
+		return e.sizeError("at most")
+	case "len":
+		return e.sizeError("exactly")
+	case "gt":
+		return e.sizeError("greater than")
+	case "gte":
+		return e.sizeError("greater than or equal to")
+	case "lt":
+		return e.sizeError("less than")
+	case "lte":
+		return e.sizeError("less than or equal to")
+	case "email":
+		return fmt.Sprintf("param `%s` must be a valid email address", e.Param)
+	case "regex":
+		return fmt.Sprintf("param `%s` must match the pattern `%s`", e.Param, e.Arg)
+	case "oneof":
+		return fmt.Sprintf("param `%s` must be one of [%s]", e.Param, e.Arg)
+	case "type":
+		return fmt.Sprintf("param `%s` must be a valid %s", e.Param, e.Arg)
+	default:
+		return fmt.Sprintf("param `%s` failed on the `%s` rule", e.Param, e.Type)
+	}
+}
+
+// 返回长度或者大小比较的错误信息，字符串比较长度，数组和map比较元素个数，数字比较大小
+func (e *FieldValidateError) sizeError(op string) string {
+	switch e.Kind {
+	case reflect.String:
+		return fmt.Sprintf("param `%s` length must be %s %s characters", e.Param, op, e.Arg)
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return fmt.Sprintf("param `%s` must contain %s %s items", e.Param, op, e.Arg)
+	default:
+		return fmt.Sprintf("param `%s` must be %s %s", e.Param, op, e.Arg)
+	}
+}
+
+// MarshalJSON 返回的json里带上错误信息
+func (e *FieldValidateError) MarshalJSON() ([]byte, error) {
+	type alias FieldValidateError
+	return json.Marshal(struct {
+		*alias
+		Message string `json:"message"`
+	}{(*alias)(e), e.Error()})
+}
+
+// FieldValidateErrors 定义多个字段的校验错误
+type FieldValidateErrors []*FieldValidateError
+
+func (es FieldValidateErrors) Error() string {
+	messages := make([]string, 0, len(es))
+	for _, e := range es {
+		messages = append(messages, e.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// As 支持errors.As获取第一个字段的校验错误
+func (es FieldValidateErrors) As(target interface{}) bool {
+	if t, ok := target.(**FieldValidateError); ok && len(es) > 0 {
+		*t = es[0]
+		return true
+	}
+	return false
+}
+
+// 定义字段的校验规则
+type validateRule struct {
+	name string
+	arg  string
+}
+
+// 解析flow标签里的校验规则，规则之间用;分隔，规则的参数用:分隔，如flow:"required;min:3;max:20"
+// regex规则的参数是标签剩下的全部内容，正则里可以包含;，所以regex必须是最后一个规则，如flow:"min:3;regex:^[a-z;]+$"
+func parseValidateRules(tag string) []validateRule {
+	rules := make([]validateRule, 0)
+	for len(tag) > 0 {
+		item, rest, _ := strings.Cut(tag, ";")
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			tag = rest
+			continue
+		}
+		name, arg, _ := strings.Cut(item, ":")
+		name = strings.TrimSpace(name)
+		if name == "regex" {
+			// 正则取到标签的结尾
+			_, arg, _ = strings.Cut(strings.TrimSpace(tag), ":")
+			rest = ""
+		}
+		tag = rest
+		// 兼容required:true的写法
+		if name == "required" {
+			if arg == "false" {
+				continue
+			}
+			arg = ""
+		}
+		rules = append(rules, validateRule{name: name, arg: arg})
+	}
+	return rules
+}
+
+// Validate 根据flow标签校验结构体，返回所有字段的校验错误
+func Validate(object interface{}) error {
+	return validateObject(object, "json")
+}
+
+// 校验结构体，nameTag是错误信息里参数名使用的标签
+func validateObject(object interface{}, nameTag string) error {
+	if object == nil {
+		return errors.New("object can not be nil")
+	}
+	v := reflect.ValueOf(object)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return errors.New("object can not be nil")
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return errors.New("object must be a struct or a pointer to struct")
+	}
+	vd := &validator{nameTag: nameTag}
+	if err := vd.validateStruct(v, ""); err != nil {
+		return err
+	}
+	if len(vd.errs) > 0 {
+		return vd.errs
+	}
+	return nil
+}
+
+// 定义校验器，收集所有字段的校验错误
+type validator struct {
+	nameTag string
+	errs    FieldValidateErrors
+}
+
+// 校验结构体的所有字段
+func (vd *validator) validateStruct(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+		// 匿名嵌入的结构体，字段和当前结构体在同一层
+		if field.Anonymous && field.Tag.Get("flow") == "" {
+			if ev, ok := structValue(fv); ok {
+				if err := vd.validateStruct(ev, prefix); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		param := fieldParamName(field, vd.nameTag)
+		if len(prefix) > 0 {
+			param = prefix + "." + param
+		}
+		rules := parseValidateRules(field.Tag.Get("flow"))
+		if err := vd.validateValue(fv, field.Name, param, rules); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 校验字段的值，dive之前的规则作用于字段本身，之后的规则作用于数组或者map的每个元素
+func (vd *validator) validateValue(v reflect.Value, fieldName, param string, rules []validateRule) error {
+	var diveRules []validateRule
+	for i, rule := range rules {
+		if rule.name == "dive" {
+			diveRules = rules[i+1:]
+			rules = rules[:i]
+			break
+		}
+	}
+	for _, rule := range rules {
+		if rule.name == "omitempty" {
+			if isEmptyValue(v) {
+				return nil
+			}
+			continue
+		}
+		if rule.name != "required" && isNilValue(v) {
+			continue
+		}
+		ok, err := checkRule(v, rule)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", fieldName, err)
+		}
+		if !ok {
+			ev := indirectValue(v)
+			fe := &FieldValidateError{Type: rule.name, Field: fieldName, Param: param, Arg: rule.arg, Kind: ev.Kind()}
+			if ev.IsValid() && ev.CanInterface() {
+				fe.Value = ev.Interface()
+			}
+			vd.errs = append(vd.errs, fe)
+			// required失败的不再校验其他规则
+			if rule.name == "required" {
+				return nil
+			}
+		}
+	}
+	ev := indirectValue(v)
+	if !ev.IsValid() {
+		return nil
+	}
+	switch ev.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < ev.Len(); i++ {
+			if err := vd.validateElem(ev.Index(i), fieldName, fmt.Sprintf("%s[%d]", param, i), diveRules); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := ev.MapRange()
+		for iter.Next() {
+			if err := vd.validateElem(iter.Value(), fieldName, fmt.Sprintf("%s[%v]", param, iter.Key().Interface()), diveRules); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		if ev.Type() != timeType {
+			return vd.validateStruct(ev, param)
+		}
+	}
+	return nil
+}
+
+// 校验数组或者map的元素，没有dive规则时只校验结构体元素
+func (vd *validator) validateElem(v reflect.Value, fieldName, param string, rules []validateRule) error {
+	if len(rules) > 0 {
+		return vd.validateValue(v, fieldName, param, rules)
+	}
+	if sv, ok := structValue(v); ok {
+		return vd.validateStruct(sv, param)
+	}
+	return nil
+}
+
+// 执行单个校验规则
+func checkRule(v reflect.Value, rule validateRule) (bool, error) {
+	if fn, ok := getValidation(rule.name); ok {
+		return fn(v, rule.arg), nil
+	}
+	ev := indirectValue(v)
+	switch rule.name {
+	case "required":
+		return !isEmptyValue(v), nil
+	case "min", "max", "len", "gt", "gte", "lt", "lte":
+		return compareSize(ev, rule)
+	case "email":
+		if ev.Kind() != reflect.String {
+			return false, fmt.Errorf("rule email can only be applied to string")
+		}
+		return emailRegex.MatchString(ev.String()), nil
+	case "regex":
+		if ev.Kind() != reflect.String {
+			return false, fmt.Errorf("rule regex can only be applied to string")
+		}
+		re, err := compileRegex(rule.arg)
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(ev.String()), nil
+	case "oneof":
+		value := fmt.Sprint(ev.Interface())
+		for _, option := range strings.Fields(rule.arg) {
+			if value == option {
+				return true, nil
+			}
+		}
+		return false, nil
+	default:
+		return false, fmt.Errorf("unknown validation rule `%s`", rule.name)
+	}
+}
+
+// 比较长度或者大小
+func compareSize(v reflect.Value, rule validateRule) (bool, error) {
+	expected, err := strconv.ParseFloat(rule.arg, 64)
+	if err != nil {
+		return false, fmt.Errorf("invalid param `%s` for rule %s", rule.arg, rule.name)
+	}
+	var actual float64
+	switch v.Kind() {
+	case reflect.String:
+		actual = float64(utf8.RuneCountInString(v.String()))
+	case reflect.Slice, reflect.Array, reflect.Map:
+		actual = float64(v.Len())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		actual = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		actual = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		actual = v.Float()
+	default:
+		return false, fmt.Errorf("rule %s can not be applied to %s", rule.name, v.Kind())
+	}
+	switch rule.name {
+	case "min", "gte":
+		return actual >= expected, nil
+	case "max", "lte":
+		return actual <= expected, nil
+	case "len":
+		return actual == expected, nil
+	case "gt":
+		return actual > expected, nil
+	default:
+		return actual < expected, nil
+	}
+}
+
+// 编译正则规则，编译结果会被缓存
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexCache.Store(pattern, re)
+	return re, nil
+}
+
+// 返回字段对应的参数名，优先使用给定标签的名称，其次是json标签的名称
+func fieldParamName(field reflect.StructField, tag string) string {
+	for _, t := range []string{tag, "json"} {
+		name := strings.Split(field.Tag.Get(t), ",")[0]
+		if len(name) > 0 && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// 返回指针指向的值，nil指针返回无效的值
+func indirectValue(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// 返回结构体的值，不是结构体或者是time.Time的返回false
+func structValue(v reflect.Value) (reflect.Value, bool) {
+	ev := indirectValue(v)
+	if !ev.IsValid() || ev.Kind() != reflect.Struct || ev.Type() == timeType {
+		return reflect.Value{}, false
+	}
+	return ev, true
+}
+
+// 判断值是不是nil
+func isNilValue(v reflect.Value) bool {
+	return !indirectValue(v).IsValid()
+}
+
+// 判断值是不是空值，nil和类型的零值都是空值
+func isEmptyValue(v reflect.Value) bool {
+	if !v.IsValid() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	case reflect.Slice, reflect.Map:
+		return v.IsNil() || v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
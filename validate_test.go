@@ -0,0 +1,182 @@
+package flow
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseValidateRules(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  string
+		want []validateRule
+	}{
+		{"empty", "", []validateRule{}},
+		{"simple", "required;min:3;max:20", []validateRule{{"required", ""}, {"min", "3"}, {"max", "20"}}},
+		{"spaces and empty items", " required ; ;min:3;", []validateRule{{"required", ""}, {"min", "3"}}},
+		{"required true", "required:true", []validateRule{{"required", ""}}},
+		{"required false", "required:false;max:5", []validateRule{{"max", "5"}}},
+		{"regex with semicolon", "min:3;regex:^[a-z;]+$", []validateRule{{"min", "3"}, {"regex", "^[a-z;]+$"}}},
+		{"regex with colon", "regex:^a:b$", []validateRule{{"regex", "^a:b$"}}},
+		{"regex takes the rest", "dive;regex:^x;max:1$", []validateRule{{"dive", ""}, {"regex", "^x;max:1$"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseValidateRules(tt.tag); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseValidateRules(%q) = %v, want %v", tt.tag, got, tt.want)
+			}
+		})
+	}
+}
+
+type validateAddress struct {
+	City string `json:"city" flow:"required"`
+}
+
+type validateItem struct {
+	Name string `json:"name" flow:"required;max:3"`
+}
+
+type validateUser struct {
+	Name    string            `json:"name" flow:"required;min:3;max:5"`
+	Email   string            `json:"email" flow:"omitempty;email"`
+	Age     int               `json:"age" flow:"gt:0;lt:150"`
+	Role    string            `json:"role" flow:"omitempty;oneof:admin user"`
+	Code    string            `json:"code" flow:"omitempty;len:4"`
+	Tags    []string          `json:"tags" flow:"max:2;dive;regex:^[a-z;]+$"`
+	Score   *float64          `json:"score" flow:"gte:0;lte:100"`
+	Address validateAddress   `json:"address"`
+	Items   []validateItem    `json:"items"`
+	Labels  map[string]string `json:"labels" flow:"dive;min:1"`
+}
+
+func validUser() validateUser {
+	return validateUser{Name: "alice", Age: 20, Address: validateAddress{City: "hz"}}
+}
+
+func TestValidate(t *testing.T) {
+	score := func(v float64) *float64 { return &v }
+	tests := []struct {
+		name   string
+		modify func(u *validateUser)
+		want   []string // 校验失败的规则和参数名，如required:name
+	}{
+		{"valid", func(u *validateUser) {}, nil},
+		{"required", func(u *validateUser) { u.Name = "" }, []string{"required:name"}},
+		{"min length counts runes", func(u *validateUser) { u.Name = "张三" }, []string{"min:name"}},
+		{"max length", func(u *validateUser) { u.Name = "abcdef" }, []string{"max:name"}},
+		{"omitempty skips empty", func(u *validateUser) { u.Email = "" }, nil},
+		{"email", func(u *validateUser) { u.Email = "not-an-email" }, []string{"email:email"}},
+		{"gt and lt", func(u *validateUser) { u.Age = 0 }, []string{"gt:age"}},
+		{"lt", func(u *validateUser) { u.Age = 150 }, []string{"lt:age"}},
+		{"oneof", func(u *validateUser) { u.Role = "root" }, []string{"oneof:role"}},
+		{"len", func(u *validateUser) { u.Code = "123" }, []string{"len:code"}},
+		{"slice max", func(u *validateUser) { u.Tags = []string{"a", "b", "c"} }, []string{"max:tags"}},
+		{"dive regex", func(u *validateUser) { u.Tags = []string{"a;b", "B"} }, []string{"regex:tags[1]"}},
+		{"nil pointer skipped", func(u *validateUser) { u.Score = nil }, nil},
+		{"pointer value", func(u *validateUser) { u.Score = score(101) }, []string{"lte:score"}},
+		{"nested struct", func(u *validateUser) { u.Address.City = "" }, []string{"required:address.city"}},
+		{"slice of structs", func(u *validateUser) { u.Items = []validateItem{{"ok"}, {"long"}} }, []string{"max:items[1].name"}},
+		{"dive map", func(u *validateUser) { u.Labels = map[string]string{"k": ""} }, []string{"min:labels[k]"}},
+		{"collects all errors", func(u *validateUser) { u.Name = ""; u.Age = -1 }, []string{"required:name", "gt:age"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := validUser()
+			tt.modify(&u)
+			err := Validate(&u)
+			var got []string
+			if err != nil {
+				var errs FieldValidateErrors
+				if !errors.As(err, &errs) {
+					t.Fatalf("Validate() error = %v, want FieldValidateErrors", err)
+				}
+				for _, e := range errs {
+					got = append(got, e.Type+":"+e.Param)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateInvalidInput(t *testing.T) {
+	type badRule struct {
+		Name string `flow:"unknown"`
+	}
+	type badArg struct {
+		Name string `flow:"min:x"`
+	}
+	type badType struct {
+		Age int `flow:"email"`
+	}
+	var nilUser *validateUser
+	tests := []struct {
+		name   string
+		object interface{}
+	}{
+		{"nil", nil},
+		{"nil pointer", nilUser},
+		{"not a struct", "x"},
+		{"unknown rule", &badRule{Name: "x"}},
+		{"invalid rule param", &badArg{Name: "x"}},
+		{"rule on wrong type", &badType{Age: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.object)
+			if err == nil {
+				t.Fatal("Validate() error = nil, want error")
+			}
+			var errs FieldValidateErrors
+			if errors.As(err, &errs) {
+				t.Errorf("Validate() error = %v, want a non-validation error", err)
+			}
+		})
+	}
+}
+
+func TestRegisterValidation(t *testing.T) {
+	RegisterValidation("even", func(v reflect.Value, param string) bool {
+		return v.Int()%2 == 0
+	})
+	type even struct {
+		N int `json:"n" flow:"even"`
+	}
+	if err := Validate(&even{N: 2}); err != nil {
+		t.Errorf("Validate(2) error = %v, want nil", err)
+	}
+	err := Validate(&even{N: 3})
+	var fe *FieldValidateError
+	if !errors.As(err, &fe) || fe.Type != "even" || fe.Param != "n" {
+		t.Fatalf("Validate(3) error = %v, want even error on n", err)
+	}
+	if !strings.Contains(fe.Error(), "`even`") {
+		t.Errorf("Error() = %q, want the rule name", fe.Error())
+	}
+}
+
+func TestFieldValidateErrorMessage(t *testing.T) {
+	tests := []struct {
+		err  *FieldValidateError
+		want string
+	}{
+		{&FieldValidateError{Type: "required", Param: "name"}, "param `name` is required"},
+		{&FieldValidateError{Type: "min", Param: "name", Arg: "3", Kind: reflect.String}, "param `name` length must be at least 3 characters"},
+		{&FieldValidateError{Type: "max", Param: "tags", Arg: "2", Kind: reflect.Slice}, "param `tags` must contain at most 2 items"},
+		{&FieldValidateError{Type: "gt", Param: "age", Arg: "0", Kind: reflect.Int}, "param `age` must be greater than 0"},
+		{&FieldValidateError{Type: "regex", Param: "tag", Arg: "^[a-z]+$"}, "param `tag` must match the pattern `^[a-z]+$`"},
+		{&FieldValidateError{Type: "oneof", Param: "role", Arg: "admin user"}, "param `role` must be one of [admin user]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Type, func(t *testing.T) {
+			if got := tt.err.Error(); got != tt.want {
+				t.Errorf("Error() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}